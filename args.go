@@ -0,0 +1,329 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"fmt"
+	"reflect"
+)
+
+// Args is a marker to embed in a struct type to have values of that type expanded as
+// multiple arguments of a statement, one for each exported field, in declaration order.
+//
+// This allows to name the arguments of statements that have many parameters:
+//
+//	type newPOIArgs struct {
+//		sqlfunc.Args
+//		Lat, Lon float64
+//		Name     string
+//	}
+//
+//	var newPOI func(ctx context.Context, args newPOIArgs) (sql.Result, error)
+//	close, err := sqlfunc.Exec(ctx, db, `INSERT INTO poi (lat, lon, name) VALUES (?, ?, ?)`, &newPOI)
+//	// if err != nil ...
+//	defer close()
+//	res, err := newPOI(ctx, newPOIArgs{Lat: 48.8016, Lon: 2.1204, Name: "Château de Versailles"})
+type Args struct{}
+
+var typeArgs = reflect.TypeOf(Args{})
+
+// ArgsProvider is implemented by types that produce their own positional arguments for a
+// statement. A value passed as the single argument (after the context and the optional
+// transaction) of a func created by [Exec], [QueryRow], [QueryRowLazy] or [Query] is replaced
+// by the values returned by SQLArgs, to which the registered converters are then applied.
+//
+// ArgsProvider takes precedence over the expansion of the fields of a struct embedding [Args]
+// and over the binding of a map to named placeholders. As the number of arguments is only known
+// at call time, it is checked against the placeholders of the query when the func is called.
+//
+//	type span struct{ from, to time.Time }
+//
+//	func (s span) SQLArgs() []any {
+//		return []any{s.from.UTC().Format(time.RFC3339), s.to.UTC().Format(time.RFC3339)}
+//	}
+type ArgsProvider interface {
+	SQLArgs() []interface{}
+}
+
+var typeArgsProvider = reflect.TypeOf((*ArgsProvider)(nil)).Elem()
+
+// argsBinder converts the arguments of a generated func into arguments for the driver.
+type argsBinder struct {
+	n int // number of arguments for the driver
+	// fields has, for each argument of a type embedding Args, the indexes of the fields to expand.
+	fields [][]int
+	// check, if set, validates each converted argument (see WithArgsCheck).
+	check func(interface{}) error
+	// named is set if the arguments are a single map giving the values of named placeholders.
+	named bool
+	// names are the names of the placeholders of the query, in order, if named is set.
+	names []string
+	// provided is set if the arguments are given by the single argument (see ArgsProvider).
+	provided bool
+	// expected is the number of arguments of the query, or -1 if unknown. It is checked
+	// when binding.
+	expected int
+	// fnType is the type of the generated func, for error messages.
+	fnType reflect.Type
+}
+
+// newArgsBinder prepares the binding of arguments of the given types.
+func newArgsBinder(types []reflect.Type) *argsBinder {
+	b := &argsBinder{expected: -1}
+	if len(types) == 1 && types[0].Implements(typeArgsProvider) {
+		b.provided = true
+		return b
+	}
+	if len(types) == 1 && types[0].Kind() == reflect.Map && types[0].Key().Kind() == reflect.String {
+		b.named = true
+		return b
+	}
+	for i, t := range types {
+		fields := argsFields(t)
+		if fields == nil {
+			b.n++
+			continue
+		}
+		b.n += len(fields)
+		if b.fields == nil {
+			b.fields = make([][]int, len(types))
+		}
+		b.fields[i] = fields
+	}
+	return b
+}
+
+// argsFields returns the indexes of the fields to expand if t embeds [Args].
+func argsFields(t reflect.Type) []int {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var marked bool
+	fields := []int{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type == typeArgs {
+			marked = true
+			continue
+		}
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		fields = append(fields, i)
+	}
+	if !marked {
+		return nil
+	}
+	return fields
+}
+
+// bind converts in, the arguments of a generated func (after the context and the optional
+// transaction), into arguments for the driver, expanding [Args] structs and applying the
+// registered converters. The number of arguments is checked against the placeholders of the
+// query, if known (see checkPlaceholders).
+func (b *argsBinder) bind(in []reflect.Value) ([]interface{}, error) {
+	args, err := b.convert(in)
+	if err == nil && b.expected >= 0 && len(args) != b.expected {
+		return nil, fmt.Errorf("sqlfunc: %v: expected %d arguments, got %d", b.fnType, b.expected, len(args))
+	}
+	return args, err
+}
+
+func (b *argsBinder) convert(in []reflect.Value) ([]interface{}, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	if b.provided {
+		return b.bindProvided(in[0])
+	}
+	if b.named {
+		return b.bindNamed(in[0])
+	}
+	args := make([]interface{}, 0, b.n)
+	for i, a := range in {
+		if b.fields != nil && b.fields[i] != nil {
+			for _, f := range b.fields[i] {
+				v, err := bindArg(a.Field(f))
+				if err != nil {
+					return nil, fmt.Errorf("sqlfunc: converting argument %d, field %s: %w", i+1, a.Type().Field(f).Name, err)
+				}
+				if err = b.checkArg(v); err != nil {
+					return nil, fmt.Errorf("sqlfunc: argument %d, field %s of type %v: %w", i+1, a.Type().Field(f).Name, a.Type().Field(f).Type, err)
+				}
+				args = append(args, v)
+			}
+			continue
+		}
+		v, err := bindArg(a)
+		if err != nil {
+			return nil, fmt.Errorf("sqlfunc: converting argument %d: %w", i+1, err)
+		}
+		if err = b.checkArg(v); err != nil {
+			return nil, fmt.Errorf("sqlfunc: argument %d of type %v: %w", i+1, a.Type(), err)
+		}
+		args = append(args, v)
+	}
+	return args, nil
+}
+
+// bindProvided converts the values returned by the SQLArgs method of a (see [ArgsProvider])
+// into arguments for the driver.
+func (b *argsBinder) bindProvided(a reflect.Value) ([]interface{}, error) {
+	if (a.Kind() == reflect.Ptr || a.Kind() == reflect.Interface) && a.IsNil() {
+		return nil, fmt.Errorf("sqlfunc: nil %v argument", a.Type())
+	}
+	values := a.Interface().(ArgsProvider).SQLArgs()
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		v, err := bindArg(reflect.ValueOf(value))
+		if err != nil {
+			return nil, fmt.Errorf("sqlfunc: converting argument %d given by %v: %w", i+1, a.Type(), err)
+		}
+		if err = b.checkArg(v); err != nil {
+			return nil, fmt.Errorf("sqlfunc: argument %d given by %v of type %T: %w", i+1, a.Type(), value, err)
+		}
+		args[i] = v
+	}
+	return args, nil
+}
+
+// bindNamed converts the values of m, a map, for the named placeholders of the query into
+// [sql.NamedArg] arguments for the driver.
+func (b *argsBinder) bindNamed(m reflect.Value) ([]interface{}, error) {
+	args := make([]interface{}, len(b.names))
+	keyType := m.Type().Key()
+	for i, name := range b.names {
+		a := m.MapIndex(reflect.ValueOf(name).Convert(keyType))
+		if !a.IsValid() {
+			return nil, fmt.Errorf("sqlfunc: missing value for named parameter %q", name)
+		}
+		if a.Kind() == reflect.Interface && !a.IsNil() {
+			a = a.Elem() // apply the converter of the dynamic type
+		}
+		v, err := bindArg(a)
+		if err != nil {
+			return nil, fmt.Errorf("sqlfunc: converting named parameter %q: %w", name, err)
+		}
+		if err = b.checkArg(v); err != nil {
+			return nil, fmt.Errorf("sqlfunc: named parameter %q of type %v: %w", name, a.Type(), err)
+		}
+		args[i] = sql.Named(name, v)
+	}
+	return args, nil
+}
+
+// checkArg applies the check of arguments, if any, to v, except to the special arguments
+// handled by [database/sql] itself.
+func (b *argsBinder) checkArg(v interface{}) error {
+	if b.check == nil {
+		return nil
+	}
+	switch v := v.(type) {
+	case sql.NamedArg:
+		return b.checkArg(v.Value)
+	case sql.Out:
+		return nil
+	}
+	return b.check(v)
+}
+
+// checkPlaceholders panics if the number of arguments given to the driver by fnType
+// doesn't match the placeholders of query, when they can be counted with certainty.
+// dollar tells that the driver uses "$N" placeholders (see countPlaceholders).
+//
+// For a map argument, it records the names of the placeholders and panics if the query
+// doesn't use only named placeholders.
+//
+// It also records the number of arguments expected by the query, to check at call time
+// the arguments known only then (see [ArgsProvider]) and the distinct named placeholders
+// bound by position.
+func (b *argsBinder) checkPlaceholders(query string, fnType reflect.Type, dollar bool) {
+	b.fnType = fnType
+	if b.named {
+		if b.names = namedPlaceholders(query); b.names == nil {
+			panic(fmt.Sprintf("%v: a map argument requires a query with named placeholders only", fnType))
+		}
+		b.n = len(b.names)
+		return
+	}
+	n := countPlaceholders(query, dollar)
+	if n < 0 {
+		if names := namedPlaceholders(query); names != nil {
+			b.expected = len(names)
+		}
+		return
+	}
+	if !b.provided && n != b.n {
+		panic(fmt.Sprintf("%v binds %d arguments but the query expects %d", fnType, b.n, n))
+	}
+	b.expected = n
+}
+
+// bindArg converts a single argument, applying the registered converters, then
+// [encoding.TextMarshaler] (see [TextScanner]).
+func bindArg(a reflect.Value) (interface{}, error) {
+	if c := converterFor(a.Type()); c != nil && c.Value != nil {
+		return c.Value(a.Interface())
+	}
+	if isTextArg(a.Type()) {
+		if a.Kind() == reflect.Ptr && a.IsNil() {
+			return nil, nil
+		}
+		text, err := a.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return string(text), nil
+	}
+	return a.Interface(), nil
+}
+
+// isTextArg reports whether arguments of type t are bound as the text returned by MarshalText.
+func isTextArg(t reflect.Type) bool {
+	return t.Implements(typeTextMarshaler) && !t.Implements(typeValuer) && t != typeTime && !isNativeKind(t)
+}
+
+// isNativeKind reports whether the values of type t (or pointed by t) have a kind handled by
+// [database/sql/driver.DefaultParameterConverter] and by the scanning of [database/sql]:
+// bool, integers, floats, string and []byte.
+func isNativeKind(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
+// defaultArgsCheck accepts the values accepted by the default conversion of [database/sql],
+// used for drivers that don't implement [database/sql/driver.NamedValueChecker].
+func defaultArgsCheck(v interface{}) error {
+	_, err := driver.DefaultParameterConverter.ConvertValue(v)
+	return err
+}
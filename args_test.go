@@ -0,0 +1,225 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func ExampleArgs() {
+	check := func(msg string, err error) {
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", msg, err))
+		}
+	}
+
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	check("Open", err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.ExecContext(ctx, ``+
+		`CREATE TABLE poi (`+
+		`lat DECIMAL, lon DECIMAL, name VARCHAR(255), country CHAR(2), visitors INTEGER, updated_at DATETIME`+
+		`)`)
+	check("Create table", err)
+
+	// The fields are bound in declaration order
+	type poiArgs struct {
+		sqlfunc.Args
+		Lat, Lon  float64
+		Name      string
+		Country   string
+		Visitors  int64
+		UpdatedAt time.Time
+	}
+
+	var insertPOI func(ctx context.Context, poi poiArgs) (sql.Result, error)
+	closeInsertPOI, err := sqlfunc.Exec(
+		ctx, db,
+		`INSERT INTO poi (lat, lon, name, country, visitors, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		&insertPOI,
+	)
+	check("Prepare insertPOI", err)
+	defer closeInsertPOI()
+
+	_, err = insertPOI(ctx, poiArgs{
+		Lat:       48.8016,
+		Lon:       2.1204,
+		Name:      "Château de Versailles",
+		Country:   "FR",
+		Visitors:  8_000_000,
+		UpdatedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	check("insertPOI", err)
+
+	var getPOI func(ctx context.Context, country string) (name string, visitors int64, err error)
+	closeGetPOI, err := sqlfunc.QueryRow(ctx, db, `SELECT name, visitors FROM poi WHERE country = ?`, &getPOI)
+	check("Prepare getPOI", err)
+	defer closeGetPOI()
+
+	name, visitors, err := getPOI(ctx, "FR")
+	check("getPOI", err)
+	fmt.Println(name, visitors)
+
+	// Output:
+	// Château de Versailles 8000000
+}
+
+func TestWithArgsCheck(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	type point struct{ X, Y int }
+
+	var f func(ctx context.Context, n int, p point) (int, error)
+	closeF, err := sqlfunc.QueryRow(ctx, db, `SELECT ? + ?`, &f, sqlfunc.WithArgsCheck(nil))
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeF()
+
+	_, err = f(ctx, 1, point{})
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	if msg := err.Error(); !strings.HasPrefix(msg, "sqlfunc: argument 2 of type sqlfunc_test.point: ") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Custom check
+	errNegative := errors.New("negative")
+	var g func(ctx context.Context, a, b int) (int, error)
+	closeG, err := sqlfunc.QueryRow(ctx, db, `SELECT ? + ?`, &g, sqlfunc.WithArgsCheck(func(v interface{}) error {
+		if n, ok := v.(int); ok && n < 0 {
+			return errNegative
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeG()
+
+	if n, err := g(ctx, 1, 2); err != nil || n != 3 {
+		t.Errorf("got %d, %v", n, err)
+	}
+	if _, err = g(ctx, 1, -2); !errors.Is(err, errNegative) {
+		t.Errorf("got %v, expected %v", err, errNegative)
+	}
+}
+
+// bbox is a value object that binds itself as the four bounds of a box.
+type bbox struct {
+	South, West, North, East float64
+}
+
+func (b bbox) SQLArgs() []interface{} {
+	return []interface{}{b.South, b.North, b.West, b.East}
+}
+
+func ExampleArgsProvider() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	var inBox func(ctx context.Context, box bbox) (*sql.Rows, error)
+	closeInBox, err := sqlfunc.Query(ctx, db,
+		`SELECT name FROM poi WHERE lat BETWEEN ? AND ? AND lon BETWEEN ? AND ? ORDER BY name`,
+		&inBox)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+	defer closeInBox()
+
+	ileDeFrance := bbox{South: 48.1, West: 1.4, North: 49.3, East: 3.6}
+	rows, err := inBox(ctx, ileDeFrance)
+	if err != nil {
+		fmt.Println("inBox:", err)
+		return
+	}
+	err = sqlfunc.ForEach(rows, func(name string) {
+		fmt.Println(name)
+	})
+	if err != nil {
+		fmt.Println("ForEach:", err)
+	}
+
+	// Output:
+	// Château de Versailles
+}
+
+// providedArgs embeds Args, but SQLArgs takes precedence over the expansion of its fields.
+type providedArgs struct {
+	sqlfunc.Args
+	A, B int
+}
+
+func (p *providedArgs) SQLArgs() []interface{} {
+	return []interface{}{p.A + p.B, nil, fmt.Sprint(p.A, "+", p.B)}
+}
+
+func TestArgsProvider(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	var checked []interface{}
+	var query func(ctx context.Context, args *providedArgs) (sum int, null *int, text string, err error)
+	closeQuery, err := sqlfunc.QueryRow(ctx, db, `SELECT ?, ?, ?`, &query,
+		sqlfunc.WithArgsCheck(func(arg interface{}) error {
+			checked = append(checked, arg)
+			return nil
+		}))
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeQuery()
+
+	sum, null, text, err := query(ctx, &providedArgs{A: 1, B: 2})
+	if err != nil || sum != 3 || null != nil || text != "1+2" {
+		t.Errorf("got %d, %v, %q, %v", sum, null, text, err)
+	}
+	if len(checked) != 2 {
+		t.Errorf("checked: got %v", checked)
+	}
+
+	if _, _, _, err = query(ctx, nil); err == nil {
+		t.Error("nil: error expected")
+	}
+}
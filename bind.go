@@ -0,0 +1,109 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import "reflect"
+
+// Bind1 returns a func that calls the func pointed to by fnPtr with arg bound as its first
+// query argument (the argument after the [context.Context] and the optional [*database/sql.Tx]).
+//
+// The returned func has the same signature as the func pointed to by fnPtr, minus the bound
+// argument. It must be type-asserted to that type (see [Partial] for a type-safe variant).
+//
+// Bind1 is useful for statements frequently called with the same argument (ex: a tenant ID):
+//
+//	var getUser func(ctx context.Context, tx *sql.Tx, tenantID int64, userID int64) (string, error)
+//	// sqlfunc.QueryRow(ctx, db, `SELECT name FROM user WHERE tenant_id = ? AND id = ?`, &getUser)
+//	getTenantUser := sqlfunc.Bind1(&getUser, tenantID).(func(ctx context.Context, tx *sql.Tx, userID int64) (string, error))
+//	name, err := getTenantUser(ctx, nil, userID)
+//
+// The func pointed to by fnPtr is read once by Bind1: it must have been set before.
+func Bind1(fnPtr interface{}, arg interface{}) interface{} {
+	vPtr := reflect.ValueOf(fnPtr)
+	if vPtr.Type().Kind() != reflect.Ptr {
+		panic("fnPtr must be a *pointer* to a func variable")
+	}
+	if vPtr.IsNil() {
+		panic("fnPtr must be non-nil")
+	}
+	fn := vPtr.Elem()
+	if fn.Kind() != reflect.Func {
+		panic("fnPtr must be a pointer to a *func* variable")
+	}
+	if fn.IsNil() {
+		panic("func must be set before binding")
+	}
+	return bind1(fn, arg).Interface()
+}
+
+func bind1(fn reflect.Value, arg interface{}) reflect.Value {
+	fnType := fn.Type()
+	numIn := fnType.NumIn()
+	if numIn < 1 || fnType.In(0) != typeContext {
+		panic("func first arg must be a context.Context")
+	}
+	pos := 1
+	if hasTxArg(fnType) {
+		pos = 2
+	}
+	if numIn <= pos {
+		panic("func has no argument to bind")
+	}
+	variadic := fnType.IsVariadic()
+	if variadic && pos == numIn-1 {
+		panic("the variadic argument can't be bound")
+	}
+
+	argType := fnType.In(pos)
+	var argValue reflect.Value
+	if arg == nil {
+		switch argType.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			argValue = reflect.Zero(argType)
+		default:
+			panic("nil can't be bound to argument of type " + argType.String())
+		}
+	} else {
+		argValue = reflect.ValueOf(arg)
+		if !argValue.Type().AssignableTo(argType) {
+			panic(argValue.Type().String() + " can't be bound to argument of type " + argType.String())
+		}
+	}
+
+	in := make([]reflect.Type, 0, numIn-1)
+	for i := 0; i < numIn; i++ {
+		if i != pos {
+			in = append(in, fnType.In(i))
+		}
+	}
+	out := make([]reflect.Type, fnType.NumOut())
+	for i := range out {
+		out[i] = fnType.Out(i)
+	}
+
+	call := fn.Call
+	if variadic {
+		call = fn.CallSlice
+	}
+	return reflect.MakeFunc(reflect.FuncOf(in, out, variadic), func(args []reflect.Value) []reflect.Value {
+		full := make([]reflect.Value, len(args)+1)
+		copy(full, args[:pos])
+		full[pos] = argValue
+		copy(full[pos+1:], args[pos:])
+		return call(full)
+	})
+}
@@ -0,0 +1,35 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import "reflect"
+
+// Partial is the type-safe variant of [Bind1]: F is the type of the returned func, which must
+// match the signature of the func pointed to by fnPtr minus the bound argument.
+//
+//	getTenantUser := sqlfunc.Partial[func(ctx context.Context, tx *sql.Tx, userID int64) (string, error)](&getUser, tenantID)
+func Partial[F any](fnPtr interface{}, arg interface{}) F {
+	fn := reflect.ValueOf(Bind1(fnPtr, arg))
+	typ := reflect.TypeOf((*F)(nil)).Elem()
+	if !fn.Type().ConvertibleTo(typ) {
+		panic("bound func of type " + fn.Type().String() + " doesn't match " + typ.String())
+	}
+	return fn.Convert(typ).Interface().(F)
+}
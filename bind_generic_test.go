@@ -0,0 +1,84 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func ExamplePartial() {
+	check := func(msg string, err error) {
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", msg, err))
+		}
+	}
+
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	check("Open", err)
+	defer db.Close()
+
+	var getKey func(ctx context.Context, tenant string, id int) (string, error)
+	closeGetKey, err := sqlfunc.QueryRow(ctx, db, `SELECT ? || ':' || ?`, &getKey)
+	check("Prepare getKey", err)
+	defer closeGetKey()
+
+	getAcmeKey := sqlfunc.Partial[func(ctx context.Context, id int) (string, error)](&getKey, "acme")
+
+	key, err := getAcmeKey(ctx, 1)
+	check("getAcmeKey", err)
+	fmt.Println(key)
+
+	// Output:
+	// acme:1
+}
+
+func TestPartialMismatch(t *testing.T) {
+	getKey := func(ctx context.Context, tenant string, id int) (string, error) { return "", nil }
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("panic expected")
+		}
+	}()
+	sqlfunc.Partial[func(ctx context.Context, id string) (string, error)](&getKey, "acme")
+}
+
+func TestBind1Variadic(t *testing.T) {
+	join := func(ctx context.Context, sep string, parts ...string) (string, error) {
+		s := ""
+		for i, p := range parts {
+			if i > 0 {
+				s += sep
+			}
+			s += p
+		}
+		return s, nil
+	}
+	joinDash := sqlfunc.Partial[func(ctx context.Context, parts ...string) (string, error)](&join, "-")
+	if s, _ := joinDash(context.Background(), "a", "b", "c"); s != "a-b-c" {
+		t.Errorf("got %q", s)
+	}
+}
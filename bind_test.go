@@ -0,0 +1,61 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func ExampleBind1() {
+	check := func(msg string, err error) {
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", msg, err))
+		}
+	}
+
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	check("Open", err)
+	defer db.Close()
+
+	var getKey func(ctx context.Context, tx *sql.Tx, tenant string, id int) (string, error)
+	closeGetKey, err := sqlfunc.QueryRow(ctx, db, `SELECT ? || ':' || ?`, &getKey)
+	check("Prepare getKey", err)
+	defer closeGetKey()
+
+	getAcmeKey := sqlfunc.Bind1(&getKey, "acme").(func(ctx context.Context, tx *sql.Tx, id int) (string, error))
+
+	key, err := getAcmeKey(ctx, nil, 1)
+	check("getAcmeKey", err)
+	fmt.Println(key)
+
+	tx, err := db.BeginTx(ctx, nil)
+	check("BeginTx", err)
+	defer tx.Rollback()
+
+	key, err = getAcmeKey(ctx, tx, 2)
+	check("getAcmeKey with tx", err)
+	fmt.Println(key)
+
+	// Output:
+	// acme:1
+	// acme:2
+}
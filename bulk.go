@@ -0,0 +1,190 @@
+//go:build go1.23
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"reflect"
+	"strings"
+)
+
+var typeBulkInsert = reflect.TypeOf((func(context.Context, iter.Seq[[]any]) (int64, error))(nil))
+
+// maxBulkInsertBatch is the maximum number of rows inserted by a single INSERT statement by [BulkInsert].
+const maxBulkInsertBatch = 100
+
+// maxBulkInsertArgs is the maximum number of arguments of a single INSERT statement by [BulkInsert]
+// (the historical limit of SQLite).
+const maxBulkInsertArgs = 999
+
+// BulkInsert creates a function that inserts rows into table.
+//
+// fnPtr is a pointer to a func variable of type:
+//
+//	func(ctx context.Context, rows iter.Seq[[]any]) (int64, error)
+//
+// Each row must have one value per column. The function returns the number of inserted rows.
+//
+// If db is an [*sql.DB] or an [*sql.Conn] using the [github.com/lib/pq] driver, the rows are sent
+// with the Postgres COPY protocol (COPY table (columns...) FROM STDIN) in a transaction started
+// for each call, using the convention of that driver for COPY through [database/sql]: a prepared
+// statement that is executed once for each row, then once without arguments to flush the data.
+//
+// Otherwise the rows are inserted by batches with multi-rows INSERT statements
+// (INSERT INTO table (columns...) VALUES (...), (...)...). The statement for full batches is
+// prepared by BulkInsert. The statement for the last partial batch of a call is prepared on
+// first use for each distinct size and cached until close is called.
+// The placeholders are "$N" for Postgres drivers and "?" otherwise (see [WithDollarPlaceholders]).
+// Those statements are not executed in a transaction: use an [*sql.Tx] as db to get atomicity.
+// As the driver of a transaction can't be determined, give [WithDollarPlaceholders] for
+// Postgres drivers (COPY is then not used).
+//
+// table and columns are inserted in the queries as is: they must not come from untrusted input.
+//
+// The returned func 'close' must be called once the function is not needed anymore.
+func BulkInsert(ctx context.Context, db PrepareConn, table string, columns []string, fnPtr interface{}, opts ...Option) (close func() error, err error) {
+	vPtr := reflect.ValueOf(fnPtr)
+	if vPtr.Type().Kind() != reflect.Ptr {
+		panic("fnPtr must be a *pointer* to a func variable")
+	}
+	if vPtr.IsNil() {
+		panic("fnPtr must be non-nil")
+	}
+	if vPtr.Type().Elem() != typeBulkInsert {
+		panic("fnPtr must be a pointer to a func(context.Context, iter.Seq[[]any]) (int64, error) variable")
+	}
+	if len(columns) == 0 {
+		panic("columns must not be empty")
+	}
+
+	driver := driverPkgPath(db)
+	if driver == "github.com/lib/pq" {
+		if beginner, ok := db.(interface {
+			BeginTx(context.Context, *sql.TxOptions) (*sql.Tx, error)
+		}); ok {
+			query := "COPY " + table + " (" + strings.Join(columns, ", ") + ") FROM STDIN"
+			fn := func(ctx context.Context, rows iter.Seq[[]any]) (int64, error) {
+				return bulkCopy(ctx, beginner, query, len(columns), rows)
+			}
+			vPtr.Elem().Set(reflect.ValueOf(fn))
+			return func() error { return nil }, nil
+		}
+	}
+
+	b := &bulkInsert{
+		db:       db,
+		table:    table,
+		columns:  columns,
+		dollar:   newOptions(opts).dollarPlaceholders(db),
+		batchLen: min(maxBulkInsertBatch, max(1, maxBulkInsertArgs/len(columns))),
+		partial:  make(map[int]*sql.Stmt),
+	}
+	b.stmt, err = db.PrepareContext(ctx, b.query(b.batchLen))
+	if err != nil {
+		return func() error { return nil }, err
+	}
+	vPtr.Elem().Set(reflect.ValueOf(b.insert))
+	return b.close, nil
+}
+
+func bulkCopy(ctx context.Context, db interface {
+	BeginTx(context.Context, *sql.TxOptions) (*sql.Tx, error)
+}, query string, numColumns int, rows iter.Seq[[]any]) (n int64, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for row := range rows {
+		if len(row) != numColumns {
+			return 0, fmt.Errorf("sqlfunc: row %d has %d values, expected %d", n+1, len(row), numColumns)
+		}
+		if _, err = stmt.ExecContext(ctx, row...); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	// Flush
+	res, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if count, e := res.RowsAffected(); e == nil && count > 0 {
+		n = count
+	}
+	if err = stmt.Close(); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func (b *bulkInsert) insert(ctx context.Context, rows iter.Seq[[]any]) (n int64, err error) {
+	numColumns := len(b.columns)
+	args := make([]any, 0, b.batchLen*numColumns)
+	exec := func(stmt *sql.Stmt) error {
+		res, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return err
+		}
+		count, err := res.RowsAffected()
+		if err != nil {
+			count = int64(len(args) / numColumns)
+		}
+		n += count
+		args = args[:0]
+		return nil
+	}
+
+	var nbRows int
+	for row := range rows {
+		nbRows++
+		if len(row) != numColumns {
+			return n, fmt.Errorf("sqlfunc: row %d has %d values, expected %d", nbRows, len(row), numColumns)
+		}
+		args = append(args, row...)
+		if len(args) == cap(args) {
+			if err = exec(b.stmt); err != nil {
+				return
+			}
+		}
+	}
+	if len(args) == 0 {
+		return
+	}
+
+	// Last partial batch
+	stmt, err := b.partialStmt(ctx, len(args)/numColumns)
+	if err != nil {
+		return
+	}
+	err = exec(stmt)
+	return
+}
@@ -0,0 +1,177 @@
+//go:build go1.23
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+	"strings"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func ExampleBulkInsert() {
+	check := func(msg string, err error) {
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", msg, err))
+		}
+	}
+
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	check("Open", err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE poi (lat DECIMAL, lon DECIMAL, name VARCHAR(255))`)
+	check("Create table", err)
+
+	var insertPOIs func(ctx context.Context, rows iter.Seq[[]any]) (int64, error)
+	closeInsertPOIs, err := sqlfunc.BulkInsert(ctx, db, "poi", []string{"lat", "lon", "name"}, &insertPOIs)
+	check("Prepare insertPOIs", err)
+	defer closeInsertPOIs()
+
+	pois := [][]any{
+		{48.8016, 2.1204, "Château de Versailles"},
+		{47.2009, 0.6317, "Villeperdue"},
+	}
+	n, err := insertPOIs(ctx, func(yield func([]any) bool) {
+		for _, poi := range pois {
+			if !yield(poi) {
+				return
+			}
+		}
+	})
+	check("insertPOIs", err)
+	fmt.Println("Inserted:", n)
+
+	// Output:
+	// Inserted: 2
+}
+
+func TestBulkInsert(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE t (a INTEGER, b TEXT)`); err != nil {
+		t.Fatalf("Create table: %v", err)
+	}
+
+	var insert func(ctx context.Context, rows iter.Seq[[]any]) (int64, error)
+	close, err := sqlfunc.BulkInsert(ctx, db, "t", []string{"a", "b"}, &insert)
+	if err != nil {
+		t.Fatalf("BulkInsert: %v", err)
+	}
+	defer close()
+
+	series := func(count int) iter.Seq[[]any] {
+		return func(yield func([]any) bool) {
+			for i := 0; i < count; i++ {
+				if !yield([]any{i, fmt.Sprint("row", i)}) {
+					return
+				}
+			}
+		}
+	}
+
+	var total int64
+	for _, count := range []int{0, 1, 100, 250} {
+		n, err := insert(ctx, series(count))
+		if err != nil {
+			t.Fatalf("insert %d: %v", count, err)
+		}
+		if n != int64(count) {
+			t.Errorf("insert %d: got %d", count, n)
+		}
+		total += n
+	}
+
+	var inDB int64
+	if err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM t`).Scan(&inDB); err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if inDB != total {
+		t.Errorf("got %d rows in table, expected %d", inDB, total)
+	}
+
+	_, err = insert(ctx, func(yield func([]any) bool) {
+		yield([]any{1})
+	})
+	if err == nil {
+		t.Error("error expected for invalid row")
+	}
+}
+
+func TestBulkInsertTx(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE t (a INTEGER, b TEXT)`); err != nil {
+		t.Fatalf("Create table: %v", err)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	defer tx.Rollback()
+
+	// The driver of a transaction is unknown: the placeholder style is given
+	conn := &queriesConn{PrepareConn: tx}
+	var insert func(ctx context.Context, rows iter.Seq[[]any]) (int64, error)
+	close, err := sqlfunc.BulkInsert(ctx, conn, "t", []string{"a", "b"}, &insert, sqlfunc.WithDollarPlaceholders())
+	if err != nil {
+		t.Fatalf("BulkInsert: %v", err)
+	}
+	defer close()
+
+	rows := func(yield func([]any) bool) {
+		for i := 0; i < 150; i++ {
+			if !yield([]any{i, fmt.Sprint("row", i)}) {
+				return
+			}
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if n, err := insert(ctx, rows); err != nil || n != 150 {
+			t.Fatalf("insert: got %d, %v", n, err)
+		}
+	}
+	// The statement of the last partial batch is prepared once
+	if len(conn.queries) != 2 {
+		t.Errorf("got %d statements prepared, expected 2", len(conn.queries))
+	}
+	for _, q := range conn.queries {
+		if !strings.HasSuffix(q, "($99, $100)") && !strings.HasSuffix(q, "($199, $200)") {
+			t.Errorf("unexpected query: ...%s", q[len(q)-20:])
+		}
+	}
+}
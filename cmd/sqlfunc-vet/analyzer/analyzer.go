@@ -0,0 +1,346 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package analyzer provides an [analysis.Analyzer] that checks the signatures of the funcs
+// given to the functions of package [github.com/dolmen-go/sqlfunc].
+//
+// The sqlfunc functions validate the signatures at runtime and panic on invalid signatures.
+// The analyzer reports those errors at compile time.
+package analyzer
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+const pkgPath = "github.com/dolmen-go/sqlfunc"
+
+// Analyzer reports the calls of [github.com/dolmen-go/sqlfunc] functions (Exec, QueryRow,
+// QueryRowLazy, Query, Scan, ForEach, ForEachBuf, ForEachContext, the methods of Group and the generic
+// Prepare* functions) with a func signature that would make them panic at runtime.
+var Analyzer = &analysis.Analyzer{
+	Name:     "sqlfunc",
+	Doc:      "check the signatures of the funcs given to github.com/dolmen-go/sqlfunc",
+	URL:      "https://pkg.go.dev/github.com/dolmen-go/sqlfunc/cmd/sqlfunc-vet/analyzer",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// checkFunc returns the runtime panic message for an invalid signature, or "".
+type checkFunc func(sig *types.Signature) string
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	insp := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	insp.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		call := n.(*ast.CallExpr)
+		fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+		if !ok || fn.Pkg() == nil || fn.Pkg().Path() != pkgPath {
+			return
+		}
+		name := fn.Name()
+		offset := 0 // for the methods of Group, which have no db argument
+		if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+			ptr, ok := recv.Type().(*types.Pointer)
+			if !ok {
+				return
+			}
+			if named, ok := ptr.Elem().(*types.Named); !ok || named.Obj().Name() != "Group" {
+				return
+			}
+			name = "Group." + name
+			offset = -1
+		}
+
+		switch name {
+		case "Exec", "Group.Exec":
+			checkFnPtr(pass, call, 3+offset, name, checkExec)
+		case "QueryRow", "Group.QueryRow":
+			checkFnPtr(pass, call, 3+offset, name, checkQueryRow)
+		case "QueryRowLazy":
+			checkFnPtr(pass, call, 3, name, checkQueryRowLazy)
+		case "Query", "Group.Query":
+			checkFnPtr(pass, call, 3+offset, name, checkQuery)
+		case "Scan":
+			checkFnPtr(pass, call, 0, name, checkScan)
+		case "GroupExec":
+			checkFnPtr(pass, call, 1, name, checkExec)
+		case "GroupQueryRow":
+			checkFnPtr(pass, call, 1, name, checkQueryRow)
+		case "GroupQuery":
+			checkFnPtr(pass, call, 1, name, checkQuery)
+		case "ForEach":
+			checkCallback(pass, call, 1, name, checkForEach)
+		case "ForEachBuf":
+			checkCallback(pass, call, 1, name, checkForEachBuf)
+		case "ForEachContext":
+			checkCallback(pass, call, 2, name, checkForEach)
+		case "PrepareExec":
+			checkTypeArg(pass, call, name, checkExec)
+		case "PrepareQueryRow":
+			checkTypeArg(pass, call, name, checkQueryRow)
+		case "PrepareQuery":
+			checkTypeArg(pass, call, name, checkQuery)
+		}
+	})
+	return nil, nil
+}
+
+// checkFnPtr checks the argument i of call, which must be a pointer to a func variable.
+func checkFnPtr(pass *analysis.Pass, call *ast.CallExpr, i int, name string, check checkFunc) {
+	if i >= len(call.Args) {
+		return
+	}
+	arg := call.Args[i]
+	t := pass.TypesInfo.TypeOf(arg)
+	if t == nil {
+		return
+	}
+	if _, isInterface := t.Underlying().(*types.Interface); isInterface {
+		return // Unknown at compile time
+	}
+	ptr, ok := t.Underlying().(*types.Pointer)
+	if !ok {
+		pass.Reportf(arg.Pos(), "sqlfunc.%s: fnPtr must be a *pointer* to a func variable", name)
+		return
+	}
+	sig, ok := ptr.Elem().Underlying().(*types.Signature)
+	if !ok {
+		pass.Reportf(arg.Pos(), "sqlfunc.%s: fnPtr must be a pointer to a *func* variable", name)
+		return
+	}
+	if msg := check(sig); msg != "" {
+		pass.Reportf(arg.Pos(), "sqlfunc.%s: %s", name, msg)
+	}
+}
+
+// checkTypeArg checks the func type given as type argument to a generic function.
+func checkTypeArg(pass *analysis.Pass, call *ast.CallExpr, name string, check checkFunc) {
+	var id *ast.Ident
+	switch fun := ast.Unparen(call.Fun).(type) {
+	case *ast.IndexExpr:
+		id = calleeIdent(fun.X)
+	case *ast.IndexListExpr:
+		id = calleeIdent(fun.X)
+	default:
+		id = calleeIdent(fun)
+	}
+	if id == nil {
+		return
+	}
+	inst, ok := pass.TypesInfo.Instances[id]
+	if !ok || inst.TypeArgs.Len() != 1 {
+		return
+	}
+	sig, ok := inst.TypeArgs.At(0).Underlying().(*types.Signature)
+	if !ok {
+		return // Rejected by the type constraint
+	}
+	if msg := check(sig); msg != "" {
+		pass.Reportf(call.Pos(), "sqlfunc.%s: %s", name, msg)
+	}
+}
+
+func calleeIdent(e ast.Expr) *ast.Ident {
+	switch e := ast.Unparen(e).(type) {
+	case *ast.Ident:
+		return e
+	case *ast.SelectorExpr:
+		return e.Sel
+	}
+	return nil
+}
+
+// checkCallback checks the argument i of call, which must be a callback for ForEach.
+func checkCallback(pass *analysis.Pass, call *ast.CallExpr, i int, name string, check checkFunc) {
+	if i >= len(call.Args) {
+		return
+	}
+	arg := call.Args[i]
+	t := pass.TypesInfo.TypeOf(arg)
+	if t == nil {
+		return
+	}
+	if _, isInterface := t.Underlying().(*types.Interface); isInterface {
+		return // Unknown at compile time
+	}
+	sig, ok := t.Underlying().(*types.Signature)
+	if !ok {
+		pass.Reportf(arg.Pos(), "sqlfunc.%s: callback must be a func", name)
+		return
+	}
+	if msg := check(sig); msg != "" {
+		pass.Reportf(arg.Pos(), "sqlfunc.%s: %s", name, msg)
+	}
+}
+
+func checkExec(sig *types.Signature) string {
+	if msg := checkContextArg(sig); msg != "" {
+		return msg
+	}
+	res := sig.Results()
+	if res.Len() != 2 || !isError(res.At(1).Type()) ||
+		!(isNamed(res.At(0).Type(), "database/sql", "Result") || isInteger(res.At(0).Type()) || isString(res.At(0).Type())) {
+		return "func must return (sql.Result, error), (int64, error) or (string, error)"
+	}
+	return ""
+}
+
+func checkQueryRow(sig *types.Signature) string {
+	if msg := checkContextArg(sig); msg != "" {
+		return msg
+	}
+	res := sig.Results()
+	if res.Len() < 2 {
+		return "func must return at least one column"
+	}
+	if !isError(res.At(res.Len() - 1).Type()) {
+		return "func must return an error"
+	}
+	return ""
+}
+
+func checkQueryRowLazy(sig *types.Signature) string {
+	if msg := checkContextArg(sig); msg != "" {
+		return msg
+	}
+	res := sig.Results()
+	if res.Len() != 2 || !isError(res.At(1).Type()) || !isScanFunc(res.At(0).Type()) {
+		return "func must return (func(...interface{}) error, error)"
+	}
+	return ""
+}
+
+func checkQuery(sig *types.Signature) string {
+	if msg := checkContextArg(sig); msg != "" {
+		return msg
+	}
+	res := sig.Results()
+	n := res.Len()
+	if (n != 2 && n != 3) || !isRows(res.At(0).Type()) || !isError(res.At(n-1).Type()) ||
+		(n == 3 && !isStopFunc(res.At(1).Type()) && !isStrings(res.At(1).Type())) {
+		return "func must return (*sql.Rows, error), (*sql.Rows, func(), error) or (*sql.Rows, []string, error)"
+	}
+	return ""
+}
+
+func checkScan(sig *types.Signature) string {
+	params, res := sig.Params(), sig.Results()
+	if params.Len() < 1 || !isRows(params.At(0).Type()) {
+		return "func first arg must be an *sql.Rows"
+	}
+	if res.Len() < 1 || !isError(res.At(res.Len()-1).Type()) {
+		return "func must return error as last value"
+	}
+	if (params.Len() == 1) == (res.Len() == 1) {
+		return "func must either take scanners as arguments or return values"
+	}
+	return ""
+}
+
+func checkForEach(sig *types.Signature) string {
+	params := sig.Params()
+	if params.Len() == 0 {
+		return "callback must accept at least one argument"
+	}
+	if params.Len() == 1 && isBuffer(params.At(0).Type()) {
+		return "callback must accept at least one argument after the *bytes.Buffer"
+	}
+	res := sig.Results()
+	switch res.Len() {
+	case 0:
+		return ""
+	case 1:
+		if isBool(res.At(0).Type()) || isError(res.At(0).Type()) {
+			return ""
+		}
+	case 2:
+		if isBool(res.At(0).Type()) && isError(res.At(1).Type()) {
+			return ""
+		}
+	}
+	return "callback may only return an error, a bool, or (bool, error)"
+}
+
+func checkForEachBuf(sig *types.Signature) string {
+	if sig.Params().Len() == 0 || !isBuffer(sig.Params().At(0).Type()) {
+		return "callback must be a func with a first *bytes.Buffer argument"
+	}
+	return checkForEach(sig)
+}
+
+func checkContextArg(sig *types.Signature) string {
+	if sig.Params().Len() < 1 || !isNamed(sig.Params().At(0).Type(), "context", "Context") {
+		return "func first arg must be a context.Context"
+	}
+	return ""
+}
+
+func isNamed(t types.Type, pkg, name string) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == pkg && obj.Name() == name
+}
+
+func isRows(t types.Type) bool {
+	ptr, ok := types.Unalias(t).(*types.Pointer)
+	return ok && isNamed(ptr.Elem(), "database/sql", "Rows")
+}
+
+func isBuffer(t types.Type) bool {
+	ptr, ok := types.Unalias(t).(*types.Pointer)
+	return ok && isNamed(ptr.Elem(), "bytes", "Buffer")
+}
+
+func isError(t types.Type) bool {
+	return types.Identical(t, types.Universe.Lookup("error").Type())
+}
+
+func isBool(t types.Type) bool {
+	return types.Identical(t, types.Typ[types.Bool])
+}
+
+func isInteger(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsInteger != 0 && b.Kind() != types.Uintptr
+}
+
+func isString(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsString != 0
+}
+
+func isStopFunc(t types.Type) bool {
+	return types.Identical(t, types.NewSignatureType(nil, nil, nil, nil, nil, false))
+}
+
+func isStrings(t types.Type) bool {
+	return types.Identical(t, types.NewSlice(types.Typ[types.String]))
+}
+
+func isScanFunc(t types.Type) bool {
+	any := types.NewInterfaceType(nil, nil)
+	params := types.NewTuple(types.NewVar(0, nil, "", types.NewSlice(any)))
+	results := types.NewTuple(types.NewVar(0, nil, "", types.Universe.Lookup("error").Type()))
+	return types.Identical(t, types.NewSignatureType(nil, nil, nil, params, results, true))
+}
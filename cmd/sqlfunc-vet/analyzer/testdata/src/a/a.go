@@ -0,0 +1,92 @@
+package a
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+type Count int64
+
+func execs(ctx context.Context, db *sql.DB, tx *sql.Tx) {
+	var ok func(context.Context, string) (sql.Result, error)
+	sqlfunc.Exec(ctx, db, "", &ok)
+
+	var okTx func(context.Context, *sql.Tx, string) (Count, error)
+	sqlfunc.Exec(ctx, db, "", &okTx)
+
+	var noCtx func(string) (sql.Result, error)
+	sqlfunc.Exec(ctx, db, "", &noCtx) // want `sqlfunc.Exec: func first arg must be a context.Context`
+
+	var badResult func(context.Context) (bool, error)
+	sqlfunc.Exec(ctx, db, "", &badResult) // want `sqlfunc.Exec: func must return \(sql.Result, error\), \(int64, error\) or \(string, error\)`
+
+	sqlfunc.Exec(ctx, db, "", ok) // want `sqlfunc.Exec: fnPtr must be a \*pointer\* to a func variable`
+
+	var notFunc int
+	sqlfunc.Exec(ctx, db, "", &notFunc) // want `sqlfunc.Exec: fnPtr must be a pointer to a \*func\* variable`
+
+	var unknown interface{} = &ok
+	sqlfunc.Exec(ctx, db, "", unknown)
+
+	_, _ = sqlfunc.PrepareExec[func(context.Context, int) (sql.Result, error)](ctx, db, "")
+	_, _ = sqlfunc.PrepareExec[func(int) (sql.Result, error)](ctx, db, "") // want `sqlfunc.PrepareExec: func first arg must be a context.Context`
+
+	sqlfunc.GroupExec("", &badResult) // want `sqlfunc.GroupExec: func must return`
+}
+
+func queries(ctx context.Context, db *sql.DB, g *sqlfunc.Group) {
+	var row func(context.Context, int) (string, int, error)
+	sqlfunc.QueryRow(ctx, db, "", &row)
+	g.QueryRow(ctx, "", &row)
+
+	var noColumn func(context.Context) error
+	sqlfunc.QueryRow(ctx, db, "", &noColumn) // want `sqlfunc.QueryRow: func must return at least one column`
+	g.QueryRow(ctx, "", &noColumn)           // want `sqlfunc.Group.QueryRow: func must return at least one column`
+
+	var noError func(context.Context) (string, int)
+	sqlfunc.QueryRow(ctx, db, "", &noError) // want `sqlfunc.QueryRow: func must return an error`
+
+	var lazy func(context.Context, int) (func(...interface{}) error, error)
+	sqlfunc.QueryRowLazy(ctx, db, "", &lazy)
+	sqlfunc.QueryRowLazy(ctx, db, "", &row) // want `sqlfunc.QueryRowLazy: func must return \(func\(...interface\{\}\) error, error\)`
+
+	var rows func(context.Context) (*sql.Rows, error)
+	sqlfunc.Query(ctx, db, "", &rows)
+	var rowsStop func(context.Context) (*sql.Rows, func(), error)
+	sqlfunc.Query(ctx, db, "", &rowsStop)
+	var rowsColumns func(context.Context) (*sql.Rows, []string, error)
+	sqlfunc.Query(ctx, db, "", &rowsColumns)
+	g.Query(ctx, "", &row) // want `sqlfunc.Group.Query: func must return \(\*sql.Rows, error\), \(\*sql.Rows, func\(\), error\) or \(\*sql.Rows, \[\]string, error\)`
+}
+
+func scans(ctx context.Context, rows *sql.Rows) {
+	var scanArgs func(*sql.Rows, *string, *int) error
+	sqlfunc.Scan(&scanArgs)
+	var scanValues func(*sql.Rows) (string, int, error)
+	sqlfunc.Scan(&scanValues)
+
+	var noRows func(*string) error
+	sqlfunc.Scan(&noRows) // want `sqlfunc.Scan: func first arg must be an \*sql.Rows`
+	var noError func(*sql.Rows, *string) string
+	sqlfunc.Scan(&noError) // want `sqlfunc.Scan: func must return error as last value`
+	var both func(*sql.Rows, *string) (int, error)
+	sqlfunc.Scan(&both) // want `sqlfunc.Scan: func must either take scanners as arguments or return values`
+
+	sqlfunc.ForEach(rows, func(s string, n int) {})
+	sqlfunc.ForEach(rows, func(s string) bool { return true })
+	sqlfunc.ForEach(rows, func(s string) (bool, error) { return true, nil })
+	sqlfunc.ForEach(rows, func() error { return nil })                    // want `sqlfunc.ForEach: callback must accept at least one argument`
+	sqlfunc.ForEach(rows, func(s string) int { return 0 })                // want `sqlfunc.ForEach: callback may only return an error, a bool, or \(bool, error\)`
+	sqlfunc.ForEachContext(ctx, rows, func(s string) string { return s }) // want `sqlfunc.ForEachContext: callback may only return`
+	sqlfunc.ForEach(rows, 42)                                             // want `sqlfunc.ForEach: callback must be a func`
+	sqlfunc.ForEach(rows, func(buf *bytes.Buffer) {})                     // want `sqlfunc.ForEach: callback must accept at least one argument after the \*bytes.Buffer`
+
+	sqlfunc.ForEachBuf(rows, func(buf *bytes.Buffer, s string) error { return nil })
+	sqlfunc.ForEachBuf(rows, func(s string) error { return nil })                // want `sqlfunc.ForEachBuf: callback must be a func with a first \*bytes.Buffer argument`
+	sqlfunc.ForEachBuf(rows, func(buf *bytes.Buffer) error { return nil })       // want `sqlfunc.ForEachBuf: callback must accept at least one argument after the \*bytes.Buffer`
+	sqlfunc.ForEachBuf(rows, func(buf *bytes.Buffer, s string) int { return 0 }) // want `sqlfunc.ForEachBuf: callback may only return`
+	sqlfunc.ForEachBuf(rows, 42)                                                 // want `sqlfunc.ForEachBuf: callback must be a func`
+}
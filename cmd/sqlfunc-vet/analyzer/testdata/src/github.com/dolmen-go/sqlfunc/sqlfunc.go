@@ -0,0 +1,63 @@
+// Package sqlfunc is a stub of github.com/dolmen-go/sqlfunc for the tests of the analyzer.
+package sqlfunc
+
+import (
+	"context"
+	"database/sql"
+)
+
+type Option func()
+
+type PrepareConn interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+func Exec(ctx context.Context, db PrepareConn, query string, fnPtr interface{}, opts ...Option) (close func() error, err error) {
+	return nil, nil
+}
+
+func QueryRow(ctx context.Context, db PrepareConn, query string, fnPtr interface{}, opts ...Option) (close func() error, err error) {
+	return nil, nil
+}
+
+func QueryRowLazy(ctx context.Context, db PrepareConn, query string, fnPtr interface{}, opts ...Option) (close func() error, err error) {
+	return nil, nil
+}
+
+func Query(ctx context.Context, db PrepareConn, query string, fnPtr interface{}, opts ...Option) (close func() error, err error) {
+	return nil, nil
+}
+
+func Scan(fnPtr interface{}, opts ...Option) {}
+
+func ForEach(rows *sql.Rows, callback interface{}, opts ...Option) error { return nil }
+
+func ForEachBuf(rows *sql.Rows, callback interface{}, opts ...Option) error { return nil }
+
+func ForEachContext(ctx context.Context, rows *sql.Rows, callback interface{}, opts ...Option) (processed int, err error) {
+	return 0, nil
+}
+
+type Group struct{}
+
+func (g *Group) Exec(ctx context.Context, query string, fnPtr interface{}, opts ...Option) error {
+	return nil
+}
+
+func (g *Group) QueryRow(ctx context.Context, query string, fnPtr interface{}, opts ...Option) error {
+	return nil
+}
+
+func (g *Group) Query(ctx context.Context, query string, fnPtr interface{}, opts ...Option) error {
+	return nil
+}
+
+type GroupStmt struct{}
+
+func GroupExec(query string, fnPtr interface{}, opts ...Option) GroupStmt { return GroupStmt{} }
+
+type Stmt[F any] struct{ Do F }
+
+func PrepareExec[F any](ctx context.Context, db PrepareConn, query string, opts ...Option) (Stmt[F], error) {
+	return Stmt[F]{}, nil
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command sqlfunc-vet checks the signatures of the funcs given to the functions of
+// package [github.com/dolmen-go/sqlfunc], reporting at compile time the errors that
+// would make them panic at runtime.
+//
+// Usage:
+//
+//	go install github.com/dolmen-go/sqlfunc/cmd/sqlfunc-vet@latest
+//	go vet -vettool=$(which sqlfunc-vet) ./...
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/singlechecker"
+
+	"github.com/dolmen-go/sqlfunc/cmd/sqlfunc-vet/analyzer"
+)
+
+func main() {
+	singlechecker.Main(analyzer.Analyzer)
+}
@@ -0,0 +1,382 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Converter defines how column values are scanned into a Go type.
+//
+// Converters are registered with [RegisterConverter].
+type Converter struct {
+	// Scan stores src, a column value as returned by the driver
+	// (see [database/sql.Scanner] for the possible types), into dest which is
+	// a pointer to a value of the registered type.
+	Scan func(dest interface{}, src interface{}) error
+
+	// Value converts v, an argument of the registered type, into a value
+	// for the driver. Optional.
+	Value func(v interface{}) (driver.Value, error)
+}
+
+var converters struct {
+	m sync.Mutex   // serializes writers
+	v atomic.Value // map[reflect.Type]*Converter, copied on write
+}
+
+func init() {
+	RegisterConverter(typeBool, Converter{Scan: scanBool})
+	RegisterConverter(reflect.PtrTo(typeBool), Converter{Scan: scanNullBool})
+	RegisterConverter(reflect.TypeOf((*big.Int)(nil)), Converter{Scan: scanBigInt, Value: valueBigInt})
+}
+
+// RegisterConverter registers the conversion of column values into destinations of type typ.
+//
+// The Scan conversion is used for every destination of type typ in [Scan], [QueryRow] and [ForEach],
+// and takes precedence over the [database/sql.Scanner] implementation of the type, if any.
+// The Value conversion is used for every argument of type typ given to the functions
+// created by [Exec], [QueryRow] and [Query], and takes precedence over the
+// [database/sql/driver.Valuer] implementation of the type, if any.
+// Registering a converter with neither Scan nor Value removes the conversions for typ.
+//
+// A converter for bool is registered by default: it accepts booleans, the integers 0 and 1
+// (SQLite stores booleans as integers) and the text representations accepted by [strconv.ParseBool].
+// The converter for *bool accepts the same values, and maps NULL to nil.
+//
+// Converters for *[math/big.Int] and [net/netip.Addr] are also registered by default: they
+// scan from and bind to the text representation of the value, and map NULL to the zero value.
+func RegisterConverter(typ reflect.Type, c Converter) {
+	converters.m.Lock()
+	defer converters.m.Unlock()
+	old, _ := converters.v.Load().(map[reflect.Type]*Converter)
+	m := make(map[reflect.Type]*Converter, len(old)+1)
+	for t, c := range old {
+		m[t] = c
+	}
+	if c.Scan == nil && c.Value == nil {
+		delete(m, typ)
+	} else {
+		m[typ] = &c
+	}
+	converters.v.Store(m)
+}
+
+func converterFor(typ reflect.Type) *Converter {
+	m, _ := converters.v.Load().(map[reflect.Type]*Converter)
+	return m[typ]
+}
+
+// convertScanner is an [database/sql.Scanner] that delegates to a [Converter].
+type convertScanner struct {
+	dest interface{}
+	scan func(dest interface{}, src interface{}) error
+}
+
+func (s *convertScanner) Scan(src interface{}) error {
+	return s.scan(s.dest, src)
+}
+
+// TextScanner is implemented by types that are scanned from the text of a column, such as
+// enums stored as their names. It avoids implementing [database/sql.Scanner] for each type.
+//
+// ScanText is called by [Scan], [QueryRow] and [ForEach] with the column value converted to
+// a string. A NULL column is an error, unless [WithNullAsZero] is used.
+//
+// A [Converter] registered for the type takes precedence over TextScanner, and TextScanner is
+// ignored if the type also implements [database/sql.Scanner].
+//
+// Types implementing [encoding.TextUnmarshaler] are scanned the same way with UnmarshalText,
+// with the same precedence, except [time.Time] and the types already handled by [database/sql]
+// (of kind bool, integer, float, string or []byte, such as [net.IP]) which are scanned by
+// [database/sql]. TextScanner takes precedence over UnmarshalText.
+// Symmetrically, arguments implementing [encoding.TextMarshaler] are given to the driver as
+// the string returned by MarshalText, unless they have a registered [Converter], implement
+// [database/sql/driver.Valuer], are a [time.Time] or are of a kind accepted by
+// [database/sql/driver.DefaultParameterConverter] (bool, integer, float, string or []byte).
+type TextScanner interface {
+	ScanText(string) error
+}
+
+// textScanner is an [database/sql.Scanner] that delegates to a [TextScanner] or an
+// [encoding.TextUnmarshaler].
+type textScanner struct {
+	dest interface{}
+}
+
+func (s *textScanner) Scan(src interface{}) error {
+	var ns sql.NullString
+	if err := ns.Scan(src); err != nil {
+		return err
+	}
+	if !ns.Valid {
+		return fmt.Errorf("sqlfunc: converting NULL to %T is unsupported", s.dest)
+	}
+	if ts, ok := s.dest.(TextScanner); ok {
+		return ts.ScanText(ns.String)
+	}
+	return s.dest.(encoding.TextUnmarshaler).UnmarshalText([]byte(ns.String))
+}
+
+// isTextDest reports whether destinations of type ptrType (a pointer type) are scanned
+// by [textScanner].
+func isTextDest(ptrType reflect.Type) bool {
+	return ptrType.Implements(typeTextScanner) ||
+		ptrType.Implements(typeTextUnmarshal) && ptrType != typeTimePtr && !isNativeKind(ptrType.Elem())
+}
+
+// locationScanner converts the time scanned into dest, a *time.Time or a **time.Time,
+// to a location (see [WithLocation]).
+type locationScanner struct {
+	dest  interface{}
+	inner interface{} // the scanner for dest, without conversion
+	loc   *time.Location
+}
+
+func (s *locationScanner) Scan(src interface{}) error {
+	if sc, ok := s.inner.(sql.Scanner); ok {
+		if err := sc.Scan(src); err != nil {
+			return err
+		}
+	} else {
+		var t sql.NullTime
+		if err := t.Scan(src); err != nil {
+			return err
+		}
+		switch dest := s.dest.(type) {
+		case *time.Time:
+			if !t.Valid {
+				return errors.New("converting NULL to time.Time is unsupported")
+			}
+			*dest = t.Time
+		case **time.Time:
+			if !t.Valid {
+				*dest = nil
+				return nil
+			}
+			*dest = &t.Time
+		}
+	}
+	switch dest := s.dest.(type) {
+	case *time.Time:
+		*dest = dest.In(s.loc)
+	case **time.Time:
+		if *dest != nil {
+			t := (*dest).In(s.loc)
+			*dest = &t
+		}
+	}
+	return nil
+}
+
+// nullZeroScanner stores the zero value (see [WithNullAsZero]), or a default value
+// (see [WithNullDefault]), into dest on NULL.
+type nullZeroScanner struct {
+	dest  reflect.Value // the pointer to fill
+	inner interface{}   // the scanner for dest
+	null  reflect.Value // the value stored on NULL, if valid (the zero value otherwise)
+}
+
+func (s *nullZeroScanner) Scan(src interface{}) error {
+	v := s.dest.Elem()
+	if src == nil {
+		if s.null.IsValid() {
+			v.Set(s.null)
+		} else {
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+	if sc, ok := s.inner.(sql.Scanner); ok {
+		return sc.Scan(src)
+	}
+	// Use the sql.Null* types for the conversion rules of database/sql
+	switch v.Kind() {
+	case reflect.String:
+		var ns sql.NullString
+		if err := ns.Scan(src); err != nil {
+			return err
+		}
+		v.SetString(ns.String)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var ni sql.NullInt64
+		if err := ni.Scan(src); err != nil {
+			return err
+		}
+		if v.OverflowInt(ni.Int64) {
+			return fmt.Errorf("sqlfunc: converting %d to %v: value out of range", ni.Int64, v.Type())
+		}
+		v.SetInt(ni.Int64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var ns sql.NullString
+		if err := ns.Scan(src); err != nil {
+			return err
+		}
+		u, err := strconv.ParseUint(ns.String, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("sqlfunc: converting %q to %v: %w", ns.String, v.Type(), err)
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var nf sql.NullFloat64
+		if err := nf.Scan(src); err != nil {
+			return err
+		}
+		v.SetFloat(nf.Float64)
+	case reflect.Bool:
+		var nb sql.NullBool
+		if err := nb.Scan(src); err != nil {
+			return err
+		}
+		v.SetBool(nb.Bool)
+	default: // time.Time
+		var nt sql.NullTime
+		if err := nt.Scan(src); err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(nt.Time))
+	}
+	return nil
+}
+
+// nonNullable reports whether destinations of type t can't hold NULL and are handled by
+// [nullZeroScanner].
+func nonNullable(t reflect.Type) bool {
+	if t == typeTime {
+		return true
+	}
+	if reflect.PtrTo(t).Implements(typeScanner) {
+		return false // handles NULL itself
+	}
+	if isTextDest(reflect.PtrTo(t)) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// scanner returns the value to give to [database/sql.Rows.Scan] to fill ptr,
+// applying the registered converter for the type pointed to.
+func scanner(ptr reflect.Value) interface{} {
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return ptr.Interface()
+	}
+	if c := converterFor(ptr.Type().Elem()); c != nil && c.Scan != nil {
+		return &convertScanner{dest: ptr.Interface(), scan: c.Scan}
+	}
+	if isTextDest(ptr.Type()) && !ptr.Type().Implements(typeScanner) {
+		return &textScanner{dest: ptr.Interface()}
+	}
+	return ptr.Interface()
+}
+
+func scanBool(dest interface{}, src interface{}) error {
+	var b bool
+	switch src := src.(type) {
+	case bool:
+		b = src
+	case int64:
+		switch src {
+		case 0:
+		case 1:
+			b = true
+		default:
+			return fmt.Errorf("sqlfunc: converting int64 %d to bool: must be 0 or 1", src)
+		}
+	case string:
+		var err error
+		if b, err = strconv.ParseBool(src); err != nil {
+			return fmt.Errorf("sqlfunc: converting %q to bool: %w", src, err)
+		}
+	case []byte:
+		var err error
+		if b, err = strconv.ParseBool(string(src)); err != nil {
+			return fmt.Errorf("sqlfunc: converting %q to bool: %w", src, err)
+		}
+	case nil:
+		return fmt.Errorf("sqlfunc: converting NULL to bool is unsupported")
+	default:
+		// Fallback to the conversion rules of database/sql
+		v, err := driver.Bool.ConvertValue(src)
+		if err != nil {
+			return fmt.Errorf("sqlfunc: converting %T to bool: %w", src, err)
+		}
+		b = v.(bool)
+	}
+	*dest.(*bool) = b
+	return nil
+}
+
+// scanNullBool is like scanBool for a *bool, nil for NULL.
+func scanNullBool(dest interface{}, src interface{}) error {
+	if src == nil {
+		*dest.(**bool) = nil
+		return nil
+	}
+	var b bool
+	if err := scanBool(&b, src); err != nil {
+		return err
+	}
+	*dest.(**bool) = &b
+	return nil
+}
+
+func scanBigInt(dest interface{}, src interface{}) error {
+	var n *big.Int
+	switch src := src.(type) {
+	case nil:
+	case int64:
+		n = big.NewInt(src)
+	case string:
+		var ok bool
+		if n, ok = new(big.Int).SetString(src, 10); !ok {
+			return fmt.Errorf("sqlfunc: converting %q to *big.Int: invalid integer", src)
+		}
+	case []byte:
+		var ok bool
+		if n, ok = new(big.Int).SetString(string(src), 10); !ok {
+			return fmt.Errorf("sqlfunc: converting %q to *big.Int: invalid integer", src)
+		}
+	default:
+		return fmt.Errorf("sqlfunc: converting %T to *big.Int is unsupported", src)
+	}
+	*dest.(**big.Int) = n
+	return nil
+}
+
+func valueBigInt(v interface{}) (driver.Value, error) {
+	n := v.(*big.Int)
+	if n == nil {
+		return nil, nil
+	}
+	return n.String(), nil
+}
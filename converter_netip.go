@@ -0,0 +1,64 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/netip"
+	"reflect"
+)
+
+func init() {
+	RegisterConverter(reflect.TypeOf(netip.Addr{}), Converter{Scan: scanNetipAddr, Value: valueNetipAddr})
+}
+
+func scanNetipAddr(dest interface{}, src interface{}) error {
+	var addr netip.Addr
+	switch src := src.(type) {
+	case nil:
+	case string:
+		var err error
+		if addr, err = netip.ParseAddr(src); err != nil {
+			return fmt.Errorf("sqlfunc: converting to netip.Addr: %w", err)
+		}
+	case []byte:
+		var err error
+		if addr, err = netip.ParseAddr(string(src)); err != nil {
+			// Raw 4 or 16 bytes address
+			var ok bool
+			if addr, ok = netip.AddrFromSlice(src); !ok {
+				return fmt.Errorf("sqlfunc: converting to netip.Addr: %w", err)
+			}
+		}
+	default:
+		return fmt.Errorf("sqlfunc: converting %T to netip.Addr is unsupported", src)
+	}
+	*dest.(*netip.Addr) = addr
+	return nil
+}
+
+func valueNetipAddr(v interface{}) (driver.Value, error) {
+	addr := v.(netip.Addr)
+	if !addr.IsValid() {
+		return nil, nil
+	}
+	return addr.String(), nil
+}
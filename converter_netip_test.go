@@ -0,0 +1,84 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"net/netip"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func TestConverterNetipAddr(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE host (name TEXT, addr TEXT)`); err != nil {
+		t.Fatalf("Create table: %v", err)
+	}
+
+	var insert func(ctx context.Context, name string, addr netip.Addr) (sql.Result, error)
+	closeInsert, err := sqlfunc.Exec(ctx, db, `INSERT INTO host (name, addr) VALUES (?, ?)`, &insert)
+	if err != nil {
+		t.Fatalf("Prepare insert: %v", err)
+	}
+	defer closeInsert()
+
+	var get func(ctx context.Context, name string) (netip.Addr, error)
+	closeGet, err := sqlfunc.QueryRow(ctx, db, `SELECT addr FROM host WHERE name = ?`, &get)
+	if err != nil {
+		t.Fatalf("Prepare get: %v", err)
+	}
+	defer closeGet()
+
+	for name, addr := range map[string]netip.Addr{
+		"v4":   netip.MustParseAddr("192.0.2.1"),
+		"v6":   netip.MustParseAddr("2001:db8::1"),
+		"none": {},
+	} {
+		if _, err = insert(ctx, name, addr); err != nil {
+			t.Fatalf("insert %s: %v", name, err)
+		}
+		got, err := get(ctx, name)
+		if err != nil {
+			t.Fatalf("get %s: %v", name, err)
+		}
+		if got != addr {
+			t.Errorf("%s: got %v, expected %v", name, got, addr)
+		}
+	}
+
+	var isNull func(ctx context.Context, name string) (bool, error)
+	closeIsNull, err := sqlfunc.QueryRow(ctx, db, `SELECT addr IS NULL FROM host WHERE name = ?`, &isNull)
+	if err != nil {
+		t.Fatalf("Prepare isNull: %v", err)
+	}
+	defer closeIsNull()
+	if null, err := isNull(ctx, "none"); err != nil || !null {
+		t.Errorf("invalid netip.Addr should be stored as NULL: %v, %v", null, err)
+	}
+}
@@ -0,0 +1,475 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+const queryBools = `` +
+	`SELECT 0` +
+	` UNION ALL` +
+	` SELECT 1` +
+	` UNION ALL` +
+	` SELECT 'true'` +
+	` UNION ALL` +
+	` SELECT 'false'`
+
+func TestConverterBool(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	expected := []bool{false, true, true, false}
+
+	t.Run("ForEach", func(t *testing.T) {
+		rows, err := db.QueryContext(ctx, queryBools)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		var values []bool
+		err = sqlfunc.ForEach(rows, func(b bool) {
+			values = append(values, b)
+		})
+		if err != nil {
+			t.Fatalf("ForEach: %v", err)
+		}
+		if !reflect.DeepEqual(values, expected) {
+			t.Errorf("got %v, expected %v", values, expected)
+		}
+	})
+
+	t.Run("Scan", func(t *testing.T) {
+		rows, err := db.QueryContext(ctx, queryBools)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		defer rows.Close()
+
+		var scanPtr func(*sql.Rows, *bool) error
+		sqlfunc.Scan(&scanPtr)
+		var scanRet func(*sql.Rows) (bool, error)
+		sqlfunc.Scan(&scanRet)
+
+		var values []bool
+		for i := 0; rows.Next(); i++ {
+			var b bool
+			if i%2 == 0 {
+				err = scanPtr(rows, &b)
+			} else {
+				b, err = scanRet(rows)
+			}
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			values = append(values, b)
+		}
+		if err = rows.Err(); err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if !reflect.DeepEqual(values, expected) {
+			t.Errorf("got %v, expected %v", values, expected)
+		}
+	})
+
+	t.Run("QueryRow", func(t *testing.T) {
+		var f func(context.Context) (bool, bool, error)
+		close, err := sqlfunc.QueryRow(ctx, db, `SELECT 0, 1`, &f)
+		if err != nil {
+			t.Fatalf("QueryRow: %v", err)
+		}
+		defer close()
+		b0, b1, err := f(ctx)
+		if err != nil {
+			t.Fatalf("f: %v", err)
+		}
+		if b0 || !b1 {
+			t.Errorf("got %v, %v", b0, b1)
+		}
+	})
+
+	t.Run("nullable", func(t *testing.T) {
+		var f func(context.Context) (*bool, *bool, *bool, *bool, error)
+		close, err := sqlfunc.QueryRow(ctx, db, `SELECT 0, 1, 'true', NULL`, &f)
+		if err != nil {
+			t.Fatalf("QueryRow: %v", err)
+		}
+		defer close()
+		b0, b1, bt, bn, err := f(ctx)
+		if err != nil {
+			t.Fatalf("f: %v", err)
+		}
+		if b0 == nil || *b0 || b1 == nil || !*b1 || bt == nil || !*bt || bn != nil {
+			t.Errorf("got %v, %v, %v, %v", b0, b1, bt, bn)
+		}
+
+		rows, err := db.QueryContext(ctx, `SELECT 1 UNION ALL SELECT NULL`)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		var values []string
+		err = sqlfunc.ForEach(rows, func(b *bool) {
+			if b == nil {
+				values = append(values, "nil")
+			} else {
+				values = append(values, strconv.FormatBool(*b))
+			}
+		})
+		if err != nil || fmt.Sprint(values) != "[true nil]" {
+			t.Errorf("ForEach: got %v, %v", values, err)
+		}
+
+		// Rejected by the converter
+		var invalid func(context.Context) (*bool, error)
+		closeInvalid, err := sqlfunc.QueryRow(ctx, db, `SELECT 2`, &invalid)
+		if err != nil {
+			t.Fatalf("QueryRow: %v", err)
+		}
+		defer closeInvalid()
+		if _, err = invalid(ctx); err == nil || !strings.Contains(err.Error(), "must be 0 or 1") {
+			t.Errorf("got %v, expected the error of the converter", err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var f func(context.Context) (bool, error)
+		close, err := sqlfunc.QueryRow(ctx, db, `SELECT 2`, &f)
+		if err != nil {
+			t.Fatalf("QueryRow: %v", err)
+		}
+		defer close()
+		if _, err = f(ctx); err == nil {
+			t.Error("error expected")
+		}
+	})
+}
+
+func TestConverterBigInt(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE num (id INTEGER, n TEXT)`); err != nil {
+		t.Fatalf("Create table: %v", err)
+	}
+
+	var insert func(ctx context.Context, id int, n *big.Int) (sql.Result, error)
+	closeInsert, err := sqlfunc.Exec(ctx, db, `INSERT INTO num (id, n) VALUES (?, ?)`, &insert)
+	if err != nil {
+		t.Fatalf("Prepare insert: %v", err)
+	}
+	defer closeInsert()
+
+	var get func(ctx context.Context, id int) (*big.Int, error)
+	closeGet, err := sqlfunc.QueryRow(ctx, db, `SELECT n FROM num WHERE id = ?`, &get)
+	if err != nil {
+		t.Fatalf("Prepare get: %v", err)
+	}
+	defer closeGet()
+
+	huge, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	for id, n := range []*big.Int{big.NewInt(42), huge, nil} {
+		if _, err = insert(ctx, id, n); err != nil {
+			t.Fatalf("insert %v: %v", n, err)
+		}
+		got, err := get(ctx, id)
+		if err != nil {
+			t.Fatalf("get %v: %v", n, err)
+		}
+		if (n == nil) != (got == nil) || (n != nil && n.Cmp(got) != 0) {
+			t.Errorf("got %v, expected %v", got, n)
+		}
+	}
+
+	// Integer column
+	var getInt func(ctx context.Context) (*big.Int, error)
+	closeGetInt, err := sqlfunc.QueryRow(ctx, db, `SELECT 1234`, &getInt)
+	if err != nil {
+		t.Fatalf("Prepare getInt: %v", err)
+	}
+	defer closeGetInt()
+	if got, err := getInt(ctx); err != nil || got.Int64() != 1234 {
+		t.Errorf("getInt: got %v, %v", got, err)
+	}
+}
+
+type celsius float64
+
+func ExampleRegisterConverter() {
+	// Scan temperatures stored in Fahrenheit into a celsius variable
+	sqlfunc.RegisterConverter(reflect.TypeOf(celsius(0)), sqlfunc.Converter{
+		Scan: func(dest interface{}, src interface{}) error {
+			f, ok := src.(float64)
+			if !ok {
+				return fmt.Errorf("unexpected %T", src)
+			}
+			*dest.(*celsius) = celsius((f - 32) * 5 / 9)
+			return nil
+		},
+	})
+	defer sqlfunc.RegisterConverter(reflect.TypeOf(celsius(0)), sqlfunc.Converter{})
+
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `SELECT 212.0`)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+	err = sqlfunc.ForEach(rows, func(t celsius) {
+		fmt.Printf("%.1f°C\n", t)
+	})
+	if err != nil {
+		fmt.Println("ForEach:", err)
+	}
+
+	// Output:
+	// 100.0°C
+}
+
+type color int
+
+const (
+	red color = iota
+	green
+	blue
+)
+
+var colorNames = [...]string{"red", "green", "blue"}
+
+func (c color) String() string {
+	return colorNames[c]
+}
+
+func (c *color) ScanText(s string) error {
+	for i, name := range colorNames {
+		if name == s {
+			*c = color(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid color %q", s)
+}
+
+func ExampleTextScanner() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	// color implements sqlfunc.TextScanner
+	rows, err := db.QueryContext(ctx, `SELECT 'blue' UNION ALL SELECT 'red'`)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+	err = sqlfunc.ForEach(rows, func(c color) {
+		fmt.Printf("%d %v\n", c, c)
+	})
+	if err != nil {
+		fmt.Println("ForEach:", err)
+	}
+
+	var getColor func(ctx context.Context, name string) (color, error)
+	closeGetColor, err := sqlfunc.QueryRow(ctx, db, `SELECT ?`, &getColor)
+	if err != nil {
+		fmt.Println("Prepare:", err)
+		return
+	}
+	defer closeGetColor()
+	_, err = getColor(ctx, "purple")
+	fmt.Println(err)
+
+	// Output:
+	// 2 blue
+	// 0 red
+	// sql: Scan error on column index 0, name "?": invalid color "purple"
+}
+
+// textDuration implements encoding.TextMarshaler and encoding.TextUnmarshaler.
+type textDuration struct {
+	time.Duration
+}
+
+func (d textDuration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *textDuration) UnmarshalText(text []byte) (err error) {
+	d.Duration, err = time.ParseDuration(string(text))
+	return
+}
+
+// textPrecedence implements encoding.TextUnmarshaler, and also sqlfunc.TextScanner
+// (scanned by ScanText) or sql.Scanner (scanned by Scan) in its variants.
+type textPrecedence struct{ method string }
+
+func (p *textPrecedence) UnmarshalText([]byte) error {
+	p.method = "UnmarshalText"
+	return nil
+}
+
+type textScannerPrecedence struct{ textPrecedence }
+
+func (p *textScannerPrecedence) ScanText(string) error {
+	p.method = "ScanText"
+	return nil
+}
+
+type scannerPrecedence struct{ textPrecedence }
+
+func (p *scannerPrecedence) Scan(interface{}) error {
+	p.method = "Scan"
+	return nil
+}
+
+func TestTextMarshaler(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE task (name TEXT, timeout TEXT)`); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	var insert func(ctx context.Context, name string, timeout *textDuration) (sql.Result, error)
+	closeInsert, err := sqlfunc.Exec(ctx, db, `INSERT INTO task (name, timeout) VALUES (?, ?)`, &insert)
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	defer closeInsert()
+	if _, err = insert(ctx, "backup", &textDuration{90 * time.Second}); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if _, err = insert(ctx, "cleanup", nil); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	// Bound as text
+	var text string
+	if err = db.QueryRowContext(ctx, `SELECT timeout FROM task WHERE name = 'backup'`).Scan(&text); err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	if text != "1m30s" {
+		t.Errorf("stored %q, expected %q", text, "1m30s")
+	}
+
+	const query = `SELECT timeout FROM task WHERE name = ?`
+	var getTimeout func(ctx context.Context, name string) (textDuration, error)
+	closeGetTimeout, err := sqlfunc.QueryRow(ctx, db, query, &getTimeout)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeGetTimeout()
+	if d, err := getTimeout(ctx, "backup"); err != nil || d.Duration != 90*time.Second {
+		t.Errorf("backup: got %v, %v; expected %v", d, err, 90*time.Second)
+	}
+	if _, err := getTimeout(ctx, "cleanup"); err == nil {
+		t.Error("cleanup: error expected for NULL")
+	}
+
+	var getTimeoutOrZero func(ctx context.Context, name string) (textDuration, error)
+	closeGetTimeoutOrZero, err := sqlfunc.QueryRow(ctx, db, query, &getTimeoutOrZero, sqlfunc.WithNullAsZero())
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeGetTimeoutOrZero()
+	if d, err := getTimeoutOrZero(ctx, "cleanup"); err != nil || d.Duration != 0 {
+		t.Errorf("cleanup: got %v, %v; expected 0", d, err)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT timeout FROM task WHERE timeout IS NOT NULL UNION ALL SELECT '250ms'`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var durations []time.Duration
+	err = sqlfunc.ForEach(rows, func(d textDuration) {
+		durations = append(durations, d.Duration)
+	})
+	if err != nil {
+		t.Errorf("ForEach: %v", err)
+	}
+	if !reflect.DeepEqual(durations, []time.Duration{90 * time.Second, 250 * time.Millisecond}) {
+		t.Errorf("ForEach: got %v", durations)
+	}
+
+	// Precedence
+	var p textPrecedence
+	var ps textScannerPrecedence
+	var pr scannerPrecedence
+	if err = sqlfunc.QueryRowOnce(ctx, db, `SELECT 'a', 'b', 'c'`, nil, &p, &ps, &pr); err != nil {
+		t.Fatalf("QueryRowOnce: %v", err)
+	}
+	if p.method != "UnmarshalText" || ps.method != "ScanText" || pr.method != "Scan" {
+		t.Errorf("got %q, %q, %q", p.method, ps.method, pr.method)
+	}
+}
+
+// net.IP implements encoding.TextMarshaler, but is a []byte handled by database/sql.
+func TestTextMarshalerNativeKind(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	ip := net.IPv4(1, 2, 3, 4).To4()
+	var roundTrip func(ctx context.Context, ip net.IP) (typ string, out net.IP, err error)
+	closeRoundTrip, err := sqlfunc.QueryRow(ctx, db, `SELECT typeof(?1), ?1`, &roundTrip)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeRoundTrip()
+	typ, out, err := roundTrip(ctx, ip)
+	if err != nil {
+		t.Fatalf("roundTrip: %v", err)
+	}
+	if typ != "blob" || !out.Equal(ip) || len(out) != net.IPv4len {
+		t.Errorf("got %s %v (%d bytes), expected blob %v", typ, out, len(out), ip)
+	}
+}
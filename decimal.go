@@ -0,0 +1,139 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal is a fixed-point decimal number, for DECIMAL/NUMERIC columns (financial data...)
+// that must not go through float64.
+//
+// Decimal implements [database/sql.Scanner] and [database/sql/driver.Valuer] using the text
+// representation of the number, so precision is preserved as long as the driver returns
+// the value as text. Use *Decimal destinations to handle NULL values.
+//
+// Decimal has no arithmetic: it is meant to carry values between the database and the
+// decimal library of the application. Other decimal types can be supported for scanning and
+// arguments by registering a [Converter] (see [RegisterConverter]).
+//
+// The zero value is 0.
+type Decimal struct {
+	coef  *big.Int // nil means 0
+	scale int32    // number of digits after the decimal point
+}
+
+// ParseDecimal parses the decimal representation of a number, with an optional sign,
+// an optional fractional part and an optional exponent ("-123.45", "1.5e3").
+func ParseDecimal(s string) (Decimal, error) {
+	str := s
+	var exp int64
+	if i := strings.IndexAny(str, "eE"); i >= 0 {
+		var err error
+		if exp, err = strconv.ParseInt(str[i+1:], 10, 32); err != nil {
+			return Decimal{}, fmt.Errorf("sqlfunc: invalid decimal %q", s)
+		}
+		str = str[:i]
+	}
+	var neg bool
+	if str != "" && (str[0] == '-' || str[0] == '+') {
+		neg = str[0] == '-'
+		str = str[1:]
+	}
+	intPart, fracPart := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		intPart, fracPart = str[:i], str[i+1:]
+	}
+	digits := intPart + fracPart
+	if digits == "" {
+		return Decimal{}, fmt.Errorf("sqlfunc: invalid decimal %q", s)
+	}
+	for i := 0; i < len(digits); i++ {
+		if !isDigit(digits[i]) {
+			return Decimal{}, fmt.Errorf("sqlfunc: invalid decimal %q", s)
+		}
+	}
+	coef, _ := new(big.Int).SetString(digits, 10)
+	if neg {
+		coef.Neg(coef)
+	}
+	scale := int64(len(fracPart)) - exp
+	if scale < 0 {
+		coef.Mul(coef, new(big.Int).Exp(big.NewInt(10), big.NewInt(-scale), nil))
+		scale = 0
+	}
+	return Decimal{coef: coef, scale: int32(scale)}, nil
+}
+
+// String returns the decimal representation of d, with its scale (digits after the
+// decimal point) preserved: "123.40".
+func (d Decimal) String() string {
+	if d.coef == nil {
+		d.coef = new(big.Int)
+	}
+	digits := new(big.Int).Abs(d.coef).String()
+	if d.scale > 0 {
+		if n := int(d.scale) + 1 - len(digits); n > 0 {
+			digits = strings.Repeat("0", n) + digits
+		}
+		digits = digits[:len(digits)-int(d.scale)] + "." + digits[len(digits)-int(d.scale):]
+	}
+	if d.coef.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Scan implements [database/sql.Scanner].
+//
+// Text values are parsed with [ParseDecimal]. Integers are accepted. Floating point values
+// (SQLite stores DECIMAL as REAL when possible) are converted using their shortest
+// representation. NULL is rejected: use a *Decimal destination.
+func (d *Decimal) Scan(src interface{}) error {
+	var s string
+	switch src := src.(type) {
+	case string:
+		s = src
+	case []byte:
+		s = string(src)
+	case int64:
+		*d = Decimal{coef: big.NewInt(src)}
+		return nil
+	case float64:
+		s = strconv.FormatFloat(src, 'f', -1, 64)
+	case nil:
+		return errors.New("sqlfunc: converting NULL to Decimal is unsupported")
+	default:
+		return fmt.Errorf("sqlfunc: can't scan %T into Decimal", src)
+	}
+	v, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// Value implements [database/sql/driver.Valuer]: the value is the text representation.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func TestParseDecimal(t *testing.T) {
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{"0", "0"},
+		{"123.45", "123.45"},
+		{"-123.45", "-123.45"},
+		{"+1.50", "1.50"},
+		{".5", "0.5"},
+		{"-0.001", "-0.001"},
+		{"5.", "5"},
+		{"1.5e3", "1500"},
+		{"1.5E-3", "0.0015"},
+		{"12345678901234567890.123456789", "12345678901234567890.123456789"},
+	} {
+		d, err := sqlfunc.ParseDecimal(tc.in)
+		if err != nil {
+			t.Errorf("%q: %v", tc.in, err)
+			continue
+		}
+		if got := d.String(); got != tc.out {
+			t.Errorf("%q: got %q, expected %q", tc.in, got, tc.out)
+		}
+	}
+	for _, in := range []string{"", "-", ".", "1.2.3", "abc", "1e", "1ex", "0x10"} {
+		if _, err := sqlfunc.ParseDecimal(in); err == nil {
+			t.Errorf("%q: error expected", in)
+		}
+	}
+	if s := (sqlfunc.Decimal{}).String(); s != "0" {
+		t.Errorf("zero value: got %q", s)
+	}
+}
+
+func TestDecimalRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE account (id INTEGER, balance DECIMAL(10, 2), big TEXT)`); err != nil {
+		t.Fatalf("Create table: %v", err)
+	}
+
+	var insert func(ctx context.Context, id int, balance sqlfunc.Decimal, big *sqlfunc.Decimal) (sql.Result, error)
+	closeInsert, err := sqlfunc.Exec(ctx, db, `INSERT INTO account (id, balance, big) VALUES (?, ?, ?)`, &insert)
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	defer closeInsert()
+
+	var get func(ctx context.Context, id int) (sqlfunc.Decimal, *sqlfunc.Decimal, error)
+	closeGet, err := sqlfunc.QueryRow(ctx, db, `SELECT balance, big FROM account WHERE id = ?`, &get)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeGet()
+
+	balance, _ := sqlfunc.ParseDecimal("123.45")
+	big, _ := sqlfunc.ParseDecimal("12345678901234567890.123456789")
+	if _, err = insert(ctx, 1, balance, &big); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if _, err = insert(ctx, 2, balance, nil); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	b, bg, err := get(ctx, 1)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if b.String() != "123.45" {
+		t.Errorf("balance: got %s", b)
+	}
+	if bg == nil || bg.String() != "12345678901234567890.123456789" {
+		t.Errorf("big: got %v", bg)
+	}
+
+	if _, bg, err = get(ctx, 2); err != nil || bg != nil {
+		t.Errorf("NULL: got %v, %v", bg, err)
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+// QueryError is an error returned by a function created by [Exec], [QueryRow] or [Query]
+// that gives access to the query of the statement. See [WithErrorQuery].
+//
+// QueryError is also returned by [Group.PrepareAll] when a statement fails to be prepared.
+type QueryError struct {
+	query string
+	err   error
+}
+
+// Query returns the query of the statement that failed.
+func (e *QueryError) Query() string {
+	return e.query
+}
+
+func (e *QueryError) Error() string {
+	return e.err.Error() + " [query: " + e.query + "]"
+}
+
+// Unwrap returns the original error.
+func (e *QueryError) Unwrap() error {
+	return e.err
+}
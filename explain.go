@@ -0,0 +1,109 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// explainPrefix returns the prefix of the query that gives the plan of a query for driver:
+// "EXPLAIN QUERY PLAN " for SQLite (which also accepts EXPLAIN but gives the bytecode),
+// "EXPLAIN " for PostgreSQL, MySQL and others.
+func explainPrefix(driver string) string {
+	if isSQLiteDriver(driver) {
+		return "EXPLAIN QUERY PLAN "
+	}
+	return "EXPLAIN "
+}
+
+// prepareExplain prepares the query giving the plan of the query of t, if enabled by [WithExplain].
+// If the database doesn't support it, explain is disabled.
+func (t *stmtTarget) prepareExplain(ctx context.Context, db PrepareConn, o *options) {
+	if o.explain == nil {
+		return
+	}
+	query := explainPrefix(driverPkgPath(db)) + t.query
+	if t.stmt == nil { // WithoutPrepare: errors are reported at call time
+		t.explain = &stmtTarget{conn: t.conn, query: query}
+		return
+	}
+	if stmt, err := db.PrepareContext(ctx, query); err == nil {
+		t.explain = &stmtTarget{stmt: stmt, query: query}
+	}
+}
+
+// runExplain gives the plan of the query of t to the callback of [WithExplain].
+// Failures are ignored.
+func (o *options) runExplain(ctx context.Context, t *stmtTarget, args []interface{}) {
+	if t.explain == nil {
+		return
+	}
+	rows, err := t.explain.queryRows(ctx, args)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if plan, err := readPlan(rows); err == nil {
+		o.explain(plan)
+	}
+}
+
+// readPlan formats the rows of an EXPLAIN query as text: one line per row, with the columns
+// separated by spaces. For SQLite, only the "detail" column is kept.
+func readPlan(rows *sql.Rows) (string, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	values := make([]sql.NullString, len(columns))
+	scanners := make([]interface{}, len(columns))
+	for i := range values {
+		scanners[i] = &values[i]
+	}
+	detail := -1
+	for i, c := range columns {
+		if c == "detail" {
+			detail = i
+		}
+	}
+	var b strings.Builder
+	for rows.Next() {
+		if err = rows.Scan(scanners...); err != nil {
+			return "", err
+		}
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		if detail >= 0 {
+			b.WriteString(values[detail].String)
+			continue
+		}
+		for i, v := range values {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			if v.Valid {
+				b.WriteString(v.String)
+			} else {
+				b.WriteString("NULL")
+			}
+		}
+	}
+	return b.String(), rows.Err()
+}
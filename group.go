@@ -0,0 +1,313 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned by the functions bound by a [Group] once the group has been closed.
+var ErrClosed = errors.New("sqlfunc: statement closed")
+
+// Group prepares multiple statements on the same [PrepareConn] and releases them all at once.
+//
+// The functions bound by the group return [ErrClosed] once [Group.Close] has been called.
+//
+// Example:
+//
+//	g := sqlfunc.NewGroup(db)
+//	defer g.Close()
+//
+//	var countPOI func(ctx context.Context) (int64, error)
+//	err := g.QueryRow(ctx, `SELECT COUNT(*) FROM poi`, &countPOI)
+//	// if err != nil ...
+type Group struct {
+	db          PrepareConn
+	opts        []Option
+	concurrency int
+	closed      uint32
+	m           sync.Mutex
+	closers     []func() error
+	middlewares []Middleware
+}
+
+// NewGroup returns a [Group] that prepares statements on db.
+//
+// The options apply to all the statements of the group, before the options given for each
+// statement. [WithConcurrency] applies to [Group.PrepareAll].
+func NewGroup(db PrepareConn, opts ...Option) *Group {
+	return &Group{
+		db:          db,
+		opts:        opts,
+		concurrency: newOptions(opts).concurrency,
+	}
+}
+
+// Exec is like [Exec] but the statement is owned by the group.
+func (g *Group) Exec(ctx context.Context, query string, fnPtr interface{}, opts ...Option) error {
+	return g.add(prepareExec(ctx, g.db, query, fnPtr, g.options(opts)))
+}
+
+// QueryRow is like [QueryRow] but the statement is owned by the group.
+func (g *Group) QueryRow(ctx context.Context, query string, fnPtr interface{}, opts ...Option) error {
+	return g.add(prepareQueryRow(ctx, g.db, query, fnPtr, g.options(opts)))
+}
+
+// Query is like [Query] but the statement is owned by the group.
+func (g *Group) Query(ctx context.Context, query string, fnPtr interface{}, opts ...Option) error {
+	return g.add(prepareQuery(ctx, g.db, query, fnPtr, g.options(opts)))
+}
+
+// Use adds middlewares to the statements prepared after by the group (see [WithMiddleware]).
+// The middlewares of the group wrap the middlewares given as options for a statement.
+func (g *Group) Use(middlewares ...Middleware) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.middlewares = append(g.middlewares, middlewares...)
+}
+
+func (g *Group) options(opts []Option) *options {
+	if len(g.opts) > 0 {
+		opts = append(g.opts[:len(g.opts):len(g.opts)], opts...)
+	}
+	o := newOptions(opts)
+	o.closed = &g.closed
+	g.m.Lock()
+	if len(g.middlewares) > 0 {
+		o.middlewares = append(g.middlewares[:len(g.middlewares):len(g.middlewares)], o.middlewares...)
+	}
+	g.m.Unlock()
+	return o
+}
+
+func (g *Group) add(close func() error, err error) error {
+	g.m.Lock()
+	defer g.m.Unlock()
+	if err != nil {
+		return prepareError(len(g.closers), err)
+	}
+	if atomic.LoadUint32(&g.closed) != 0 {
+		close()
+		return ErrClosed
+	}
+	g.closers = append(g.closers, close)
+	return nil
+}
+
+// GroupStmt is a statement to prepare with [Group.PrepareAll].
+// Use [GroupExec], [GroupQueryRow] or [GroupQuery] to build it.
+type GroupStmt struct {
+	query   string
+	fnPtr   interface{}
+	prepare func(ctx context.Context, g *Group) (close func() error, err error)
+}
+
+// GroupExec returns the arguments of [Group.Exec] as a [GroupStmt].
+func GroupExec(query string, fnPtr interface{}, opts ...Option) GroupStmt {
+	return GroupStmt{query, fnPtr, func(ctx context.Context, g *Group) (func() error, error) {
+		return prepareExec(ctx, g.db, query, fnPtr, g.options(opts))
+	}}
+}
+
+// GroupQueryRow returns the arguments of [Group.QueryRow] as a [GroupStmt].
+func GroupQueryRow(query string, fnPtr interface{}, opts ...Option) GroupStmt {
+	return GroupStmt{query, fnPtr, func(ctx context.Context, g *Group) (func() error, error) {
+		return prepareQueryRow(ctx, g.db, query, fnPtr, g.options(opts))
+	}}
+}
+
+// GroupQuery returns the arguments of [Group.Query] as a [GroupStmt].
+func GroupQuery(query string, fnPtr interface{}, opts ...Option) GroupStmt {
+	return GroupStmt{query, fnPtr, func(ctx context.Context, g *Group) (func() error, error) {
+		return prepareQuery(ctx, g.db, query, fnPtr, g.options(opts))
+	}}
+}
+
+// PrepareAll prepares the statements in the group, in order, with a shared deadline: timeout
+// (if positive) applies to the preparation of the whole batch. This bounds the time spent
+// preparing statements at startup when the database is slow or unreachable.
+//
+// If the group was created with [WithConcurrency], up to n statements are prepared concurrently.
+//
+// The batch is prepared as a whole: on failure, the preparations in progress are canceled and
+// the statements of the batch already prepared are closed. No statement of the batch is added
+// to the group and their func variables are reset to nil.
+// PrepareAll then returns a [*QueryError] that gives the query of the failing statement (the
+// original error, such as [context.DeadlineExceeded], is available with [errors.Is]). With
+// concurrent preparations, the error reported is the one of the first failing statement in the
+// order of stmts (ignoring the cancellations caused by the failure).
+func (g *Group) PrepareAll(ctx context.Context, timeout time.Duration, stmts ...GroupStmt) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	closers := make([]func() error, len(stmts))
+	var failed int
+	var err error
+	if g.concurrency > 1 && len(stmts) > 1 {
+		failed, err = g.prepareConcurrently(ctx, stmts, closers)
+	} else {
+		failed, err = g.prepareSequentially(ctx, stmts, closers)
+	}
+	if err != nil {
+		rollback(stmts, closers)
+		g.m.Lock()
+		n := len(g.closers)
+		g.m.Unlock()
+		return &QueryError{query: stmts[failed].query, err: prepareError(n, err)}
+	}
+
+	for i, st := range stmts {
+		if err := g.add(closers[i], nil); err != nil {
+			// Group closed: close the next statements
+			for _, close := range closers[i+1:] {
+				_ = close()
+			}
+			return &QueryError{query: st.query, err: err}
+		}
+	}
+	return nil
+}
+
+// rollback closes the statements of stmts already prepared (with a non-nil closer) and resets
+// their func variables.
+func rollback(stmts []GroupStmt, closers []func() error) {
+	for i, close := range closers {
+		if close != nil {
+			_ = close()
+			v := reflect.ValueOf(stmts[i].fnPtr).Elem()
+			v.Set(reflect.Zero(v.Type()))
+		}
+	}
+}
+
+// prepareSequentially prepares stmts in order into closers, and stops at the first failure.
+func (g *Group) prepareSequentially(ctx context.Context, stmts []GroupStmt, closers []func() error) (failed int, err error) {
+	for i := range stmts {
+		if closers[i], err = stmts[i].prepare(ctx, g); err != nil {
+			closers[i] = nil
+			return i, err
+		}
+	}
+	return -1, nil
+}
+
+// prepareConcurrently prepares stmts into closers, with up to g.concurrency preparations in
+// progress, and cancels them at the first failure.
+//
+// A panic of a preparation (such as for an invalid func signature) is raised again on the
+// goroutine of the caller, once the statements already prepared are closed.
+func (g *Group) prepareConcurrently(parent context.Context, stmts []GroupStmt, closers []func() error) (failed int, err error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	errs := make([]error, len(stmts))
+	panics := make([]interface{}, len(stmts))
+	sem := make(chan struct{}, g.concurrency)
+	var wg sync.WaitGroup
+	for i := range stmts {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break // a preparation failed
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			defer func() {
+				if r := recover(); r != nil {
+					panics[i] = r
+					cancel()
+				}
+			}()
+			closers[i], errs[i] = stmts[i].prepare(ctx, g)
+			if errs[i] != nil {
+				closers[i] = nil
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, r := range panics {
+		if r != nil {
+			rollback(stmts, closers)
+			panic(r)
+		}
+	}
+
+	failed = -1
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if failed < 0 {
+			failed = i
+		}
+		// Skip the cancellations caused by the failure
+		if parent.Err() != nil || !errors.Is(err, context.Canceled) {
+			failed = i
+			break
+		}
+	}
+	if failed < 0 {
+		return -1, nil
+	}
+	return failed, errs[failed]
+}
+
+// prepareError reports the failure of the preparation of a statement of a group having
+// n statements open: servers may limit the number of prepared statements.
+func prepareError(n int, err error) error {
+	return fmt.Errorf("sqlfunc: prepare failed with %d statements open in group: %w", n, err)
+}
+
+// OpenCount returns the number of statements of the group that are open.
+//
+// Some servers limit the number of prepared statements (per connection or globally): this count
+// helps diagnose "too many prepared statements" errors. The count is also reported in the error
+// returned when the preparation of a statement of the group fails.
+func (g *Group) OpenCount() int {
+	g.m.Lock()
+	defer g.m.Unlock()
+	return len(g.closers)
+}
+
+// Close closes all the statements of the group.
+//
+// The functions bound by the group will then return [ErrClosed].
+// The first error from closing a statement is returned.
+func (g *Group) Close() (err error) {
+	atomic.StoreUint32(&g.closed, 1)
+	g.m.Lock()
+	closers := g.closers
+	g.closers = nil
+	g.m.Unlock()
+	for _, close := range closers {
+		if e := close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
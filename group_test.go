@@ -0,0 +1,384 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func ExampleGroup() {
+	check := func(msg string, err error) {
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", msg, err))
+		}
+	}
+
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	check("Open", err)
+	defer db.Close()
+
+	g := sqlfunc.NewGroup(db)
+	defer g.Close()
+
+	var countPOI func(ctx context.Context) (int64, error)
+	check("Prepare countPOI", g.QueryRow(ctx, `SELECT COUNT(*) FROM poi`, &countPOI))
+
+	var queryNames func(ctx context.Context) (*sql.Rows, error)
+	check("Prepare queryNames", g.Query(ctx, `SELECT name FROM poi ORDER BY name`, &queryNames))
+
+	n, err := countPOI(ctx)
+	check("countPOI", err)
+	fmt.Println("count:", n)
+
+	rows, err := queryNames(ctx)
+	check("queryNames", err)
+	err = sqlfunc.ForEach(rows, func(name string) {
+		fmt.Println("-", name)
+	})
+	check("read rows", err)
+
+	// Output:
+	// count: 2
+	// - Château de Versailles
+	// - Villeperdue
+}
+
+func TestGroupClosed(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	g := sqlfunc.NewGroup(db)
+
+	var exec func(ctx context.Context) (sql.Result, error)
+	if err = g.Exec(ctx, `SELECT 1`, &exec); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	var queryRow func(ctx context.Context) (int, string, error)
+	if err = g.QueryRow(ctx, `SELECT 1, 'a'`, &queryRow); err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	var query func(ctx context.Context) (*sql.Rows, error)
+	if err = g.Query(ctx, `SELECT 1`, &query); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+
+	if n, s, err := queryRow(ctx); err != nil || n != 1 || s != "a" {
+		t.Fatalf("queryRow before Close: %v, %q, %v", n, s, err)
+	}
+
+	if err = g.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if _, err = exec(ctx); !errors.Is(err, sqlfunc.ErrClosed) {
+		t.Errorf("exec after Close: got %v", err)
+	}
+	if n, s, err := queryRow(ctx); !errors.Is(err, sqlfunc.ErrClosed) || n != 0 || s != "" {
+		t.Errorf("queryRow after Close: got %v, %q, %v", n, s, err)
+	}
+	if rows, err := query(ctx); !errors.Is(err, sqlfunc.ErrClosed) || rows != nil {
+		t.Errorf("query after Close: got %v, %v", rows, err)
+	}
+
+	var late func(ctx context.Context) (sql.Result, error)
+	if err = g.Exec(ctx, `SELECT 1`, &late); !errors.Is(err, sqlfunc.ErrClosed) {
+		t.Errorf("Exec after Close: got %v", err)
+	}
+}
+
+func TestGroupOpenCount(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	const invalidQuery = `SELECT FROM`
+	g := sqlfunc.NewGroup(failingConn{db, invalidQuery})
+	defer g.Close()
+
+	if n := g.OpenCount(); n != 0 {
+		t.Errorf("OpenCount: got %d, expected 0", n)
+	}
+	var exec func(ctx context.Context) (sql.Result, error)
+	if err = g.Exec(ctx, `SELECT 1`, &exec); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	var queryRow func(ctx context.Context) (int, error)
+	if err = g.QueryRow(ctx, `SELECT 1`, &queryRow); err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	if n := g.OpenCount(); n != 2 {
+		t.Errorf("OpenCount: got %d, expected 2", n)
+	}
+
+	err = g.QueryRow(ctx, invalidQuery, &queryRow)
+	if !errors.Is(err, errPrepare) {
+		t.Fatalf("got %v, expected %v", err, errPrepare)
+	}
+	if !strings.Contains(err.Error(), "2 statements open") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	g.Close()
+	if n := g.OpenCount(); n != 0 {
+		t.Errorf("OpenCount after Close: got %d, expected 0", n)
+	}
+}
+
+var errPrepare = errors.New("prepare failure")
+
+// failingConn is a [sqlfunc.PrepareConn] whose preparation of a given query fails, as the
+// preparation of invalid SQL does with drivers that check the query when preparing it.
+type failingConn struct {
+	sqlfunc.PrepareConn
+	query string
+}
+
+func (c failingConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if query == c.query {
+		return nil, errPrepare
+	}
+	return c.PrepareConn.PrepareContext(ctx, query)
+}
+
+// blockingConn is a [sqlfunc.PrepareConn] that blocks on the preparation of a given query.
+type blockingConn struct {
+	sqlfunc.PrepareConn
+	query string
+}
+
+func (c blockingConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if query == c.query {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return c.PrepareConn.PrepareContext(ctx, query)
+}
+
+func TestGroupPrepareAll(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	const slowQuery = `SELECT 2`
+	g := sqlfunc.NewGroup(blockingConn{db, slowQuery})
+	defer g.Close()
+
+	var exec func(ctx context.Context) (sql.Result, error)
+	var one, two func(ctx context.Context) (int, error)
+	var query func(ctx context.Context) (*sql.Rows, error)
+	start := time.Now()
+	err = g.PrepareAll(ctx, 50*time.Millisecond,
+		sqlfunc.GroupExec(`SELECT 0`, &exec),
+		sqlfunc.GroupQueryRow(`SELECT 1`, &one),
+		sqlfunc.GroupQueryRow(slowQuery, &two),
+		sqlfunc.GroupQuery(`SELECT 3`, &query),
+	)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("PrepareAll took %v", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, expected %v", err, context.DeadlineExceeded)
+	}
+	var qerr *sqlfunc.QueryError
+	if !errors.As(err, &qerr) || qerr.Query() != slowQuery {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// The statements of the batch are closed
+	if n := g.OpenCount(); n != 0 {
+		t.Errorf("OpenCount: got %d, expected 0", n)
+	}
+	if exec != nil || one != nil || two != nil || query != nil {
+		t.Error("funcs of the failed batch should be nil")
+	}
+
+	// Without failure
+	g2 := sqlfunc.NewGroup(db)
+	defer g2.Close()
+	if err = g2.PrepareAll(ctx, time.Second, sqlfunc.GroupQueryRow(slowQuery, &two), sqlfunc.GroupQuery(`SELECT 3`, &query)); err != nil {
+		t.Fatalf("PrepareAll: %v", err)
+	}
+	if n, err := two(ctx); err != nil || n != 2 {
+		t.Errorf("two: got %d, %v", n, err)
+	}
+}
+
+// slowConn is a [sqlfunc.PrepareConn] that delays the preparation of statements, as the
+// round-trip to a remote server does. It records the maximum number of concurrent preparations.
+// The preparation of the query fail, if set, fails after the delay.
+type slowConn struct {
+	sqlfunc.PrepareConn
+	delay time.Duration
+	fail  string
+
+	mu           sync.Mutex
+	active, peak int
+}
+
+func (c *slowConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	c.active++
+	if c.active > c.peak {
+		c.peak = c.active
+	}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.active--
+		c.mu.Unlock()
+	}()
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if query == c.fail {
+		return nil, errPrepare
+	}
+	return c.PrepareConn.PrepareContext(ctx, query)
+}
+
+func TestGroupPrepareAllConcurrency(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	const failQuery = `SELECT 2`
+	conn := &slowConn{PrepareConn: db, delay: 10 * time.Millisecond, fail: failQuery}
+	g := sqlfunc.NewGroup(conn, sqlfunc.WithConcurrency(3))
+	defer g.Close()
+
+	funcs := make([]func(ctx context.Context) (int, error), 8)
+	stmts := make([]sqlfunc.GroupStmt, len(funcs))
+	for i := range funcs {
+		stmts[i] = sqlfunc.GroupQueryRow(fmt.Sprintf("SELECT %d", i+10), &funcs[i])
+	}
+	if err = g.PrepareAll(ctx, 0, stmts...); err != nil {
+		t.Fatalf("PrepareAll: %v", err)
+	}
+	if conn.peak < 2 || conn.peak > 3 {
+		t.Errorf("concurrent preparations: got %d, expected 2 or 3", conn.peak)
+	}
+	if n := g.OpenCount(); n != len(funcs) {
+		t.Errorf("OpenCount: got %d, expected %d", n, len(funcs))
+	}
+	for i, f := range funcs {
+		if n, err := f(ctx); err != nil || n != i+10 {
+			t.Errorf("funcs[%d]: got %d, %v", i, n, err)
+		}
+	}
+
+	// With a failure, the statements of the batch are closed
+	var one, two, three func(ctx context.Context) (int, error)
+	err = g.PrepareAll(ctx, 0,
+		sqlfunc.GroupQueryRow(`SELECT 1`, &one),
+		sqlfunc.GroupQueryRow(failQuery, &two),
+		sqlfunc.GroupQueryRow(`SELECT 3`, &three),
+	)
+	var qerr *sqlfunc.QueryError
+	if !errors.As(err, &qerr) || qerr.Query() != failQuery || !errors.Is(err, errPrepare) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if n := g.OpenCount(); n != len(funcs) {
+		t.Errorf("OpenCount: got %d, expected %d", n, len(funcs))
+	}
+	if one != nil || two != nil || three != nil {
+		t.Error("funcs of the failed batch should be nil")
+	}
+}
+
+func TestGroupPrepareAllConcurrencyPanic(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	g := sqlfunc.NewGroup(db, sqlfunc.WithConcurrency(4))
+	defer g.Close()
+
+	var one, three func(ctx context.Context) (int, error)
+	var bad func(ctx context.Context) (int, error) // no argument for the placeholder
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("panic expected")
+		}
+		t.Log(r)
+		if n := g.OpenCount(); n != 0 {
+			t.Errorf("OpenCount: got %d, expected 0", n)
+		}
+		if one != nil || three != nil {
+			t.Error("funcs of the failed batch should be nil")
+		}
+	}()
+	_ = g.PrepareAll(ctx, 0,
+		sqlfunc.GroupQueryRow(`SELECT 1`, &one),
+		sqlfunc.GroupQueryRow(`SELECT ?`, &bad),
+		sqlfunc.GroupQueryRow(`SELECT 3`, &three),
+	)
+}
+
+func BenchmarkGroupPrepareAll(b *testing.B) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		b.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	for _, concurrency := range []int{1, 4, 16} {
+		b.Run(fmt.Sprint("concurrency=", concurrency), func(b *testing.B) {
+			conn := &slowConn{PrepareConn: db, delay: time.Millisecond}
+			funcs := make([]func(ctx context.Context) (int, error), 16)
+			stmts := make([]sqlfunc.GroupStmt, len(funcs))
+			for i := range funcs {
+				stmts[i] = sqlfunc.GroupQueryRow(fmt.Sprintf("SELECT %d", i), &funcs[i])
+			}
+			for i := 0; i < b.N; i++ {
+				g := sqlfunc.NewGroup(conn, sqlfunc.WithConcurrency(concurrency))
+				if err := g.PrepareAll(ctx, 0, stmts...); err != nil {
+					b.Fatalf("PrepareAll: %v", err)
+				}
+				g.Close()
+			}
+		})
+	}
+}
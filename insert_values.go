@@ -0,0 +1,225 @@
+//go:build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// bulkInsert implements the multi-rows INSERT of [BulkInsert] and [PrepareInsertValues].
+type bulkInsert struct {
+	db       PrepareConn
+	table    string
+	columns  []string
+	dollar   bool // "$N" placeholders
+	batchLen int
+	stmt     *sql.Stmt // INSERT of batchLen rows
+
+	m       sync.Mutex
+	partial map[int]*sql.Stmt // INSERT by number of rows of partial batches
+}
+
+// query returns the INSERT statement for nbRows rows.
+func (b *bulkInsert) query(nbRows int) string {
+	var q strings.Builder
+	q.WriteString("INSERT INTO ")
+	q.WriteString(b.table)
+	q.WriteString(" (")
+	q.WriteString(strings.Join(b.columns, ", "))
+	q.WriteString(") VALUES ")
+	n := 0
+	for r := 0; r < nbRows; r++ {
+		if r > 0 {
+			q.WriteString(", ")
+		}
+		q.WriteByte('(')
+		for c := range b.columns {
+			if c > 0 {
+				q.WriteString(", ")
+			}
+			n++
+			if b.dollar {
+				q.WriteByte('$')
+				q.WriteString(strconv.Itoa(n))
+			} else {
+				q.WriteByte('?')
+			}
+		}
+		q.WriteByte(')')
+	}
+	return q.String()
+}
+
+// partialStmt returns the INSERT statement for nbRows rows, from the cache or prepared.
+func (b *bulkInsert) partialStmt(ctx context.Context, nbRows int) (*sql.Stmt, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.partial == nil {
+		return nil, ErrClosed
+	}
+	if stmt := b.partial[nbRows]; stmt != nil {
+		return stmt, nil
+	}
+	stmt, err := b.db.PrepareContext(ctx, b.query(nbRows))
+	if err != nil {
+		return nil, err
+	}
+	b.partial[nbRows] = stmt
+	return stmt, nil
+}
+
+func (b *bulkInsert) close() error {
+	b.m.Lock()
+	partial := b.partial
+	b.partial = nil
+	b.m.Unlock()
+	err := b.stmt.Close()
+	for _, stmt := range partial {
+		if e := stmt.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// PrepareInsertValues prepares the insertion of values of struct type T into table by batches
+// of batchSize rows with multi-rows INSERT statements:
+//
+//	INSERT INTO table (columns...) VALUES (...), (...)...
+//
+// The columns are the fields of T, in order, named as for scanning (see [ScanPtr]): the `sql`
+// tag or else the lowercased field name. The registered converters are applied to the values.
+// The placeholders are "$N" for Postgres drivers and "?" otherwise (see [WithDollarPlaceholders]).
+//
+// The function inserts rows by chunks of batchSize rows and returns the number of rows
+// inserted. The statement for full batches is prepared by PrepareInsertValues. The statement
+// for the last partial batch of a call is prepared on first use for each distinct size and
+// cached until [Stmt.Close]. Chunks are not inserted in a transaction: use an [*sql.Tx] as db
+// to get atomicity (with [WithDollarPlaceholders] for Postgres drivers, as the driver of a
+// transaction can't be determined). batchSize is limited by the maximum number of arguments
+// of a statement supported by the database (999 for old versions of SQLite, 65535 for Postgres).
+//
+// table is inserted in the queries as is: it must not come from untrusted input.
+func PrepareInsertValues[T any](ctx context.Context, db PrepareConn, table string, batchSize int, opts ...Option) (Stmt[func(ctx context.Context, rows []T) (int64, error)], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if !isStructDest(t) {
+		panic("T must be a struct type")
+	}
+	if batchSize < 1 {
+		panic("batchSize must be positive")
+	}
+	fields := structFields(t)
+	columns := make([]string, 0, len(fields))
+	for name := range fields {
+		columns = append(columns, name)
+	}
+	if len(columns) == 0 {
+		panic("T must have exported fields")
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		return lessPath(fields[columns[i]], fields[columns[j]])
+	})
+	paths := make([][]int, len(columns))
+	for i, c := range columns {
+		paths[i] = fields[c]
+	}
+
+	ins := &valuesInsert{
+		bulkInsert: bulkInsert{
+			db:       db,
+			table:    table,
+			columns:  columns,
+			dollar:   newOptions(opts).dollarPlaceholders(db),
+			batchLen: batchSize,
+			partial:  make(map[int]*sql.Stmt),
+		},
+		paths: paths,
+	}
+	var err error
+	ins.stmt, err = db.PrepareContext(ctx, ins.query(batchSize))
+	if err != nil {
+		return Stmt[func(context.Context, []T) (int64, error)]{}, err
+	}
+	return Stmt[func(context.Context, []T) (int64, error)]{
+		Func: func(ctx context.Context, rows []T) (int64, error) {
+			return ins.insert(ctx, reflect.ValueOf(rows))
+		},
+		close: ins.close,
+	}, nil
+}
+
+// lessPath orders index paths of struct fields in the order of declaration.
+func lessPath(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// valuesInsert implements [PrepareInsertValues].
+type valuesInsert struct {
+	bulkInsert
+	paths [][]int // index paths of the fields of the columns
+}
+
+// insert inserts rows, a slice of structs.
+func (ins *valuesInsert) insert(ctx context.Context, rows reflect.Value) (n int64, err error) {
+	for start := 0; start < rows.Len(); start += ins.batchLen {
+		end := start + ins.batchLen
+		if end > rows.Len() {
+			end = rows.Len()
+		}
+		stmt := ins.stmt
+		if end-start < ins.batchLen {
+			if stmt, err = ins.partialStmt(ctx, end-start); err != nil {
+				return
+			}
+		}
+		args := make([]interface{}, 0, (end-start)*len(ins.paths))
+		for i := start; i < end; i++ {
+			row := rows.Index(i)
+			for _, path := range ins.paths {
+				a, err := bindArg(row.FieldByIndex(path))
+				if err != nil {
+					return n, fmt.Errorf("sqlfunc: row %d, column %s: %w", i+1, ins.columns[len(args)%len(ins.paths)], err)
+				}
+				args = append(args, a)
+			}
+		}
+		res, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return n, err
+		}
+		count, err := res.RowsAffected()
+		if err != nil {
+			count = int64(end - start)
+		}
+		n += count
+	}
+	return
+}
@@ -0,0 +1,179 @@
+//go:build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+// queriesConn is a [sqlfunc.PrepareConn] recording the queries prepared.
+type queriesConn struct {
+	sqlfunc.PrepareConn
+	queries []string
+}
+
+func (c *queriesConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	c.queries = append(c.queries, query)
+	return c.PrepareConn.PrepareContext(ctx, query)
+}
+
+func ExamplePrepareInsertValues() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE poi (name TEXT, lat REAL, lon REAL)`); err != nil {
+		fmt.Println("Create table:", err)
+		return
+	}
+
+	type poi struct {
+		Name     string
+		Lat, Lon float64
+	}
+
+	insertPOIs, err := sqlfunc.PrepareInsertValues[poi](ctx, db, "poi", 2)
+	if err != nil {
+		fmt.Println("PrepareInsertValues:", err)
+		return
+	}
+	defer insertPOIs.Close()
+
+	// A full batch of 2 rows, then a partial batch of 1 row
+	n, err := insertPOIs.Func(ctx, []poi{
+		{"Château de Versailles", 48.8016, 2.1204},
+		{"Villeperdue", 47.2009, 0.6317},
+		{"Tour Eiffel", 48.8584, 2.2945},
+	})
+	if err != nil {
+		fmt.Println("insertPOIs:", err)
+		return
+	}
+	fmt.Println("Inserted:", n)
+
+	// Output:
+	// Inserted: 3
+}
+
+func TestPrepareInsertValues(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE t (a INTEGER, b TEXT)`); err != nil {
+		t.Fatalf("Create table: %v", err)
+	}
+
+	type row struct {
+		B       string `sql:"b"`
+		A       int    `sql:"a"`
+		ignored bool
+	}
+
+	insert, err := sqlfunc.PrepareInsertValues[row](ctx, db, "t", 3)
+	if err != nil {
+		t.Fatalf("PrepareInsertValues: %v", err)
+	}
+	defer insert.Close()
+
+	var total int64
+	for _, count := range []int{0, 1, 3, 7, 7} {
+		rows := make([]row, count)
+		for i := range rows {
+			rows[i] = row{A: i, B: fmt.Sprint("row", i)}
+		}
+		n, err := insert.Func(ctx, rows)
+		if err != nil {
+			t.Fatalf("insert %d: %v", count, err)
+		}
+		if n != int64(count) {
+			t.Errorf("insert %d: got %d", count, n)
+		}
+		total += n
+	}
+
+	var inDB, sum int64
+	if err = db.QueryRowContext(ctx, `SELECT COUNT(*), SUM(a) FROM t WHERE b = 'row' || a`).Scan(&inDB, &sum); err != nil {
+		t.Fatalf("Count: %v", err)
+	}
+	if inDB != total || sum != 0+3+21+21 {
+		t.Errorf("got %d rows (sum %d) in table, expected %d (sum 45)", inDB, sum, total)
+	}
+
+	if err = insert.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if _, err = insert.Func(ctx, []row{{A: 1}}); err == nil {
+		t.Error("error expected after Close")
+	}
+}
+
+func TestPrepareInsertValuesTx(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE t (a INTEGER, b TEXT)`); err != nil {
+		t.Fatalf("Create table: %v", err)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	defer tx.Rollback()
+
+	type row struct {
+		A int    `sql:"a"`
+		B string `sql:"b"`
+	}
+	// The driver of a transaction is unknown: the placeholder style is given
+	conn := &queriesConn{PrepareConn: tx}
+	insert, err := sqlfunc.PrepareInsertValues[row](ctx, conn, "t", 2, sqlfunc.WithDollarPlaceholders())
+	if err != nil {
+		t.Fatalf("PrepareInsertValues: %v", err)
+	}
+	defer insert.Close()
+	if n, err := insert.Func(ctx, []row{{1, "a"}, {2, "b"}, {3, "c"}}); err != nil || n != 3 {
+		t.Fatalf("insert: got %d, %v", n, err)
+	}
+	for _, q := range conn.queries {
+		if !strings.HasSuffix(q, "($1, $2)") && !strings.HasSuffix(q, "($3, $4)") {
+			t.Errorf("unexpected query: %s", q)
+		}
+	}
+}
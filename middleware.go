@@ -0,0 +1,158 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"time"
+)
+
+// CallFunc is the normalized form of a call of a function created by [Exec], [QueryRow] or [Query],
+// as seen by a [Middleware].
+//
+// args are the arguments given to the statement (after the expansion of [Args] and the
+// conversions). results are:
+//   - for [Exec]: the [sql.Result];
+//   - for [QueryRow]: the scanned values;
+//   - for [Query]: the [*sql.Rows].
+type CallFunc func(ctx context.Context, args []interface{}) (results []interface{}, err error)
+
+// Middleware wraps the calls of the functions created by [Exec], [QueryRow] and [Query] to
+// implement cross-cutting concerns (logging, metrics, retries...). A middleware calls next
+// (zero, one or multiple times) and may alter the context, the arguments, the results and the error.
+// Results must keep the same types. The query of the statement is given by [CallQuery].
+//
+// Middlewares are set with [WithMiddleware] or [Group.Use].
+type Middleware func(next CallFunc) CallFunc
+
+// WithMiddleware adds middlewares wrapping the calls of the functions created by [Exec], [QueryRow]
+// and [Query]. The first middleware is the outermost.
+//
+// The statement is run (and, for [QueryRow], the row is scanned) by the innermost call. For
+// [Query], the middlewares see the query, not the iteration of the rows.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(o *options) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+// WithSlowQueryThreshold reports the calls of the functions created by [Exec], [QueryRow] and
+// [Query] that last more than d: slow is called with the query and the time elapsed as soon as the
+// threshold is exceeded, while the call continues (the query is not aborted, unlike with a
+// context deadline). For [Query], only the query is timed, not the iteration of the rows.
+//
+// slow is called from another goroutine. The timer is stopped when the call returns: nothing is
+// left behind by fast calls.
+//
+// WithSlowQueryThreshold is implemented as a [Middleware], in the order of the options.
+func WithSlowQueryThreshold(d time.Duration, slow func(query string, dur time.Duration)) Option {
+	if slow == nil {
+		panic("slow must not be nil")
+	}
+	return WithMiddleware(func(next CallFunc) CallFunc {
+		return func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			query := CallQuery(ctx)
+			start := time.Now()
+			timer := time.AfterFunc(d, func() {
+				slow(query, time.Since(start))
+			})
+			defer timer.Stop()
+			return next(ctx, args)
+		}
+	})
+}
+
+type callQueryKey struct{}
+
+// CallQuery returns the query of the statement called, from the context given to a [Middleware].
+func CallQuery(ctx context.Context) string {
+	query, _ := ctx.Value(callQueryKey{}).(string)
+	return query
+}
+
+// chain wraps call with the middlewares.
+func (o *options) chain(call CallFunc) CallFunc {
+	for i := len(o.middlewares) - 1; i >= 0; i-- {
+		call = o.middlewares[i](call)
+	}
+	return call
+}
+
+// exec runs [stmtTarget.exec] through the middlewares.
+func (o *options) exec(ctx context.Context, t *stmtTarget, args []interface{}) (sql.Result, error) {
+	if o.middlewares == nil {
+		return t.exec(ctx, args)
+	}
+	results, err := o.chain(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+		r, err := t.exec(ctx, args)
+		return []interface{}{r}, err
+	})(context.WithValue(ctx, callQueryKey{}, t.query), args)
+	var r sql.Result
+	if len(results) > 0 {
+		r, _ = results[0].(sql.Result)
+	}
+	return r, err
+}
+
+// queryRowScan runs [stmtTarget.scanRow] through the middlewares, after [WithExplain].
+// values are the settable values filled by scanners.
+func (o *options) queryRowScan(ctx context.Context, t *stmtTarget, args []interface{}, scanners []interface{}, values []reflect.Value, anyCols []int, cc *columnsCheck) error {
+	o.runExplain(ctx, t, args)
+	if o.middlewares == nil {
+		return t.scanRow(ctx, args, scanners, anyCols, cc)
+	}
+	results, err := o.chain(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+		if err := t.scanRow(ctx, args, scanners, anyCols, cc); err != nil {
+			return nil, err
+		}
+		results := make([]interface{}, len(values))
+		for i, v := range values {
+			results[i] = v.Interface()
+		}
+		return results, nil
+	})(context.WithValue(ctx, callQueryKey{}, t.query), args)
+	if err != nil {
+		return err
+	}
+	for i, v := range values {
+		if r := reflect.ValueOf(results[i]); r.IsValid() {
+			v.Set(r)
+		} else {
+			v.Set(reflect.Zero(v.Type()))
+		}
+	}
+	return nil
+}
+
+// queryRows runs [stmtTarget.queryRows] through the middlewares, after [WithExplain].
+func (o *options) queryRows(ctx context.Context, t *stmtTarget, args []interface{}) (*sql.Rows, error) {
+	o.runExplain(ctx, t, args)
+	if o.middlewares == nil {
+		return t.queryRows(ctx, args)
+	}
+	results, err := o.chain(func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+		rows, err := t.queryRows(ctx, args)
+		return []interface{}{rows}, err
+	})(context.WithValue(ctx, callQueryKey{}, t.query), args)
+	var rows *sql.Rows
+	if len(results) > 0 {
+		rows, _ = results[0].(*sql.Rows)
+	}
+	return rows, err
+}
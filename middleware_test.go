@@ -0,0 +1,216 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func ExampleWithMiddleware() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	logging := func(next sqlfunc.CallFunc) sqlfunc.CallFunc {
+		return func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			fmt.Println("query:", sqlfunc.RenderQuery(sqlfunc.CallQuery(ctx), args))
+			results, err := next(ctx, args)
+			fmt.Println("results:", results, err)
+			return results, err
+		}
+	}
+	var calls int
+	counting := func(next sqlfunc.CallFunc) sqlfunc.CallFunc {
+		return func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			calls++
+			return next(ctx, args)
+		}
+	}
+
+	g := sqlfunc.NewGroup(db)
+	defer g.Close()
+	g.Use(logging, counting)
+
+	var queryByName func(ctx context.Context, name string) (lat, lon float64, err error)
+	if err = g.QueryRow(ctx, `SELECT lat, lon FROM poi WHERE name = ?`, &queryByName); err != nil {
+		fmt.Println("QueryRow:", err)
+		return
+	}
+
+	lat, lon, err := queryByName(ctx, "Château de Versailles")
+	if err != nil {
+		fmt.Println("queryByName:", err)
+		return
+	}
+	fmt.Printf("(%.4f %.4f)\n", lat, lon)
+	fmt.Println("calls:", calls)
+
+	// Output:
+	// query: SELECT lat, lon FROM poi WHERE name = 'Château de Versailles'
+	// results: [48.8016 2.1204] <nil>
+	// (48.8016 2.1204)
+	// calls: 1
+}
+
+func TestWithMiddleware(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	// retry retries once on errRetry
+	errRetry := errors.New("retry")
+	var attempts int
+	retry := func(next sqlfunc.CallFunc) sqlfunc.CallFunc {
+		return func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			results, err := next(ctx, args)
+			if errors.Is(err, errRetry) {
+				results, err = next(ctx, args)
+			}
+			return results, err
+		}
+	}
+	flaky := func(next sqlfunc.CallFunc) sqlfunc.CallFunc {
+		return func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			attempts++
+			if attempts == 1 {
+				return nil, errRetry
+			}
+			return next(ctx, args)
+		}
+	}
+	// double alters the argument
+	double := func(next sqlfunc.CallFunc) sqlfunc.CallFunc {
+		return func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			return next(ctx, []interface{}{args[0].(int) * 2})
+		}
+	}
+	opt := sqlfunc.WithMiddleware(retry, flaky, double)
+
+	var exec func(ctx context.Context, n int) (sql.Result, error)
+	closeExec, err := sqlfunc.Exec(ctx, db, `SELECT ?`, &exec, opt)
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	defer closeExec()
+	if _, err = exec(ctx, 1); err != nil || attempts != 2 {
+		t.Errorf("exec: %d attempts, %v", attempts, err)
+	}
+
+	attempts = 0
+	var queryRow func(ctx context.Context, n int) (int, *string, error)
+	closeQueryRow, err := sqlfunc.QueryRow(ctx, db, `SELECT ?, NULL`, &queryRow, opt)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeQueryRow()
+	if n, s, err := queryRow(ctx, 21); err != nil || n != 42 || s != nil || attempts != 2 {
+		t.Errorf("queryRow: got %d, %v, %v (%d attempts)", n, s, err, attempts)
+	}
+
+	attempts = 0
+	var query func(ctx context.Context, n int) (*sql.Rows, error)
+	closeQuery, err := sqlfunc.Query(ctx, db, `SELECT ?`, &query, opt)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer closeQuery()
+	rows, err := query(ctx, 5)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	var values []int
+	if err = sqlfunc.ForEach(rows, func(n int) { values = append(values, n) }); err != nil || len(values) != 1 || values[0] != 10 {
+		t.Errorf("query: got %v, %v", values, err)
+	}
+}
+
+func ExampleWithSlowQueryThreshold() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	logSlow := func(query string, dur time.Duration) {
+		// A real application would log dur
+		fmt.Println("slow query:", query)
+	}
+
+	// Simulate a loaded server
+	slowServer := func(next sqlfunc.CallFunc) sqlfunc.CallFunc {
+		return func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			time.Sleep(100 * time.Millisecond)
+			return next(ctx, args)
+		}
+	}
+
+	var countPOI func(ctx context.Context) (int, error)
+	closeCount, err := sqlfunc.QueryRow(ctx, db, `SELECT COUNT(*) FROM poi`, &countPOI,
+		sqlfunc.WithSlowQueryThreshold(10*time.Millisecond, logSlow),
+		sqlfunc.WithMiddleware(slowServer),
+	)
+	if err != nil {
+		fmt.Println("QueryRow:", err)
+		return
+	}
+	defer closeCount()
+
+	var queryByName func(ctx context.Context, name string) (lat, lon float64, err error)
+	closeByName, err := sqlfunc.QueryRow(ctx, db, `SELECT lat, lon FROM poi WHERE name = ?`, &queryByName,
+		sqlfunc.WithSlowQueryThreshold(time.Minute, logSlow),
+	)
+	if err != nil {
+		fmt.Println("QueryRow:", err)
+		return
+	}
+	defer closeByName()
+
+	n, err := countPOI(ctx)
+	if err != nil {
+		fmt.Println("countPOI:", err)
+		return
+	}
+	fmt.Println("count:", n)
+
+	lat, lon, err := queryByName(ctx, "Château de Versailles")
+	if err != nil {
+		fmt.Println("queryByName:", err)
+		return
+	}
+	fmt.Printf("(%.4f %.4f)\n", lat, lon)
+
+	// Output:
+	// slow query: SELECT COUNT(*) FROM poi
+	// count: 2
+	// (48.8016 2.1204)
+}
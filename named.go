@@ -0,0 +1,90 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// NamedStmts is a registry of statements that can be looked up by name at runtime, for
+// architectures where queries are referenced by a key (plugins, configuration...).
+//
+// Statements are prepared on the same [PrepareConn] and released all at once by [NamedStmts.CloseAll]
+// (as with a [Group]). Each func is set in its bound variable and is also available with
+// [NamedStmts.Get] (or [GetNamed] for a typed access).
+//
+// NamedStmts is safe for concurrent use.
+//
+// Example:
+//
+//	stmts := sqlfunc.NewNamedStmts(db)
+//	defer stmts.CloseAll()
+//
+//	var countPOI func(ctx context.Context) (int64, error)
+//	err := stmts.Register(ctx, "countPOI", sqlfunc.GroupQueryRow(`SELECT COUNT(*) FROM poi`, &countPOI))
+//	// if err != nil ...
+//
+//	count := stmts.Get("countPOI").(func(ctx context.Context) (int64, error))
+type NamedStmts struct {
+	g        Group
+	register sync.Mutex // serializes Register
+	funcs    sync.Map   // map[string]interface{}
+}
+
+// NewNamedStmts returns a [NamedStmts] that prepares statements on db.
+func NewNamedStmts(db PrepareConn) *NamedStmts {
+	return &NamedStmts{g: Group{db: db}}
+}
+
+// Register prepares stmt (see [GroupExec], [GroupQueryRow] and [GroupQuery]) and registers
+// the func under name. Registering a name twice is an error.
+func (n *NamedStmts) Register(ctx context.Context, name string, stmt GroupStmt) error {
+	n.register.Lock()
+	defer n.register.Unlock()
+	if _, exists := n.funcs.Load(name); exists {
+		return fmt.Errorf("sqlfunc: statement %q already registered", name)
+	}
+	if err := n.g.add(stmt.prepare(ctx, &n.g)); err != nil {
+		return err
+	}
+	n.funcs.Store(name, reflect.ValueOf(stmt.fnPtr).Elem().Interface())
+	return nil
+}
+
+// Get returns the func registered under name, or nil if name is unknown.
+// The caller asserts the func type.
+func (n *NamedStmts) Get(name string) interface{} {
+	fn, _ := n.funcs.Load(name)
+	return fn
+}
+
+// CloseAll closes all the statements and unregisters them.
+//
+// The registered funcs will then return [ErrClosed], as will Register.
+// The first error from closing a statement is returned.
+func (n *NamedStmts) CloseAll() error {
+	n.register.Lock()
+	n.funcs.Range(func(name, _ interface{}) bool {
+		n.funcs.Delete(name)
+		return true
+	})
+	n.register.Unlock()
+	return n.g.Close()
+}
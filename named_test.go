@@ -0,0 +1,104 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func TestNamedStmts(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	stmts := sqlfunc.NewNamedStmts(db)
+	defer stmts.CloseAll()
+
+	type addFunc = func(ctx context.Context, n int) (int, error)
+
+	// Concurrent registrations and lookups
+	const count = 20
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var add addFunc
+			name := fmt.Sprint("add", i)
+			if err := stmts.Register(ctx, name, sqlfunc.GroupQueryRow(fmt.Sprintf(`SELECT ? + %d`, i), &add)); err != nil {
+				t.Errorf("Register %s: %v", name, err)
+				return
+			}
+			if n, err := add(ctx, 1); err != nil || n != i+1 {
+				t.Errorf("%s: got %d, %v", name, n, err)
+			}
+			// Lookup of another statement, which may not be registered yet
+			if fn := stmts.Get(fmt.Sprint("add", (i+1)%count)); fn != nil {
+				if _, err := fn.(addFunc)(ctx, 1); err != nil {
+					t.Errorf("Get: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	add5, ok := sqlfunc.GetNamed[addFunc](stmts, "add5")
+	if !ok {
+		t.Fatal("add5 not found")
+	}
+	if n, err := add5(ctx, 10); err != nil || n != 15 {
+		t.Errorf("add5: got %d, %v; expected 15", n, err)
+	}
+	if _, ok = sqlfunc.GetNamed[func(ctx context.Context) (int, error)](stmts, "add5"); ok {
+		t.Error("GetNamed with wrong type should fail")
+	}
+	if stmts.Get("unknown") != nil {
+		t.Error("Get of unknown name should return nil")
+	}
+
+	var dup addFunc
+	if err = stmts.Register(ctx, "add1", sqlfunc.GroupQueryRow(`SELECT ?`, &dup)); err == nil {
+		t.Error("error expected for duplicate name")
+	}
+
+	if err = stmts.CloseAll(); err != nil {
+		t.Fatalf("CloseAll: %v", err)
+	}
+	if _, err = add5(ctx, 1); !errors.Is(err, sqlfunc.ErrClosed) {
+		t.Errorf("after CloseAll: got %v, expected %v", err, sqlfunc.ErrClosed)
+	}
+	if stmts.Get("add5") != nil {
+		t.Error("add5 still registered after CloseAll")
+	}
+	var late addFunc
+	if err = stmts.Register(ctx, "late", sqlfunc.GroupQueryRow(`SELECT ?`, &late)); !errors.Is(err, sqlfunc.ErrClosed) {
+		t.Errorf("Register after CloseAll: got %v, expected %v", err, sqlfunc.ErrClosed)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// ExecOnce prepares query, executes it once with args and closes the statement.
+//
+// This is a shortcut for one-off statements (scripts, migrations) that avoids declaring a func
+// variable for [Exec]. The registered converters are applied to args. The statement is closed
+// before returning, even on error.
+//
+// Statements executed many times should use [Exec] instead.
+func ExecOnce(ctx context.Context, db PrepareConn, query string, args ...interface{}) (sql.Result, error) {
+	args, err := bindValues(args)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	return stmt.ExecContext(ctx, args...)
+}
+
+// QueryRowOnce prepares query, executes it once with args, scans the first row into dest and
+// closes the statement.
+//
+// This is a shortcut for one-off queries that avoids declaring a func variable for [QueryRow].
+// The registered converters are applied to args and dest. As with [sql.Row.Scan],
+// [sql.ErrNoRows] is returned if the query returns no rows. The statement is closed before
+// returning, even on error.
+func QueryRowOnce(ctx context.Context, db PrepareConn, query string, args []interface{}, dest ...interface{}) error {
+	args, err := bindValues(args)
+	if err != nil {
+		return err
+	}
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	scanners := make([]interface{}, len(dest))
+	for i, d := range dest {
+		scanners[i] = scanner(reflect.ValueOf(d))
+	}
+	return stmt.QueryRowContext(ctx, args...).Scan(scanners...)
+}
+
+// bindValues applies the registered converters to args.
+func bindValues(args []interface{}) ([]interface{}, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	values := make([]interface{}, len(args))
+	for i, a := range args {
+		if a == nil {
+			continue
+		}
+		v, err := bindArg(reflect.ValueOf(a))
+		if err != nil {
+			return nil, fmt.Errorf("sqlfunc: converting argument %d: %w", i+1, err)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
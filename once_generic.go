@@ -0,0 +1,215 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// QueryRowValue prepares query, executes it once with args and returns the single column of
+// the first row as a T, such as the result of SELECT COUNT(*) or a single field. It is the
+// generic form of [QueryRowOnce] for scalar lookups:
+//
+//	n, err := sqlfunc.QueryRowValue[int64](ctx, db, `SELECT COUNT(*) FROM poi WHERE lat > ?`, 48.0)
+//
+// The statement is closed before returning, so QueryRowValue is for one-off queries: queries
+// run many times should use [QueryRow] (or [PrepareQueryRow]) to keep the statement prepared.
+// The registered converters are applied to args and to the result.
+//
+// If the query returns no rows, the zero value of T and [sql.ErrNoRows] are returned.
+func QueryRowValue[T any](ctx context.Context, db PrepareConn, query string, args ...any) (T, error) {
+	var v T
+	if err := QueryRowOnce(ctx, db, query, args, &v); err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+// Select prepares query, executes it once with args and returns all the rows scanned into
+// values of type T. If T is a struct, columns are matched to fields by name, honoring sql tags;
+// use pointer fields to handle NULL values. See [ScanPtr] for the scanning rules.
+//
+//	var pois []POI
+//	pois, err := sqlfunc.Select[POI](ctx, db, `SELECT name, lat, lon FROM poi WHERE lat > ?`, 48.0)
+//
+// The matching of the columns to the fields of T is cached by type and set of columns.
+// The rows and the statement are closed before returning. As with [QueryRowValue], the registered
+// converters are applied to args.
+//
+// An empty result is not an error: an empty non-nil slice is returned.
+func Select[T any](ctx context.Context, db PrepareConn, query string, args ...any) ([]T, error) {
+	args, err := bindValues(args)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	values := []T{}
+	if err = ScanAll(rows, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// QueryValues prepares query, executes it once with args and returns the single column of all
+// the rows as a []T, such as a list of ids:
+//
+//	ids, err := sqlfunc.QueryValues[int64](ctx, db, `SELECT id FROM poi WHERE lat > ?`, 48.0)
+//
+// The query must return exactly one column (even if T is a struct): this is the multi-row
+// counterpart of [QueryRowValue], as [QueryRow] and [QueryRowValue] only scan the first row.
+// Use a pointer type for T to handle NULL values.
+//
+// An empty result is not an error: an empty non-nil slice is returned. The registered converters
+// are applied to args and to the values. The rows and the statement are closed before returning.
+func QueryValues[T any](ctx context.Context, db PrepareConn, query string, args ...any) ([]T, error) {
+	args, err := bindValues(args)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) != 1 {
+		return nil, fmt.Errorf("sqlfunc: QueryValues expects 1 column, got %d", len(columns))
+	}
+	values := []T{}
+	var v T
+	dest := scanner(reflect.ValueOf(&v))
+	for rows.Next() {
+		var zero T
+		v = zero
+		if err = rows.Scan(dest); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return values, rows.Close()
+}
+
+// NamedQueryRow prepares query, executes it once with the named placeholders (":name" or
+// "@name") bound from the fields of v, and scans the first row into a R. This is the
+// insert-and-get-back pattern of queries with a RETURNING clause:
+//
+//	type newPOI struct {
+//		Name     string
+//		Lat, Lon float64
+//	}
+//	type created struct {
+//		ID        int64
+//		CreatedAt time.Time `sql:"created_at"`
+//	}
+//	res, err := sqlfunc.NamedQueryRow[newPOI, created](ctx, db,
+//		`INSERT INTO poi (name, lat, lon) VALUES (:name, :lat, :lon) RETURNING id, created_at`, poi)
+//
+// T is a struct (or a pointer to a struct). The names are matched to the fields of T as column
+// names are (case-insensitively, honoring sql tags and embedded structs). The placeholders of
+// the query must all be named: they are replaced with positional placeholders ("$N" for the
+// Postgres drivers github.com/lib/pq and github.com/jackc/pgx, "?" otherwise) so the driver
+// doesn't need to support named parameters. The driver of an [*sql.Tx] can't be determined:
+// give [WithDollarPlaceholders] for Postgres drivers. The registered converters are applied to the
+// values of the fields.
+//
+// See [ScanPtr] for the scanning rules of R. If the query returns no rows, the zero value of R
+// and [sql.ErrNoRows] are returned. The statement is closed before returning.
+func NamedQueryRow[T, R any](ctx context.Context, db PrepareConn, query string, v T, opts ...Option) (R, error) {
+	var r R
+	args, query, err := namedStructArgs(query, newOptions(opts).dollarPlaceholders(db), reflect.ValueOf(&v).Elem())
+	if err != nil {
+		return r, err
+	}
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return r, err
+	}
+	defer stmt.Close()
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return r, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = sql.ErrNoRows
+		}
+		return r, err
+	}
+	if err = ScanPtr(rows, &r); err != nil {
+		var zero R
+		return zero, err
+	}
+	return r, rows.Close()
+}
+
+// namedStructArgs rewrites the named placeholders of query to positional ones ("$N" if dollar)
+// and returns the values of the matching fields of v, a struct or a pointer to a struct.
+func namedStructArgs(query string, dollar bool, v reflect.Value) ([]any, string, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, "", fmt.Errorf("sqlfunc: nil %v", v.Type())
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		panic("T must be a struct or a pointer to a struct")
+	}
+	query, names, err := positionalQuery(query, dollar)
+	if err != nil {
+		return nil, "", err
+	}
+	fields := structFields(v.Type())
+	args := make([]any, len(names))
+	for i, name := range names {
+		path, ok := fields[strings.ToLower(name)]
+		if !ok {
+			return nil, "", fmt.Errorf("sqlfunc: named parameter %q has no matching field in %v", name, v.Type())
+		}
+		if args[i], err = bindArg(v.FieldByIndex(path)); err != nil {
+			return nil, "", fmt.Errorf("sqlfunc: converting named parameter %q: %w", name, err)
+		}
+	}
+	return args, query, nil
+}
@@ -0,0 +1,321 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func ExampleQueryRowValue() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	n, err := sqlfunc.QueryRowValue[int64](ctx, db, `SELECT COUNT(*) FROM poi WHERE lat > ?`, 48.0)
+	if err != nil {
+		fmt.Println("QueryRowValue:", err)
+		return
+	}
+	fmt.Println(n)
+
+	// Output:
+	// 1
+}
+
+func TestQueryRowValueNoRows(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	name, err := sqlfunc.QueryRowValue[string](ctx, db, `SELECT 'a' WHERE 1 = ?`, 0)
+	if !errors.Is(err, sql.ErrNoRows) || name != "" {
+		t.Errorf("got %q, %v; expected %v", name, err, sql.ErrNoRows)
+	}
+	exists, err := sqlfunc.QueryRowValue[bool](ctx, db, `SELECT EXISTS (SELECT 1 WHERE 1 = ?)`, 1)
+	if err != nil || !exists {
+		t.Errorf("got %v, %v", exists, err)
+	}
+}
+
+func ExampleSelect() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	type POI struct {
+		Name string
+		Lat  float64 `sql:"lat"`
+		Lon  float64 `sql:"lon"`
+	}
+
+	pois, err := sqlfunc.Select[POI](ctx, db, `SELECT name, lat, lon FROM poi ORDER BY name`)
+	if err != nil {
+		fmt.Println("Select:", err)
+		return
+	}
+	for _, p := range pois {
+		fmt.Printf("%s (%.4f %.4f)\n", p.Name, p.Lat, p.Lon)
+	}
+
+	// Output:
+	// Château de Versailles (48.8016 2.1204)
+	// Villeperdue (47.2009 0.6317)
+}
+
+func TestSelect(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE person (id INTEGER, name TEXT, email TEXT, age INTEGER)`); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err = db.ExecContext(ctx, `INSERT INTO person VALUES (1, 'Alice', 'alice@example.com', 30), (2, 'Bob', NULL, NULL)`); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	type person struct {
+		ID    int64
+		Name  string `sql:"name"`
+		Email *string
+		Age   *int
+		Notes string // not selected
+	}
+
+	people, err := sqlfunc.Select[person](ctx, db, `SELECT id, name, email, age FROM person ORDER BY id`)
+	if err != nil {
+		t.Fatalf("Select: %v", err)
+	}
+	if len(people) != 2 {
+		t.Fatalf("got %d rows", len(people))
+	}
+	if p := people[0]; p.ID != 1 || p.Name != "Alice" || p.Email == nil || *p.Email != "alice@example.com" || p.Age == nil || *p.Age != 30 {
+		t.Errorf("row 1: got %+v", p)
+	}
+	if p := people[1]; p.ID != 2 || p.Name != "Bob" || p.Email != nil || p.Age != nil {
+		t.Errorf("row 2: got %+v", p)
+	}
+
+	// Subset of columns, in another order: the plan is cached by set of columns
+	for i := 0; i < 2; i++ {
+		people, err = sqlfunc.Select[person](ctx, db, `SELECT name, id FROM person WHERE id = ?`, 2)
+		if err != nil {
+			t.Fatalf("Select subset: %v", err)
+		}
+		if len(people) != 1 || people[0].ID != 2 || people[0].Name != "Bob" || people[0].Email != nil {
+			t.Errorf("subset: got %+v", people)
+		}
+	}
+
+	// No rows: empty slice, no error
+	people, err = sqlfunc.Select[person](ctx, db, `SELECT id, name FROM person WHERE id = ?`, 3)
+	if err != nil || people == nil || len(people) != 0 {
+		t.Errorf("no rows: got %#v, %v", people, err)
+	}
+
+	// NULL into a non-pointer field
+	if _, err = sqlfunc.Select[person](ctx, db, `SELECT id, age AS name FROM person WHERE id = 2`); err == nil {
+		t.Error("NULL into string: error expected")
+	}
+
+	// Unknown column
+	if _, err = sqlfunc.Select[person](ctx, db, `SELECT id, 1 AS unknown FROM person`); err == nil {
+		t.Error("unknown column: error expected")
+	}
+
+	// Single column into a scalar
+	ids, err := sqlfunc.Select[int64](ctx, db, `SELECT id FROM person ORDER BY id DESC`)
+	if err != nil || len(ids) != 2 || ids[0] != 2 || ids[1] != 1 {
+		t.Errorf("scalar: got %v, %v", ids, err)
+	}
+}
+
+func ExampleNamedQueryRow() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE poi (`+
+		`id INTEGER PRIMARY KEY, name TEXT, lat DECIMAL, lon DECIMAL,`+
+		` created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP)`)
+	if err != nil {
+		fmt.Println("Create:", err)
+		return
+	}
+
+	type newPOI struct {
+		Name     string
+		Lat, Lon float64
+	}
+	type created struct {
+		ID        int64
+		CreatedAt time.Time `sql:"created_at"`
+	}
+
+	for _, poi := range []newPOI{
+		{Name: "Château de Versailles", Lat: 48.8016, Lon: 2.1204},
+		{Name: "Villeperdue", Lat: 47.2009, Lon: 0.6317},
+	} {
+		res, err := sqlfunc.NamedQueryRow[newPOI, created](ctx, db,
+			`INSERT INTO poi (name, lat, lon) VALUES (:name, :lat, :lon) RETURNING id, created_at`, poi)
+		if err != nil {
+			fmt.Println("NamedQueryRow:", err)
+			return
+		}
+		fmt.Println(res.ID, time.Since(res.CreatedAt) < time.Hour)
+	}
+
+	// Output:
+	// 1 true
+	// 2 true
+}
+
+func TestNamedQueryRow(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	type args struct {
+		A int
+		B string `sql:"bee"`
+	}
+
+	// Scalar result, repeated name
+	sum, err := sqlfunc.NamedQueryRow[args, int](ctx, db, `SELECT :a + :A`, args{A: 21})
+	if err != nil || sum != 42 {
+		t.Errorf("got %d, %v", sum, err)
+	}
+
+	// Pointer to struct, tag
+	s, err := sqlfunc.NamedQueryRow[*args, string](ctx, db, `SELECT @bee`, &args{B: "b"})
+	if err != nil || s != "b" {
+		t.Errorf("got %q, %v", s, err)
+	}
+
+	// No rows
+	if _, err = sqlfunc.NamedQueryRow[args, int](ctx, db, `SELECT :a WHERE 0`, args{}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("no rows: got %v", err)
+	}
+
+	// Unknown field
+	if _, err = sqlfunc.NamedQueryRow[args, int](ctx, db, `SELECT :c`, args{}); err == nil {
+		t.Error("unknown field: error expected")
+	}
+
+	// Positional placeholder
+	if _, err = sqlfunc.NamedQueryRow[args, int](ctx, db, `SELECT :a, ?`, args{}); err == nil {
+		t.Error("positional placeholder: error expected")
+	}
+
+	// In a transaction, with the placeholder style given
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	defer tx.Rollback()
+	conn := &queriesConn{PrepareConn: tx}
+	sum, err = sqlfunc.NamedQueryRow[args, int](ctx, conn, `SELECT :a + :a`, args{A: 2}, sqlfunc.WithDollarPlaceholders())
+	if err != nil || sum != 4 {
+		t.Errorf("got %d, %v", sum, err)
+	}
+	if len(conn.queries) != 1 || conn.queries[0] != `SELECT $1 + $1` {
+		t.Errorf("got queries %q", conn.queries)
+	}
+
+	// nil pointer
+	if _, err = sqlfunc.NamedQueryRow[*args, int](ctx, db, `SELECT :a`, nil); err == nil {
+		t.Error("nil: error expected")
+	}
+}
+
+func ExampleQueryValues() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	names, err := sqlfunc.QueryValues[string](ctx, db, `SELECT name FROM poi WHERE lat > ? ORDER BY name`, 0.0)
+	if err != nil {
+		fmt.Println("QueryValues:", err)
+		return
+	}
+	fmt.Printf("%q\n", names)
+
+	_, err = sqlfunc.QueryValues[string](ctx, db, `SELECT name, lat FROM poi`)
+	fmt.Println(err)
+
+	// Output:
+	// ["Château de Versailles" "Villeperdue"]
+	// sqlfunc: QueryValues expects 1 column, got 2
+}
+
+func TestQueryValues(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	values, err := sqlfunc.QueryValues[*int](ctx, db, `SELECT 1 UNION ALL SELECT NULL UNION ALL SELECT ?`, 3)
+	if err != nil || len(values) != 3 || values[0] == nil || *values[0] != 1 || values[1] != nil || values[2] == nil || *values[2] != 3 {
+		t.Errorf("got %v, %v", values, err)
+	}
+
+	empty, err := sqlfunc.QueryValues[int](ctx, db, `SELECT 1 WHERE 0`)
+	if err != nil || empty == nil || len(empty) != 0 {
+		t.Errorf("no rows: got %#v, %v", empty, err)
+	}
+
+	if _, err = sqlfunc.QueryValues[int](ctx, db, `SELECT NULL`); err == nil {
+		t.Error("NULL into int: error expected")
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func ExampleExecOnce() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	for _, query := range []string{
+		`CREATE TABLE poi (lat DECIMAL, lon DECIMAL, name VARCHAR(255))`,
+		`INSERT INTO poi (lat, lon, name) VALUES (48.8016, 2.1204, 'Château de Versailles')`,
+	} {
+		if _, err = sqlfunc.ExecOnce(ctx, db, query); err != nil {
+			fmt.Println("ExecOnce:", err)
+			return
+		}
+	}
+
+	res, err := sqlfunc.ExecOnce(ctx, db, `UPDATE poi SET name = ? WHERE name LIKE ?`, "Versailles", "Château%")
+	if err != nil {
+		fmt.Println("ExecOnce:", err)
+		return
+	}
+	n, _ := res.RowsAffected()
+	fmt.Println("Updated:", n)
+
+	var name string
+	var lat float64
+	err = sqlfunc.QueryRowOnce(ctx, db, `SELECT name, lat FROM poi WHERE lon > ?`, []interface{}{2}, &name, &lat)
+	if err != nil {
+		fmt.Println("QueryRowOnce:", err)
+		return
+	}
+	fmt.Println(name, lat)
+
+	// Output:
+	// Updated: 1
+	// Versailles 48.8016
+}
+
+func TestQueryRowOnceErrors(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	var n int
+	err = sqlfunc.QueryRowOnce(ctx, db, `SELECT 1 WHERE 1 = ?`, []interface{}{0}, &n)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("got %v, expected sql.ErrNoRows", err)
+	}
+
+	if err = sqlfunc.QueryRowOnce(ctx, db, `SELEKT 1`, nil, &n); err == nil {
+		t.Error("error expected for invalid query")
+	}
+}
@@ -0,0 +1,708 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Option configures the behavior of the functions of this package.
+//
+// Each option documents the functions that use it. Options are ignored by the other functions.
+type Option func(*options)
+
+// options holds the settings that control how statements are prepared and how the
+// generated functions behave.
+type options struct {
+	// closed is set by a Group: non-zero once the group is closed.
+	closed *uint32
+
+	defaultTimeout time.Duration
+
+	afterScan func([]interface{}) error
+
+	errorQuery bool
+
+	allowedColumns map[string]struct{} // lowercased
+
+	withoutPrepare bool
+
+	checkColumnTypes bool
+
+	argsCheck func(interface{}) error
+
+	location *time.Location
+
+	stmtInfo *StmtInfo
+
+	withoutClose bool
+
+	middlewares []Middleware
+
+	autoReprepare bool
+
+	countQuery string
+
+	nullAsZero bool
+
+	expectedColumns []string
+
+	concurrency int
+
+	allocator func(reflect.Type) reflect.Value
+
+	explain func(plan string)
+
+	columnMapping []int
+
+	noTxArg bool
+
+	limits map[string]int64 // keyword ("LIMIT", "OFFSET") => value
+
+	rowMetrics func(rows int, bytes int64)
+
+	rowTimeout time.Duration
+
+	nullDefaults map[reflect.Type]reflect.Value
+
+	stmtPool int
+
+	dollar bool
+}
+
+// connOptions returns a copy of o limited to the options related to the connection
+// (not to the query or its results).
+func (o *options) connOptions() *options {
+	return &options{
+		closed:         o.closed,
+		defaultTimeout: o.defaultTimeout,
+		errorQuery:     o.errorQuery,
+		withoutPrepare: o.withoutPrepare,
+		argsCheck:      o.argsCheck,
+		withoutClose:   o.withoutClose,
+		autoReprepare:  o.autoReprepare,
+		noTxArg:        o.noTxArg,
+		stmtPool:       o.stmtPool,
+		dollar:         o.dollar,
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithDefaultTimeout sets a timeout for the calls of the functions created by [Exec],
+// [QueryRow] and [Query] when the context given to the call has no deadline.
+//
+// A deadline already set on the context of the call, shorter or longer, is kept unchanged.
+//
+// For [Query], the timeout also covers the iteration of the returned [*database/sql.Rows],
+// so it applies only to funcs returning a stop func (see [Query]): the timeout is released
+// by stop. Closing the rows can't release it, so the other funcs created by [Query] ignore
+// the default timeout.
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.defaultTimeout = d
+	}
+}
+
+// withDefaultTimeout applies the default timeout to ctx if it has no deadline.
+// The returned cancel func is never nil.
+func (o *options) withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.defaultTimeout > 0 {
+		if _, ok := ctx.Deadline(); !ok {
+			return context.WithTimeout(ctx, o.defaultTimeout)
+		}
+	}
+	return ctx, func() {}
+}
+
+func (o *options) isClosed() bool {
+	return o.closed != nil && atomic.LoadUint32(o.closed) != 0
+}
+
+// WithAfterScan sets a hook called by [ForEach] after each row is scanned and before the callback
+// is called.
+//
+// The hook receives the scanned values (the values that will be given to the callback).
+// Unlike the callback, which handles the values of a given query, the hook is meant for
+// cross-cutting processing of rows such as validation or logging.
+// If the hook returns an error, iteration stops (the callback isn't called for that row) and
+// the error is returned by [ForEach].
+func WithAfterScan(hook func(values []interface{}) error) Option {
+	return func(o *options) {
+		o.afterScan = hook
+	}
+}
+
+// WithRowMetrics sets a func called by [ForEach] (and its variants [ForEachContext],
+// [ForEachCancelable], [ForEachCloseErr] and [ForEachBuf]) once the iteration is over, with the
+// number of rows scanned and the approximate number of bytes read: the sum of the lengths of
+// the string and []byte values scanned (including through pointers, interface{} and
+// [sql.NullString]). Other values are not counted.
+//
+// report is called even if the iteration stops early or fails, with the rows scanned until then.
+// The metrics are not collected when the option is not set.
+//
+// The rows returned by the functions created by [Query] are iterated by the caller, so to
+// collect their metrics give WithRowMetrics to [ForEach].
+func WithRowMetrics(report func(rows int, bytes int64)) Option {
+	return func(o *options) {
+		o.rowMetrics = report
+	}
+}
+
+// WithRowTimeout sets the maximum duration of the scan of each row by [ForEach] (and its
+// variants [ForEachContext], [ForEachCancelable], [ForEachCloseErr] and [ForEachBuf]), for
+// drivers that may block inside [database/sql.Rows.Scan] (streaming large objects, for example).
+// If the scan of a row exceeds d, the iteration stops with [ErrRowTimeout].
+//
+// As Scan isn't context-aware, each row is scanned in a new goroutine. After a timeout, that
+// goroutine (and the connection held by rows) is released only once Scan returns: rows are then
+// closed by that goroutine (unless [WithoutClose] is given, in which case closing rows blocks
+// until Scan returns). To really abort the transfer, use a query context that can be canceled.
+// d <= 0 disables the timeout.
+func WithRowTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.rowTimeout = d
+	}
+}
+
+// WithErrorQuery enables the wrapping of the errors returned by the functions created by [Exec],
+// [QueryRow] and [Query] into a [*QueryError] that gives access to the query.
+//
+// The original error is still available with [errors.Is] and [errors.As]:
+//
+//	if errors.Is(err, sql.ErrNoRows) {
+func WithErrorQuery(enable bool) Option {
+	return func(o *options) {
+		o.errorQuery = enable
+	}
+}
+
+// queryError wraps err into a [*QueryError] if enabled.
+func (o *options) queryError(query string, err error) error {
+	if err == nil || !o.errorQuery {
+		return err
+	}
+	return &QueryError{query: query, err: err}
+}
+
+// WithAllowedColumns restricts the columns accepted when scanning a row into a struct
+// with [ScanOne], [ScanPtr], [ScanAll] and [ForEachT]: scanning fails if the row has a column not in the list.
+//
+// This is a guard against schema drift silently feeding unexpected data into structs.
+// Column names are compared case-insensitively.
+func WithAllowedColumns(columns []string) Option {
+	return func(o *options) {
+		o.allowedColumns = make(map[string]struct{}, len(columns))
+		for _, c := range columns {
+			o.allowedColumns[strings.ToLower(c)] = struct{}{}
+		}
+	}
+}
+
+// checkColumns checks columns against the allowed columns.
+func (o *options) checkColumns(columns []string) error {
+	if o.allowedColumns == nil {
+		return nil
+	}
+	for _, c := range columns {
+		if _, ok := o.allowedColumns[strings.ToLower(c)]; !ok {
+			return fmt.Errorf("sqlfunc: unexpected column %q", c)
+		}
+	}
+	return nil
+}
+
+// WithColumnMapping sets the fields of the struct that receive the columns when scanning a row
+// into a struct with [ScanOne], [ScanPtr], [ScanAll] and [ForEachT]: column i is scanned into
+// the field of index mapping[i] (see [reflect.Type.Field]), instead of the field matching the
+// name of the column.
+//
+// This is for queries whose column names are ambiguous (such as the same name from two joined
+// tables) or absent (expressions). The mapping is checked against the columns of the first row:
+// the length of mapping must be the number of columns and the fields must be exported.
+func WithColumnMapping(mapping []int) Option {
+	return func(o *options) {
+		o.columnMapping = mapping
+	}
+}
+
+// WithExpectedColumns sets the exact list of the columns, in order, expected from the query of
+// the functions created by [QueryRow] and [Query], and from the rows scanned into structs by
+// [ScanOne], [ScanPtr], [ScanAll] and [ForEachT]. Column names are compared case-insensitively.
+//
+// The functions created by [QueryRow] and [Query] check the columns until the first successful
+// check. A mismatch is reported as an error naming the differing columns: this catches schema
+// drift (columns renamed, added or reordered, for example with "SELECT *") early.
+// Unlike [WithAllowedColumns], which accepts any subset of the allowed columns, the check
+// covers the order and the set of columns.
+//
+// For [QueryRow] the check requires [sql.Stmt.QueryContext] instead of [sql.Stmt.QueryRowContext]
+// until the columns are checked.
+func WithExpectedColumns(columns []string) Option {
+	return func(o *options) {
+		o.expectedColumns = columns
+	}
+}
+
+// checkExpectedColumns checks columns against the columns expected with [WithExpectedColumns].
+func (o *options) checkExpectedColumns(columns []string) error {
+	if o.expectedColumns == nil {
+		return nil
+	}
+	if len(columns) != len(o.expectedColumns) {
+		return fmt.Errorf("sqlfunc: got %d columns %q, expected %d columns %q", len(columns), columns, len(o.expectedColumns), o.expectedColumns)
+	}
+	for i, c := range columns {
+		if !strings.EqualFold(c, o.expectedColumns[i]) {
+			return fmt.Errorf("sqlfunc: column %d is %q, expected %q (columns: %q)", i+1, c, o.expectedColumns[i], columns)
+		}
+	}
+	return nil
+}
+
+// columnsCheck checks the columns of the executions of a statement until the first successful check.
+type columnsCheck struct {
+	o    *options
+	done uint32
+}
+
+// newColumnsCheck returns the check of the columns of the statement, or nil if [WithExpectedColumns]
+// is not set.
+func (o *options) newColumnsCheck() *columnsCheck {
+	if o.expectedColumns == nil {
+		return nil
+	}
+	return &columnsCheck{o: o}
+}
+
+// pending reports whether the columns must be checked.
+func (c *columnsCheck) pending() bool {
+	return c != nil && atomic.LoadUint32(&c.done) == 0
+}
+
+func (c *columnsCheck) check(rows *sql.Rows) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if err = c.o.checkExpectedColumns(columns); err != nil {
+		return err
+	}
+	atomic.StoreUint32(&c.done, 1)
+	return nil
+}
+
+// WithoutPrepare disables the preparation of the statement by [Exec], [QueryRow] and [Query]:
+// the query is sent with the arguments at each call of the function (using the ExecContext,
+// QueryRowContext and QueryContext methods of db, which must implement them, as [*sql.DB],
+// [*sql.Conn] and [*sql.Tx] do). The returned func 'close' does nothing.
+//
+// This suits queries executed rarely, for which the cost of preparation dominates.
+// Errors in the query are reported only when the function is called.
+//
+// With a transaction as second argument of the function, the transaction type must also
+// implement those methods.
+func WithoutPrepare() Option {
+	return func(o *options) {
+		o.withoutPrepare = true
+	}
+}
+
+// WithNoTxArg disables the detection of a transaction as second argument of the functions
+// created by [Exec], [QueryRow] and [QueryRowLazy]: the second argument is then a parameter of
+// the query even if its type implements [StmtLocalizer].
+//
+// This is for parameter types that happen to have a StmtContext method.
+func WithNoTxArg() Option {
+	return func(o *options) {
+		o.noTxArg = true
+	}
+}
+
+// WithDollarPlaceholders tells that the driver uses Postgres-style "$N" placeholders
+// ([github.com/lib/pq], [github.com/jackc/pgx]), for the functions that generate queries
+// ([BulkInsert], [PrepareInsertValues], [NamedQueryRow], [QueryPage]) or count their placeholders.
+//
+// The style is detected for an [*sql.DB] or an [*sql.Conn], but the driver of an [*sql.Tx] (or of
+// another [PrepareConn]) can't be determined: this option is then required for those drivers.
+func WithDollarPlaceholders() Option {
+	return func(o *options) {
+		o.dollar = true
+	}
+}
+
+// dollarPlaceholders reports whether the driver of db uses "$N" placeholders
+// (see [WithDollarPlaceholders]).
+func (o *options) dollarPlaceholders(db PrepareConn) bool {
+	return o.dollar || isDollarDriver(driverPkgPath(db))
+}
+
+// WithAutoReprepare enables the recovery of the functions created by [Exec], [QueryRow] and [Query]
+// from a failure of the statement with an error matching [database/sql/driver.ErrBadConn]
+// (which [database/sql] returns once its own retries are exhausted, or if db is a [*sql.Conn]):
+// the statement is prepared again on db and the call is retried once.
+//
+// Drivers return driver.ErrBadConn only if the statement wasn't sent, so the retry doesn't run it twice.
+// Calls localized to a transaction are not retried (the transaction is lost with the connection),
+// nor the functions created by [QueryRowLazy] (the error is reported by the scan).
+func WithAutoReprepare() Option {
+	return func(o *options) {
+		o.autoReprepare = true
+	}
+}
+
+// WithStmtPool makes [Exec], [QueryRow], [QueryRowLazy] and [Query] prepare n copies of the
+// statement: the calls of the created func are spread over them in round-robin.
+// The returned func 'close' closes all of them.
+//
+// [database/sql.Stmt] uses a single prepared statement per connection, so this helps only
+// with drivers that serialize the calls on a statement, under high concurrency.
+// WithStmtPool is ignored with [WithoutPrepare]. It panics if n < 1.
+func WithStmtPool(n int) Option {
+	if n < 1 {
+		panic("n must be positive")
+	}
+	return func(o *options) {
+		o.stmtPool = n
+	}
+}
+
+// WithCountQuery sets the query counting the rows for [QueryPage], instead of the query derived
+// from the page query. The count query takes the same arguments as the page query (without
+// the limit and the offset) and returns a single row with a single column.
+func WithCountQuery(query string) Option {
+	return func(o *options) {
+		o.countQuery = query
+	}
+}
+
+// WithLimit sets the value of the placeholder following the LIMIT keyword of the query of
+// [Exec], [QueryRow], [QueryRowLazy] or [Query]: the placeholder is replaced with n as an
+// integer literal when the statement is prepared, and the func doesn't take an argument for it
+// (numbered placeholders that follow are renumbered).
+//
+// This is for drivers or servers that don't allow to bind a parameter for LIMIT. The tradeoff is
+// that the value is fixed at prepare time: prepare a statement for each value needed, or use a
+// bound parameter where the database supports it.
+//
+// n must not be negative. As n is an integer, the query can't be altered beyond the value.
+// Preparing panics if the query has no placeholder after LIMIT, or can't be parsed reliably.
+func WithLimit(n int) Option {
+	if n < 0 {
+		panic("n must be non-negative")
+	}
+	return withLimit("LIMIT", int64(n))
+}
+
+// WithOffset is like [WithLimit] for the placeholder following the OFFSET keyword.
+func WithOffset(n int) Option {
+	if n < 0 {
+		panic("n must be non-negative")
+	}
+	return withLimit("OFFSET", int64(n))
+}
+
+func withLimit(keyword string, n int64) Option {
+	return func(o *options) {
+		limits := make(map[string]int64, len(o.limits)+1)
+		for k, v := range o.limits {
+			limits[k] = v
+		}
+		limits[keyword] = n
+		o.limits = limits
+	}
+}
+
+// withLimits returns query with the placeholders set by [WithLimit] and [WithOffset] replaced.
+func (o *options) withLimits(query string) string {
+	if o.limits == nil {
+		return query
+	}
+	q, err := replaceLimits(query, o.limits)
+	if err != nil {
+		panic(err.Error())
+	}
+	return q
+}
+
+// WithConcurrency sets the maximum number of statements prepared concurrently by
+// [Group.PrepareAll], for the group created by [NewGroup] with this option.
+// The preparation is sequential by default.
+//
+// As the preparation of each statement is a round-trip to the server, this speeds up the startup
+// of applications preparing many statements on a remote database.
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		o.concurrency = n
+	}
+}
+
+// WithColumnTypesCheck enables, when scanning rows into a struct with [ScanOne], [ScanPtr],
+// [ScanAll] and [ForEachT], the check that the type of each field is compatible with the type
+// of the matching column reported by the driver (see [database/sql.ColumnType.ScanType]).
+// The check is done once, before scanning, and reports incompatible types (for example
+// a string field for an integer column) with an error naming the column and the field,
+// instead of a failure in the middle of a scan or a silent conversion.
+//
+// Fields using a [database/sql.Scanner] or a [Converter], fields of type interface{} and
+// columns for which the driver doesn't report a type are not checked.
+func WithColumnTypesCheck() Option {
+	return func(o *options) {
+		o.checkColumnTypes = true
+	}
+}
+
+// WithArgsCheck enables the validation of each argument given to the functions created by
+// [Exec], [QueryRow] and [Query], after the registered converters are applied, and before
+// the arguments are given to the driver.
+//
+// If check is nil, arguments are checked against the default conversion rules of [database/sql]
+// (see [database/sql/driver.IsValue] and [database/sql/driver.Valuer]). Drivers implementing
+// [database/sql/driver.NamedValueChecker] may accept more types: give a check func
+// mirroring the expectations of the driver in that case.
+//
+// A rejected argument produces an error naming the argument and its type (instead of
+// the error from the driver, which often doesn't say which argument is wrong) and the query
+// is not sent.
+func WithArgsCheck(check func(arg interface{}) error) Option {
+	if check == nil {
+		check = defaultArgsCheck
+	}
+	return func(o *options) {
+		o.argsCheck = check
+	}
+}
+
+// WithLocation sets the location of the [time.Time] values scanned by [Scan], [QueryRow] and [ForEach]
+// (into time.Time and *time.Time destinations): scanned times are converted with [time.Time.In].
+//
+// The conversion applies after the scan, including after a registered [Converter] for time.Time.
+// It doesn't change the instant, only its representation, which removes the need to normalize
+// times returned by drivers inconsistently in UTC or in the local time zone.
+func WithLocation(loc *time.Location) Option {
+	return func(o *options) {
+		o.location = loc
+	}
+}
+
+// WithNullAsZero makes [Scan], [QueryRow] and [ForEach] store the zero value when NULL is
+// scanned into a destination that can't hold NULL (string, bool, numeric types and [time.Time]),
+// instead of failing.
+//
+// This hides NULLs: use it only where NULL and the zero value have the same meaning, such as
+// for display. Types implementing [database/sql.Scanner] handle NULL themselves.
+func WithNullAsZero() Option {
+	return func(o *options) {
+		o.nullAsZero = true
+	}
+}
+
+// WithNullDefault makes [Scan], [QueryRow] and [ForEach] store value when NULL is scanned into a
+// destination of type t, instead of failing: for example "N/A" for strings or -1 for ints in a
+// report. t must be a type that can't hold NULL (see [WithNullAsZero]). value must be assignable
+// to t, or be a number convertible to t without loss (so untyped constants can be given).
+//
+// Multiple WithNullDefault options set the defaults of multiple types, and take precedence over
+// [WithNullAsZero] for their type. The type must match exactly: a default for int doesn't apply
+// to int64 destinations.
+func WithNullDefault(t reflect.Type, value interface{}) Option {
+	if !nonNullable(t) {
+		panic(fmt.Sprintf("%v can hold NULL: use WithNullDefault with a type that can't", t))
+	}
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		panic("value must be non-nil")
+	}
+	if !v.Type().AssignableTo(t) {
+		if !isNumberKind(v.Kind()) || !isNumberKind(t.Kind()) {
+			panic(fmt.Sprintf("value of type %v is not assignable to %v", v.Type(), t))
+		}
+		c := v.Convert(t)
+		if c.Convert(v.Type()).Interface() != v.Interface() || isNegative(v) != isNegative(c) {
+			panic(fmt.Sprintf("value %v overflows %v", value, t))
+		}
+		v = c
+	} else if v.Type() != t {
+		v = v.Convert(t)
+	}
+	return func(o *options) {
+		defaults := make(map[reflect.Type]reflect.Value, len(o.nullDefaults)+1)
+		for k, d := range o.nullDefaults {
+			defaults[k] = d
+		}
+		defaults[t] = v
+		o.nullDefaults = defaults
+	}
+}
+
+// isNegative reports whether the number v is negative.
+func isNegative(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() < 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() < 0
+	}
+	return false
+}
+
+// isNumberKind reports whether k is an integer or floating point kind.
+func isNumberKind(k reflect.Kind) bool {
+	return isIntKind(k) || k == reflect.Float32 || k == reflect.Float64
+}
+
+// scanner returns the value to give to [database/sql.Rows.Scan] to fill ptr, applying the
+// registered converters and the options.
+func (o *options) scanner(ptr reflect.Value) interface{} {
+	s := scanner(ptr)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return s
+	}
+	if o.location != nil {
+		switch ptr.Type().Elem() {
+		case typeTime, typeTimePtr:
+			s = &locationScanner{dest: ptr.Interface(), inner: s, loc: o.location}
+		}
+	}
+	if null, ok := o.nullDefaults[ptr.Type().Elem()]; ok {
+		s = &nullZeroScanner{dest: ptr, inner: s, null: null}
+	} else if o.nullAsZero && nonNullable(ptr.Type().Elem()) {
+		s = &nullZeroScanner{dest: ptr, inner: s}
+	}
+	return s
+}
+
+// WithAllocator sets the function allocating the destinations of the values scanned by [Scan],
+// [QueryRow] and [ForEach], instead of [reflect.New]. alloc must return a pointer to a zero
+// value of type t.
+//
+// This is an advanced hook to reduce the pressure on the garbage collector when scanning many
+// rows, for example by allocating from slabs. The values scanned are copied to the results
+// of the functions created by [Scan] and [QueryRow] and to the arguments of the callback of
+// [ForEach], so the memory is not retained by the caller.
+func WithAllocator(alloc func(t reflect.Type) reflect.Value) Option {
+	return func(o *options) {
+		o.allocator = alloc
+	}
+}
+
+// new returns a pointer to a new zero value of type t.
+func (o *options) new(t reflect.Type) reflect.Value {
+	if o.allocator == nil {
+		return reflect.New(t)
+	}
+	ptr := o.allocator(t)
+	if ptr.Type() != reflect.PtrTo(t) {
+		panic("allocator must return a pointer to a value of the given type")
+	}
+	return ptr
+}
+
+// WithExplain enables a debug mode where each call of the functions created by [QueryRow] and
+// [Query] first runs EXPLAIN for the query (EXPLAIN QUERY PLAN for SQLite), with the same
+// arguments, and gives the plan to the explain callback. Each row of the plan is a line of text
+// (for SQLite, only the detail column is kept).
+//
+// The EXPLAIN statement is prepared with the statement. If the database doesn't support
+// EXPLAIN (or with [WithoutPrepare], if EXPLAIN fails), the plan is silently skipped.
+// The SQLite variant is chosen from the driver of db: with an [*sql.Tx] (whose driver can't be
+// determined), EXPLAIN is used.
+//
+// This doubles the number of queries: use it only for query tuning in development.
+func WithExplain(explain func(plan string)) Option {
+	return func(o *options) {
+		o.explain = explain
+	}
+}
+
+// WithoutClose disables the closing of rows by [ForEach] before returning: the caller takes the
+// responsibility of closing rows.
+//
+// This allows to inspect rows (for example [database/sql.Rows.Columns]) after the iteration was
+// stopped by the callback, or to continue the iteration with other code.
+// Note that [database/sql] closes rows itself once all rows have been read.
+//
+// WARNING: rows not closed hold a database connection. Forgetting to close them leaks
+// connections until the pool is exhausted.
+func WithoutClose() Option {
+	return func(o *options) {
+		o.withoutClose = true
+	}
+}
+
+// StmtInfo describes a statement prepared by [Exec], [QueryRow], [QueryRowLazy] or [Query]
+// (see [WithStmtInfo]).
+type StmtInfo struct {
+	Query string       // The SQL query
+	Func  reflect.Type // The type of the created function
+
+	// ArgTypes are the types of the arguments given to the statement, after the expansion
+	// of arguments embedding [Args] (the context and the transaction are not included).
+	ArgTypes []reflect.Type
+
+	// ResultTypes are the types of the values scanned by the function created by [QueryRow]
+	// (the error is not included). They are nil for the other functions.
+	//
+	// The names of the columns are not available: [database/sql] doesn't expose the columns of a
+	// prepared statement. Use [database/sql.Rows.Columns] on the result of a query instead.
+	ResultTypes []reflect.Type
+}
+
+// WithStmtInfo makes [Exec], [QueryRow], [QueryRowLazy] and [Query] fill info with the metadata of
+// the statement, for documentation or debugging. info is filled before preparing the statement,
+// so it is available even if the preparation fails.
+func WithStmtInfo(info *StmtInfo) Option {
+	return func(o *options) {
+		o.stmtInfo = info
+	}
+}
+
+// setStmtInfo fills the StmtInfo requested by [WithStmtInfo], if any.
+func (o *options) setStmtInfo(query string, fnType reflect.Type, firstArg int, resultTypes []reflect.Type) {
+	if o.stmtInfo == nil {
+		return
+	}
+	var argTypes []reflect.Type
+	for _, t := range inTypes(fnType, firstArg) {
+		if fields := argsFields(t); fields != nil {
+			for _, f := range fields {
+				argTypes = append(argTypes, t.Field(f).Type)
+			}
+			continue
+		}
+		argTypes = append(argTypes, t)
+	}
+	*o.stmtInfo = StmtInfo{
+		Query:       query,
+		Func:        fnType,
+		ArgTypes:    argTypes,
+		ResultTypes: resultTypes,
+	}
+}
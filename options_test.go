@@ -0,0 +1,1025 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+// querySlow is a query that takes seconds to run on SQLite.
+const querySlow = `` +
+	`WITH RECURSIVE series(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM series WHERE n < 1000000000)` +
+	` SELECT COUNT(*) FROM series`
+
+func TestWithDefaultTimeout(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	var slow func(ctx context.Context) (int64, error)
+	close, err := sqlfunc.QueryRow(ctx, db, querySlow, &slow, sqlfunc.WithDefaultTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer close()
+
+	start := time.Now()
+	_, err = slow(ctx)
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("default timeout not applied: %v (%v)", d, err)
+	}
+	t.Log(err)
+
+	// A deadline on the context of the call takes precedence
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	var fast func(ctx context.Context) (int64, error)
+	closeFast, err := sqlfunc.QueryRow(ctx, db, `SELECT 1`, &fast, sqlfunc.WithDefaultTimeout(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeFast()
+	if n, err := fast(ctx2); err != nil || n != 1 {
+		t.Errorf("got %d, %v", n, err)
+	}
+
+	// Query without stop func: the timeout is not applied
+	var query func(ctx context.Context) (*sql.Rows, error)
+	closeQuery, err := sqlfunc.Query(ctx, db, `SELECT 1 UNION ALL SELECT 2`, &query, sqlfunc.WithDefaultTimeout(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer closeQuery()
+	rows, err := query(ctx)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	var sum int
+	err = sqlfunc.ForEach(rows, func(n int) { sum += n })
+	if err != nil || sum != 3 {
+		t.Errorf("got %d, %v", sum, err)
+	}
+
+	// Query with stop func: the timeout covers iteration
+	var queryStop func(ctx context.Context) (*sql.Rows, func(), error)
+	closeQueryStop, err := sqlfunc.Query(ctx, db, querySlow, &queryStop, sqlfunc.WithDefaultTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer closeQueryStop()
+	start = time.Now()
+	rows, stop, err := queryStop(ctx)
+	if err == nil {
+		defer stop()
+		for rows.Next() {
+		}
+		err = rows.Err()
+	}
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("default timeout not applied: %v (%v)", d, err)
+	}
+
+	// Exec
+	var exec func(ctx context.Context) (sql.Result, error)
+	closeExec, err := sqlfunc.Exec(ctx, db, querySlow, &exec, sqlfunc.WithDefaultTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	defer closeExec()
+	start = time.Now()
+	if _, err = exec(ctx); err == nil {
+		t.Fatal("error expected")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("default timeout not applied: %v (%v)", d, err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Logf("driver error: %v", err)
+	}
+}
+
+func TestWithErrorQuery(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	const query = `SELECT 1 WHERE 0 = ?`
+	var f func(ctx context.Context, n int) (int, error)
+	close, err := sqlfunc.QueryRow(ctx, db, query, &f, sqlfunc.WithErrorQuery(true))
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer close()
+
+	if _, err = f(ctx, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = f(ctx, 1)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("sql.ErrNoRows expected, got %v", err)
+	}
+	var qe *sqlfunc.QueryError
+	if !errors.As(err, &qe) {
+		t.Fatalf("QueryError expected, got %T", err)
+	}
+	if qe.Query() != query {
+		t.Errorf("got query %q", qe.Query())
+	}
+	if !strings.Contains(err.Error(), query) {
+		t.Errorf("query not found in %q", err)
+	}
+	if qe.Unwrap() != sql.ErrNoRows {
+		t.Errorf("unwrap: got %v", qe.Unwrap())
+	}
+
+	// Disabled by default
+	var g func(ctx context.Context, n int) (int, error)
+	closeG, err := sqlfunc.QueryRow(ctx, db, query, &g)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeG()
+	if _, err = g(ctx, 1); err != sql.ErrNoRows {
+		t.Errorf("sql.ErrNoRows expected, got %v", err)
+	}
+}
+
+func TestWithoutPrepare(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE t (n INTEGER)`); err != nil {
+		t.Fatalf("Create table: %v", err)
+	}
+
+	var insert func(ctx context.Context, tx *sql.Tx, n int) (sql.Result, error)
+	close, err := sqlfunc.Exec(ctx, db, `INSERT INTO t (n) VALUES (?)`, &insert, sqlfunc.WithoutPrepare())
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if err = close(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+	// The function still works after close as no statement was prepared
+	if _, err = insert(ctx, nil, 1); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	if _, err = insert(ctx, tx, 2); err != nil {
+		t.Fatalf("insert in tx: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	var sum func(ctx context.Context) (int, error)
+	if _, err = sqlfunc.QueryRow(ctx, db, `SELECT SUM(n) FROM t`, &sum, sqlfunc.WithoutPrepare()); err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	if n, err := sum(ctx); err != nil || n != 3 {
+		t.Errorf("sum: got %d, %v", n, err)
+	}
+
+	var query func(ctx context.Context) (*sql.Rows, error)
+	if _, err = sqlfunc.Query(ctx, db, `SELECT n FROM t ORDER BY n`, &query, sqlfunc.WithoutPrepare()); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	rows, err := query(ctx)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	var values []int
+	if err = sqlfunc.ForEach(rows, func(n int) { values = append(values, n) }); err != nil || len(values) != 2 {
+		t.Errorf("query: got %v, %v", values, err)
+	}
+
+	// Errors in the query are reported at call time
+	var invalid func(ctx context.Context) (sql.Result, error)
+	if _, err = sqlfunc.Exec(ctx, db, `INVALID`, &invalid, sqlfunc.WithoutPrepare()); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if _, err = invalid(ctx); err == nil {
+		t.Error("error expected")
+	}
+
+	// db must support direct queries
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic expected")
+			}
+		}()
+		var f func(ctx context.Context) (sql.Result, error)
+		sqlfunc.Exec(ctx, &sqlfunc.SplitConn{Primary: db, Replica: db}, `SELECT 1`, &f, sqlfunc.WithoutPrepare())
+	}()
+}
+
+func TestWithLocation(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("LoadLocation: %v", err)
+	}
+	ts := time.Date(2022, 12, 25, 8, 30, 0, 0, time.UTC)
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE event (at DATETIME, done_at DATETIME)`)
+	if err != nil {
+		t.Fatalf("Create table: %v", err)
+	}
+	if _, err = db.ExecContext(ctx, `INSERT INTO event VALUES (?, NULL), (?, ?)`, ts, ts, ts); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	checkTime := func(name string, got time.Time) {
+		t.Helper()
+		if !got.Equal(ts) || got.Location() != paris {
+			t.Errorf("%s: got %v, expected %v", name, got, ts.In(paris))
+		}
+	}
+
+	var queryRow func(ctx context.Context) (time.Time, *time.Time, error)
+	closeQueryRow, err := sqlfunc.QueryRow(ctx, db, `SELECT at, done_at FROM event ORDER BY done_at DESC LIMIT 1`, &queryRow, sqlfunc.WithLocation(paris))
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeQueryRow()
+	at, doneAt, err := queryRow(ctx)
+	if err != nil {
+		t.Fatalf("queryRow: %v", err)
+	}
+	checkTime("QueryRow", at)
+	if doneAt == nil {
+		t.Fatal("QueryRow: unexpected NULL")
+	}
+	checkTime("QueryRow", *doneAt)
+
+	query := func() *sql.Rows {
+		rows, err := db.QueryContext(ctx, `SELECT at, done_at FROM event ORDER BY done_at NULLS FIRST`)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		return rows
+	}
+
+	var n int
+	err = sqlfunc.ForEach(query(), func(at time.Time, doneAt *time.Time) {
+		checkTime("ForEach", at)
+		if n == 0 {
+			if doneAt != nil {
+				t.Errorf("ForEach: NULL expected, got %v", *doneAt)
+			}
+		} else if doneAt == nil {
+			t.Error("ForEach: unexpected NULL")
+		} else {
+			checkTime("ForEach", *doneAt)
+		}
+		n++
+	}, sqlfunc.WithLocation(paris))
+	if err != nil || n != 2 {
+		t.Errorf("ForEach: %d rows, %v", n, err)
+	}
+
+	var scan func(*sql.Rows) (time.Time, *time.Time, error)
+	sqlfunc.Scan(&scan, sqlfunc.WithLocation(paris))
+	rows := query()
+	defer rows.Close()
+	for rows.Next() {
+		at, _, err := scan(rows)
+		if err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		checkTime("Scan", at)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ExampleWithStmtInfo() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	type area struct {
+		sqlfunc.Args
+		MinLat, MaxLat float64
+	}
+
+	var info sqlfunc.StmtInfo
+	var countInArea func(ctx context.Context, tx *sql.Tx, a area) (int64, error)
+	closeCount, err := sqlfunc.QueryRow(ctx, db,
+		`SELECT COUNT(*) FROM poi WHERE lat BETWEEN ? AND ?`,
+		&countInArea,
+		sqlfunc.WithStmtInfo(&info),
+	)
+	if err != nil {
+		fmt.Println("QueryRow:", err)
+		return
+	}
+	defer closeCount()
+
+	fmt.Println("Query:", info.Query)
+	fmt.Println("Args:", info.ArgTypes)
+	fmt.Println("Results:", info.ResultTypes)
+
+	// Output:
+	// Query: SELECT COUNT(*) FROM poi WHERE lat BETWEEN ? AND ?
+	// Args: [float64 float64]
+	// Results: [int64]
+}
+
+// flakyDriver is a [driver.Connector] whose statements fail with [driver.ErrBadConn]
+// while failures remain.
+type flakyDriver struct {
+	mu       sync.Mutex
+	failures int
+	prepares int
+}
+
+func (d *flakyDriver) Connect(context.Context) (driver.Conn, error) { return flakyConn{d}, nil }
+func (d *flakyDriver) Driver() driver.Driver                        { return d }
+func (d *flakyDriver) Open(string) (driver.Conn, error)             { return flakyConn{d}, nil }
+
+type flakyConn struct{ d *flakyDriver }
+
+func (c flakyConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.prepares++
+	return flakyStmt(c), nil
+}
+
+func (flakyConn) Close() error              { return nil }
+func (flakyConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type flakyStmt struct{ d *flakyDriver }
+
+func (flakyStmt) Close() error  { return nil }
+func (flakyStmt) NumInput() int { return -1 }
+
+func (s flakyStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	if s.d.failures > 0 {
+		s.d.failures--
+		return nil, driver.ErrBadConn
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (flakyStmt) Query([]driver.Value) (driver.Rows, error) { return nil, errors.New("not supported") }
+
+func TestWithAutoReprepare(t *testing.T) {
+	ctx := context.Background()
+	d := &flakyDriver{}
+	db := sql.OpenDB(d)
+	defer db.Close()
+
+	var del, delReprepare func(ctx context.Context, id int) (sql.Result, error)
+	closeDel, err := sqlfunc.Exec(ctx, db, `DELETE FROM t WHERE id = ?`, &del)
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	defer closeDel()
+	closeDelReprepare, err := sqlfunc.Exec(ctx, db, `DELETE FROM t WHERE id = ?`, &delReprepare, sqlfunc.WithAutoReprepare())
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	defer closeDelReprepare()
+
+	// The failures exhaust the retries of database/sql
+	const failures = 3
+
+	d.failures = failures
+	if _, err = del(ctx, 1); !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("without WithAutoReprepare: got %v, expected %v", err, driver.ErrBadConn)
+	}
+
+	d.failures = failures
+	prepares := d.prepares
+	if _, err = delReprepare(ctx, 1); err != nil {
+		t.Errorf("with WithAutoReprepare: %v", err)
+	}
+	if d.prepares <= prepares {
+		t.Error("statement not prepared again")
+	}
+
+	// No failure
+	if _, err = delReprepare(ctx, 2); err != nil {
+		t.Errorf("with WithAutoReprepare: %v", err)
+	}
+}
+
+// serialDriver is a [driver.Connector] whose statements run serially, as on servers where
+// a prepared statement handle can't run concurrently. The handles are numbered in the order
+// of preparation on each connection and shared by the connections.
+type serialDriver struct {
+	delay time.Duration
+
+	mu      sync.Mutex
+	handles []*serialHandle
+	closes  int
+}
+
+type serialHandle struct {
+	mu    sync.Mutex
+	execs int
+}
+
+func (d *serialDriver) Connect(context.Context) (driver.Conn, error) { return &serialConn{d: d}, nil }
+func (d *serialDriver) Driver() driver.Driver                        { return d }
+func (d *serialDriver) Open(string) (driver.Conn, error)             { return &serialConn{d: d}, nil }
+
+type serialConn struct {
+	d        *serialDriver
+	prepared int
+}
+
+func (c *serialConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	if c.prepared == len(c.d.handles) {
+		c.d.handles = append(c.d.handles, &serialHandle{})
+	}
+	h := c.d.handles[c.prepared]
+	c.prepared++
+	return serialStmt{c.d, h}, nil
+}
+
+func (*serialConn) Close() error              { return nil }
+func (*serialConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type serialStmt struct {
+	d *serialDriver
+	h *serialHandle
+}
+
+func (s serialStmt) Close() error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.closes++
+	return nil
+}
+
+func (serialStmt) NumInput() int { return -1 }
+
+func (s serialStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.h.mu.Lock()
+	defer s.h.mu.Unlock()
+	s.h.execs++
+	time.Sleep(s.d.delay)
+	return driver.RowsAffected(1), nil
+}
+
+func (serialStmt) Query([]driver.Value) (driver.Rows, error) { return nil, errors.New("not supported") }
+
+func TestWithStmtPool(t *testing.T) {
+	ctx := context.Background()
+	d := &serialDriver{}
+	db := sql.OpenDB(d)
+	defer db.Close()
+
+	var del func(ctx context.Context, id int) (sql.Result, error)
+	closeDel, err := sqlfunc.Exec(ctx, db, `DELETE FROM t WHERE id = ?`, &del, sqlfunc.WithStmtPool(3))
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if len(d.handles) != 3 {
+		t.Errorf("prepared: got %d statements, expected 3", len(d.handles))
+	}
+
+	for i := 0; i < 6; i++ {
+		if _, err = del(ctx, i); err != nil {
+			t.Errorf("del: %v", err)
+		}
+	}
+	for i, h := range d.handles {
+		if h.execs != 2 {
+			t.Errorf("statement %d: got %d calls, expected 2", i, h.execs)
+		}
+	}
+
+	if err = closeDel(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+	if d.closes != 3 {
+		t.Errorf("close: got %d statements closed, expected 3", d.closes)
+	}
+}
+
+func BenchmarkWithStmtPool(b *testing.B) {
+	ctx := context.Background()
+	for _, n := range []int{1, 4, 16} {
+		b.Run(fmt.Sprint("pool=", n), func(b *testing.B) {
+			db := sql.OpenDB(&serialDriver{delay: 50 * time.Microsecond})
+			defer db.Close()
+			db.SetMaxIdleConns(32)
+
+			var del func(ctx context.Context, id int) (sql.Result, error)
+			closeDel, err := sqlfunc.Exec(ctx, db, `DELETE FROM t WHERE id = ?`, &del, sqlfunc.WithStmtPool(n))
+			if err != nil {
+				b.Fatalf("Exec: %v", err)
+			}
+			defer closeDel()
+
+			b.SetParallelism(16)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := del(ctx, 1); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestWithNullAsZero(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	type status string
+
+	const query = `SELECT NULL, NULL, NULL, NULL, NULL, NULL UNION ALL SELECT 42, 'a', 1.5, 1, 7, 'ok'`
+
+	// Without the option, NULL into int fails
+	var getStrict func(ctx context.Context) (int, error)
+	closeStrict, err := sqlfunc.QueryRow(ctx, db, `SELECT NULL`, &getStrict)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeStrict()
+	if _, err = getStrict(ctx); err == nil {
+		t.Error("error expected without WithNullAsZero")
+	}
+
+	var get func(ctx context.Context) (int, string, float64, bool, uint8, status, error)
+	closeGet, err := sqlfunc.QueryRow(ctx, db, query, &get, sqlfunc.WithNullAsZero())
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeGet()
+	i, s, f, b, u, st, err := get(ctx)
+	if err != nil || i != 0 || s != "" || f != 0 || b || u != 0 || st != "" {
+		t.Errorf("QueryRow: got %v %q %v %v %v %q %v", i, s, f, b, u, st, err)
+	}
+
+	// Struct destination
+	type row struct {
+		N int
+		S string
+	}
+	var getRow func(ctx context.Context, r *row) (bool, error)
+	closeGetRow, err := sqlfunc.QueryRow(ctx, db, `SELECT NULL AS n, NULL AS s`, &getRow, sqlfunc.WithNullAsZero())
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeGetRow()
+	r := row{N: 1, S: "x"}
+	if found, err := getRow(ctx, &r); err != nil || !found || r != (row{}) {
+		t.Errorf("QueryRow struct: got %+v, %v, %v", r, found, err)
+	}
+
+	var scan func(*sql.Rows) (int, string, float64, bool, uint8, status, error)
+	sqlfunc.Scan(&scan, sqlfunc.WithNullAsZero())
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var got []string
+	err = sqlfunc.ForEach(rows, func(i int, s string, f float64, b bool, u uint8, st status) {
+		got = append(got, fmt.Sprintf("%v %q %v %v %v %q", i, s, f, b, u, st))
+	}, sqlfunc.WithNullAsZero())
+	if err != nil {
+		t.Fatalf("ForEach: %v", err)
+	}
+	if expected := []string{`0 "" 0 false 0 ""`, `42 "a" 1.5 true 7 "ok"`}; fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("ForEach: got %q, expected %q", got, expected)
+	}
+
+	rows, err = db.QueryContext(ctx, query)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		i, s, f, b, u, st, err := scan(rows)
+		if err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		if i != 0 && (i != 42 || s != "a" || f != 1.5 || !b || u != 7 || st != "ok") {
+			t.Errorf("Scan: got %v %q %v %v %v %q", i, s, f, b, u, st)
+		}
+	}
+}
+
+func TestWithExpectedColumns(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE poi (name TEXT, lat REAL, lon REAL)`); err != nil {
+		t.Fatalf("Create table: %v", err)
+	}
+	if _, err = db.ExecContext(ctx, `INSERT INTO poi VALUES ('Versailles', 48.8016, 2.1204)`); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	expected := sqlfunc.WithExpectedColumns([]string{"name", "LAT", "lon"})
+
+	var getOK func(ctx context.Context) (string, float64, float64, error)
+	closeOK, err := sqlfunc.QueryRow(ctx, db, `SELECT * FROM poi`, &getOK, expected)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeOK()
+	for i := 0; i < 2; i++ {
+		if name, _, _, err := getOK(ctx); err != nil || name != "Versailles" {
+			t.Errorf("QueryRow: got %q, %v", name, err)
+		}
+	}
+
+	var getReordered func(ctx context.Context) (float64, float64, string, error)
+	closeReordered, err := sqlfunc.QueryRow(ctx, db, `SELECT lat, lon, name FROM poi`, &getReordered, expected)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeReordered()
+	_, _, _, err = getReordered(ctx)
+	if err == nil || !strings.Contains(err.Error(), `column 1 is "lat", expected "name"`) {
+		t.Errorf("QueryRow: unexpected error %v", err)
+	}
+
+	var query func(ctx context.Context) (*sql.Rows, error)
+	closeQuery, err := sqlfunc.Query(ctx, db, `SELECT name, lat FROM poi`, &query, expected)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer closeQuery()
+	rows, err := query(ctx)
+	if rows != nil || err == nil || !strings.Contains(err.Error(), `got 2 columns ["name" "lat"], expected 3 columns`) {
+		t.Errorf("Query: unexpected error %v", err)
+	}
+
+	// No row: columns are checked anyway
+	var queryOK func(ctx context.Context) (*sql.Rows, error)
+	closeQueryOK, err := sqlfunc.Query(ctx, db, `SELECT * FROM poi WHERE 0`, &queryOK, expected)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer closeQueryOK()
+	if rows, err = queryOK(ctx); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	rows.Close()
+}
+
+func ExampleWithExplain() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE poi (name TEXT, lat REAL, lon REAL);`+
+		`CREATE INDEX poi_lat ON poi (lat)`); err != nil {
+		fmt.Println("Create:", err)
+		return
+	}
+
+	// In development, log the plans of the queries
+	explain := sqlfunc.WithExplain(func(plan string) {
+		fmt.Println("Plan:", plan)
+	})
+
+	var count func(ctx context.Context, minLat float64) (int, error)
+	closeCount, err := sqlfunc.QueryRow(ctx, db, `SELECT COUNT(*) FROM poi WHERE lat > ?`, &count, explain)
+	if err != nil {
+		fmt.Println("QueryRow:", err)
+		return
+	}
+	defer closeCount()
+
+	var byName func(ctx context.Context, name string) (*sql.Rows, error)
+	closeByName, err := sqlfunc.Query(ctx, db, `SELECT lat, lon FROM poi WHERE name = ?`, &byName, explain)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+	defer closeByName()
+
+	n, err := count(ctx, 48.0)
+	fmt.Println(n, err)
+
+	rows, err := byName(ctx, "Eiffel Tower")
+	if err != nil {
+		fmt.Println("byName:", err)
+		return
+	}
+	rows.Close()
+
+	// Output:
+	// Plan: SEARCH poi USING COVERING INDEX poi_lat (lat>?)
+	// 0 <nil>
+	// Plan: SCAN poi
+}
+
+// noExplainConn is a [sqlfunc.PrepareConn] for a database that doesn't support EXPLAIN.
+type noExplainConn struct {
+	sqlfunc.PrepareConn
+}
+
+func (c noExplainConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if strings.HasPrefix(query, "EXPLAIN") {
+		return nil, errors.New("syntax error")
+	}
+	return c.PrepareConn.PrepareContext(ctx, query)
+}
+
+func TestWithExplainWithoutPrepare(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	if _, err = db.ExecContext(ctx, `CREATE TABLE poi (name TEXT, lat REAL, lon REAL)`); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	var plans []string
+	var count func(ctx context.Context, minLat float64) (int, error)
+	closeCount, err := sqlfunc.QueryRow(ctx, db, `SELECT COUNT(*) FROM poi WHERE lat > ?`, &count,
+		sqlfunc.WithoutPrepare(),
+		sqlfunc.WithExplain(func(plan string) { plans = append(plans, plan) }),
+	)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeCount()
+	if _, err = count(ctx, 48.0); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	// The plan, not the bytecode
+	if len(plans) != 1 || plans[0] != "SCAN poi" {
+		t.Errorf("got %q, expected [\"SCAN poi\"]", plans)
+	}
+}
+
+func TestWithExplainUnsupported(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	var plans int
+	var get func(ctx context.Context, n int) (int, error)
+	closeGet, err := sqlfunc.QueryRow(ctx, noExplainConn{db}, `SELECT ?`, &get, sqlfunc.WithExplain(func(string) { plans++ }))
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeGet()
+	if n, err := get(ctx, 1); err != nil || n != 1 {
+		t.Errorf("got %d, %v", n, err)
+	}
+	if plans != 0 {
+		t.Errorf("got %d plans, expected 0", plans)
+	}
+}
+
+func ExampleWithLimit() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	// The second page of 1 POI: the limit and the offset are fixed when preparing,
+	// so the func takes only the other arguments
+	var info sqlfunc.StmtInfo
+	var secondPOI func(ctx context.Context, minLat float64) (name string, err error)
+	closeSecondPOI, err := sqlfunc.QueryRow(ctx, db,
+		`SELECT name FROM poi WHERE lat > ? ORDER BY name LIMIT ? OFFSET ?`,
+		&secondPOI,
+		sqlfunc.WithLimit(1), sqlfunc.WithOffset(1),
+		sqlfunc.WithStmtInfo(&info),
+	)
+	if err != nil {
+		fmt.Println("QueryRow:", err)
+		return
+	}
+	defer closeSecondPOI()
+	fmt.Println(info.Query)
+
+	name, err := secondPOI(ctx, 0)
+	if err != nil {
+		fmt.Println("secondPOI:", err)
+		return
+	}
+	fmt.Println(name)
+
+	// Output:
+	// SELECT name FROM poi WHERE lat > ? ORDER BY name LIMIT 1 OFFSET 1
+	// Villeperdue
+}
+
+func ExampleWithRowMetrics() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	// A histogram of the number of rows per query, by power of 2
+	var histogram [8]int
+	metrics := sqlfunc.WithRowMetrics(func(rows int, bytes int64) {
+		bucket := 0
+		for n := rows; n > 1 && bucket < len(histogram)-1; n >>= 1 {
+			bucket++
+		}
+		histogram[bucket]++
+		fmt.Printf("rows: %d, bytes: %d\n", rows, bytes)
+	})
+
+	var queryNames func(ctx context.Context, minLat float64) (*sql.Rows, error)
+	closeQueryNames, err := sqlfunc.Query(ctx, db, `SELECT name FROM poi WHERE lat > ?`, &queryNames)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+	defer closeQueryNames()
+
+	for _, minLat := range []float64{0, 48, 60} {
+		rows, err := queryNames(ctx, minLat)
+		if err != nil {
+			fmt.Println("queryNames:", err)
+			return
+		}
+		if err = sqlfunc.ForEach(rows, func(name string) {}, metrics); err != nil {
+			fmt.Println("ForEach:", err)
+			return
+		}
+	}
+	fmt.Println(histogram)
+
+	// Output:
+	// rows: 2, bytes: 33
+	// rows: 1, bytes: 22
+	// rows: 0, bytes: 0
+	// [2 1 0 0 0 0 0 0]
+}
+
+func TestWithNullDefault(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	defaults := []sqlfunc.Option{
+		sqlfunc.WithNullDefault(reflect.TypeOf(""), "N/A"),
+		sqlfunc.WithNullDefault(reflect.TypeOf(0), -1),
+		sqlfunc.WithNullDefault(reflect.TypeOf(uint8(0)), 255),
+		sqlfunc.WithNullAsZero(), // for the other types
+	}
+
+	const query = `SELECT ?, ?, ?, ?, ?`
+	type row struct {
+		s   string
+		n   int
+		u   uint8
+		f   float64
+		ptr *string
+	}
+	var get func(ctx context.Context, s, n, u, f, ptr interface{}) (string, int, uint8, float64, *string, error)
+	closeGet, err := sqlfunc.QueryRow(ctx, db, query, &get, defaults...)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeGet()
+
+	for _, tc := range []struct {
+		args [5]interface{}
+		want row
+	}{
+		{[5]interface{}{nil, nil, nil, nil, nil}, row{"N/A", -1, 255, 0, nil}},
+		{[5]interface{}{"a", 1, 2, 3.5, "b"}, row{"a", 1, 2, 3.5, new(string)}},
+		{[5]interface{}{"", nil, 0, nil, nil}, row{"", -1, 0, 0, nil}},
+	} {
+		var got row
+		got.s, got.n, got.u, got.f, got.ptr, err = get(ctx, tc.args[0], tc.args[1], tc.args[2], tc.args[3], tc.args[4])
+		if err != nil {
+			t.Errorf("%v: %v", tc.args, err)
+			continue
+		}
+		if got.s != tc.want.s || got.n != tc.want.n || got.u != tc.want.u || got.f != tc.want.f || (got.ptr == nil) != (tc.want.ptr == nil) {
+			t.Errorf("%v: got %+v, expected %+v", tc.args, got, tc.want)
+		}
+	}
+
+	// ForEach
+	rows, err := db.QueryContext(ctx, `SELECT NULL, NULL UNION ALL SELECT 'x', 2`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var got []string
+	err = sqlfunc.ForEach(rows, func(s string, n int) {
+		got = append(got, fmt.Sprint(s, n))
+	}, defaults...)
+	if err != nil || fmt.Sprint(got) != "[N/A-1 x2]" {
+		t.Errorf("ForEach: got %q, %v", got, err)
+	}
+
+	for _, bad := range []func(){
+		func() { sqlfunc.WithNullDefault(reflect.TypeOf(""), 1) },
+		func() { sqlfunc.WithNullDefault(reflect.TypeOf(uint(0)), -1) },
+		func() { sqlfunc.WithNullDefault(reflect.TypeOf(int8(0)), 300) },
+		func() { sqlfunc.WithNullDefault(reflect.TypeOf(0), 1.5) },
+		func() { sqlfunc.WithNullDefault(reflect.TypeOf((*string)(nil)), nil) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("panic expected")
+				}
+			}()
+			bad()
+		}()
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// QueryPage prepares two SQL statements for the pagination of the results of query:
+// query with LIMIT and OFFSET clauses appended, and a count query. It creates a function
+// returning a page of rows (as [Query]) and the total number of rows (as [QueryRow]).
+//
+// fnPtr is a pointer to a func variable. The function signature tells how it will be called.
+//
+// The first argument is a [context.Context]. The last two arguments, of an integer type,
+// are the limit (the maximum number of rows of the page) and the offset (the number of rows
+// skipped). The other arguments are the arguments of query.
+//
+// The function will return an [*sql.Rows] for the page, the total number of rows (of an integer
+// type) and an error:
+//
+//	var listPOI func(ctx context.Context, minLat float64, limit, offset int) (rows *sql.Rows, total int64, err error)
+//	close, err := sqlfunc.QueryPage(ctx, db, `SELECT name FROM poi WHERE lat > ? ORDER BY name`, &listPOI)
+//
+// The count query is derived from query as "SELECT COUNT(*) FROM (query) ...". This doesn't work
+// for all queries (for example queries ending with a LIMIT clause or a locking clause)
+// and may be inefficient: use [WithCountQuery] to give a count query explicitly.
+// The placeholders of the LIMIT and OFFSET clauses follow the style ("?" or numbered "$N" or "?N")
+// of query. If query has no placeholders, "$N" is used for Postgres drivers (or with
+// [WithDollarPlaceholders]) and "?" otherwise.
+//
+// The count query runs before the page query, outside of a transaction: the total may not
+// match the page if rows are modified concurrently.
+//
+// The returned func 'close' must be called once the statements are not needed anymore.
+//
+// The options are applied to the page query. Only the options related to the connection
+// ([WithDefaultTimeout], [WithErrorQuery], [WithoutPrepare], [WithArgsCheck], [WithAutoReprepare],
+// [WithStmtPool], [WithDollarPlaceholders], [WithoutClose], [WithNoTxArg]) are also applied to
+// the count query.
+func QueryPage(ctx context.Context, db PrepareConn, query string, fnPtr interface{}, opts ...Option) (close func() error, err error) {
+	o := newOptions(opts)
+	vPtr := reflect.ValueOf(fnPtr)
+	if vPtr.Type().Kind() != reflect.Ptr {
+		panic("fnPtr must be a *pointer* to a func variable")
+	}
+	if vPtr.IsNil() {
+		panic("fnPtr must be non-nil")
+	}
+	fnType := reflect.TypeOf(fnPtr).Elem()
+	if fnType.Kind() != reflect.Func {
+		panic("fnPtr must be a pointer to a *func* variable")
+	}
+	numIn := fnType.NumIn()
+	if numIn < 1 || fnType.In(0) != typeContext {
+		panic("func first arg must be a context.Context")
+	}
+	if numIn < 3 || fnType.IsVariadic() || !isIntKind(fnType.In(numIn-2).Kind()) || !isIntKind(fnType.In(numIn-1).Kind()) {
+		panic("func last args must be limit and offset integers")
+	}
+	if fnType.NumOut() != 3 || fnType.Out(0) != typeRows || !isIntKind(fnType.Out(1).Kind()) || fnType.Out(2) != typeError {
+		panic("func must return (*sql.Rows, int64, error)")
+	}
+
+	in := inTypes(fnType, 0)
+	rowsPtr := reflect.New(reflect.FuncOf(in, []reflect.Type{typeRows, typeError}, false))
+	countPtr := reflect.New(reflect.FuncOf(in[:numIn-2], []reflect.Type{fnType.Out(1), typeError}, false))
+
+	countQuery := o.countQuery
+	if countQuery == "" {
+		countQuery = "SELECT COUNT(*) FROM (" + query + ") sqlfunc_count"
+	}
+
+	closeRows, err := prepareQuery(ctx, db, query+limitOffset(query, o.dollarPlaceholders(db)), rowsPtr.Interface(), o)
+	if err != nil {
+		return func() error { return nil }, err
+	}
+	closeCount, err := prepareQueryRow(ctx, db, countQuery, countPtr.Interface(), o.connOptions())
+	if err != nil {
+		_ = closeRows()
+		return func() error { return nil }, err
+	}
+
+	rowsFn, countFn := rowsPtr.Elem(), countPtr.Elem()
+	fn := func(in []reflect.Value) []reflect.Value {
+		count := countFn.Call(in[:numIn-2])
+		if !count[1].IsNil() {
+			return errorResults(fnType, count[1].Interface().(error))
+		}
+		rows := rowsFn.Call(in)
+		if !rows[1].IsNil() {
+			return errorResults(fnType, rows[1].Interface().(error))
+		}
+		return []reflect.Value{rows[0], count[0], rows[1]}
+	}
+
+	vPtr.Elem().Set(reflect.MakeFunc(fnType, fn))
+
+	return func() error {
+		err := closeRows()
+		if e := closeCount(); err == nil {
+			err = e
+		}
+		return err
+	}, nil
+}
+
+// limitOffset returns the LIMIT and OFFSET clauses to append to query, with placeholders
+// in the style of the placeholders of query. dollar tells which style to use if query has
+// no placeholders.
+func limitOffset(query string, dollar bool) string {
+	if n := countPlaceholders(query, false); n > 0 {
+		placeholders, _ := parsePlaceholders(query)
+		if p := placeholders[0]; p.num > 0 {
+			prefix := query[p.start : p.start+1] // "$" or "?"
+			return fmt.Sprintf(" LIMIT %[1]s%[2]d OFFSET %[1]s%[3]d", prefix, n+1, n+2)
+		}
+	}
+	if dollar {
+		return " LIMIT $1 OFFSET $2"
+	}
+	return " LIMIT ? OFFSET ?"
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func ExampleQueryPage() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	var listNumbers func(ctx context.Context, max int, limit, offset int) (*sql.Rows, int, error)
+	closeList, err := sqlfunc.QueryPage(ctx, db, ``+
+		`WITH RECURSIVE series(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM series WHERE n < ?)`+
+		` SELECT n FROM series ORDER BY n`, &listNumbers)
+	if err != nil {
+		fmt.Println("QueryPage:", err)
+		return
+	}
+	defer closeList()
+
+	const pageSize = 4
+	for offset := 0; ; offset += pageSize {
+		rows, total, err := listNumbers(ctx, 10, pageSize, offset)
+		if err != nil {
+			fmt.Println("listNumbers:", err)
+			return
+		}
+		fmt.Printf("%d-%d/%d:", offset+1, offset+pageSize, total)
+		err = sqlfunc.ForEach(rows, func(n int) {
+			fmt.Print(" ", n)
+		})
+		fmt.Println()
+		if err != nil {
+			fmt.Println("ForEach:", err)
+			return
+		}
+		if offset+pageSize >= total {
+			break
+		}
+	}
+
+	// Output:
+	// 1-4/10: 1 2 3 4
+	// 5-8/10: 5 6 7 8
+	// 9-12/10: 9 10
+}
+
+func TestQueryPage(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	const series = `WITH RECURSIVE series(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM series WHERE n < ?1)` +
+		` SELECT n FROM series WHERE n >= ?2 ORDER BY n`
+
+	var info sqlfunc.StmtInfo
+	var list func(ctx context.Context, max, min int, limit, offset int64) (*sql.Rows, int64, error)
+	closeList, err := sqlfunc.QueryPage(ctx, db, series, &list,
+		sqlfunc.WithCountQuery(`SELECT ?1 - ?2 + 1`),
+		sqlfunc.WithStmtInfo(&info),
+		sqlfunc.WithExpectedColumns([]string{"n"}), // not applied to the count query
+	)
+	if err != nil {
+		t.Fatalf("QueryPage: %v", err)
+	}
+	defer closeList()
+
+	if expected := series + " LIMIT ?3 OFFSET ?4"; info.Query != expected {
+		t.Errorf("page query: got %q, expected %q", info.Query, expected)
+	}
+
+	rows, total, err := list(ctx, 20, 11, 3, 5)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var got []int
+	if err = sqlfunc.ForEach(rows, func(n int) { got = append(got, n) }); err != nil {
+		t.Fatalf("ForEach: %v", err)
+	}
+	if total != 10 || fmt.Sprint(got) != "[16 17 18]" {
+		t.Errorf("got %v/%d, expected [16 17 18]/10", got, total)
+	}
+
+	// A count query that fails to prepare
+	const invalidCount = `SELEKT ?1 - ?2`
+	var list2 func(ctx context.Context, max, min int, limit, offset int64) (*sql.Rows, int64, error)
+	if _, err = sqlfunc.QueryPage(ctx, failingConn{db, invalidCount}, series, &list2, sqlfunc.WithCountQuery(invalidCount)); !errors.Is(err, errPrepare) {
+		t.Errorf("got %v, expected %v", err, errPrepare)
+	}
+
+	// A query without placeholders, for a driver with "$N" placeholders
+	var rec recordConn
+	var list3 func(ctx context.Context, limit, offset int) (*sql.Rows, int, error)
+	_, _ = sqlfunc.QueryPage(ctx, &rec, `SELECT n FROM t`, &list3, sqlfunc.WithDollarPlaceholders())
+	if len(rec) == 0 || rec[0] != `SELECT n FROM t LIMIT $1 OFFSET $2` {
+		t.Errorf("page query: got %q", rec)
+	}
+}
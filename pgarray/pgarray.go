@@ -0,0 +1,219 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package pgarray registers [github.com/dolmen-go/sqlfunc] converters for PostgreSQL arrays.
+//
+// Importing the package (for its side effects) enables the scanning of one-dimensional
+// PostgreSQL arrays (int8[], int4[], text[], varchar[]...) into []int64 and []string destinations
+// by [github.com/dolmen-go/sqlfunc.Scan], [github.com/dolmen-go/sqlfunc.QueryRow] and
+// [github.com/dolmen-go/sqlfunc.ForEach], and the binding of []int64 and []string arguments
+// of the functions created by [github.com/dolmen-go/sqlfunc.Exec],
+// [github.com/dolmen-go/sqlfunc.QueryRow] and [github.com/dolmen-go/sqlfunc.Query]:
+//
+//	import _ "github.com/dolmen-go/sqlfunc/pgarray"
+//
+// The package doesn't depend on a driver: arrays are exchanged in their text representation
+// (such as {1,2,3} or {"a","b c"}), which PostgreSQL drivers return for array columns
+// (lib/pq as []byte, pgx as string) and which PostgreSQL accepts for array parameters.
+//
+// A NULL array is scanned as a nil slice and a nil slice is bound as NULL.
+// Arrays having NULL elements can't be scanned.
+package pgarray
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func init() {
+	sqlfunc.RegisterConverter(reflect.TypeOf([]int64(nil)), sqlfunc.Converter{Scan: scanInt64s, Value: valueInt64s})
+	sqlfunc.RegisterConverter(reflect.TypeOf([]string(nil)), sqlfunc.Converter{Scan: scanStrings, Value: valueStrings})
+}
+
+func scanInt64s(dest interface{}, src interface{}) error {
+	elems, err := parseSrc(src, "[]int64")
+	if err != nil {
+		return err
+	}
+	var a []int64
+	if elems != nil {
+		a = make([]int64, len(elems))
+		for i, e := range elems {
+			if e == nil {
+				return fmt.Errorf("pgarray: converting NULL element %d to int64 is unsupported", i+1)
+			}
+			if a[i], err = strconv.ParseInt(*e, 10, 64); err != nil {
+				return fmt.Errorf("pgarray: converting element %d to int64: %w", i+1, err)
+			}
+		}
+	}
+	*dest.(*[]int64) = a
+	return nil
+}
+
+func valueInt64s(v interface{}) (driver.Value, error) {
+	a := v.([]int64)
+	if a == nil {
+		return nil, nil
+	}
+	b := make([]byte, 0, 2+len(a)*4)
+	b = append(b, '{')
+	for i, n := range a {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendInt(b, n, 10)
+	}
+	return string(append(b, '}')), nil
+}
+
+func scanStrings(dest interface{}, src interface{}) error {
+	elems, err := parseSrc(src, "[]string")
+	if err != nil {
+		return err
+	}
+	var a []string
+	if elems != nil {
+		a = make([]string, len(elems))
+		for i, e := range elems {
+			if e == nil {
+				return fmt.Errorf("pgarray: converting NULL element %d to string is unsupported", i+1)
+			}
+			a[i] = *e
+		}
+	}
+	*dest.(*[]string) = a
+	return nil
+}
+
+func valueStrings(v interface{}) (driver.Value, error) {
+	a := v.([]string)
+	if a == nil {
+		return nil, nil
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, s := range a {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		// Always quote: this handles the empty string, NULL and the special characters
+		b.WriteByte('"')
+		for j := 0; j < len(s); j++ {
+			if s[j] == '"' || s[j] == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(s[j])
+		}
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String(), nil
+}
+
+// parseSrc parses src, a column value, as an array. A NULL array returns a nil slice.
+func parseSrc(src interface{}, typ string) ([]*string, error) {
+	var s string
+	switch src := src.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		s = src
+	case []byte:
+		s = string(src)
+	default:
+		return nil, fmt.Errorf("pgarray: converting %T to %s is unsupported", src, typ)
+	}
+	elems, err := parseArray(s)
+	if err != nil {
+		return nil, fmt.Errorf("pgarray: converting to %s: %w", typ, err)
+	}
+	return elems, nil
+}
+
+var errSyntax = errors.New("invalid array syntax")
+
+// parseArray splits the text representation of a one-dimensional PostgreSQL array
+// into its elements. NULL elements are returned as nil. An empty array returns an empty,
+// non-nil, slice.
+func parseArray(s string) ([]*string, error) {
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		if strings.HasPrefix(s, "[") {
+			return nil, errors.New("arrays with explicit bounds are not supported")
+		}
+		return nil, errSyntax
+	}
+	s = s[1 : len(s)-1]
+	elems := []*string{}
+	if s == "" {
+		return elems, nil
+	}
+	for {
+		var elem *string
+		if s == "" {
+			return nil, errSyntax
+		}
+		switch s[0] {
+		case '{':
+			return nil, errors.New("multi-dimensional arrays are not supported")
+		case '"':
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+					if i == len(s) {
+						break
+					}
+				}
+				b.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, errSyntax // unterminated
+			}
+			e := b.String()
+			elem = &e
+			s = s[i+1:]
+		default:
+			i := strings.IndexByte(s, ',')
+			if i < 0 {
+				i = len(s)
+			}
+			e := strings.TrimSpace(s[:i])
+			if e == "" {
+				return nil, errSyntax
+			}
+			if !strings.EqualFold(e, "NULL") {
+				elem = &e
+			}
+			s = s[i:]
+		}
+		elems = append(elems, elem)
+		if s == "" {
+			return elems, nil
+		}
+		if s[0] != ',' {
+			return nil, errSyntax
+		}
+		s = s[1:]
+	}
+}
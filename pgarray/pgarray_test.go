@@ -0,0 +1,133 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pgarray_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/dolmen-go/sqlfunc"
+	_ "github.com/dolmen-go/sqlfunc/pgarray"
+)
+
+// SQLite stands for PostgreSQL: it returns the text representation of arrays as is.
+
+func Example() {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	var echo func(ctx context.Context, ids []int64, tags []string) ([]int64, []string, error)
+	closeEcho, err := sqlfunc.QueryRow(ctx, db, `SELECT ?, ?`, &echo)
+	if err != nil {
+		fmt.Println("QueryRow:", err)
+		return
+	}
+	defer closeEcho()
+
+	ids, tags, err := echo(ctx, []int64{1, 2, 3}, []string{"a", "b c", `"quoted"`})
+	if err != nil {
+		fmt.Println("echo:", err)
+		return
+	}
+	fmt.Println(ids)
+	fmt.Printf("%q\n", tags)
+
+	// Output:
+	// [1 2 3]
+	// ["a" "b c" "\"quoted\""]
+}
+
+func TestScan(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	var getInts func(ctx context.Context, s *string) ([]int64, error)
+	closeInts, err := sqlfunc.QueryRow(ctx, db, `SELECT ?`, &getInts)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeInts()
+
+	var getStrings func(ctx context.Context, s *string) ([]string, error)
+	closeStrings, err := sqlfunc.QueryRow(ctx, db, `SELECT ?`, &getStrings)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeStrings()
+
+	str := func(s string) *string { return &s }
+
+	for _, tc := range []struct {
+		src  *string
+		ints []int64
+		strs []string
+		err  bool
+	}{
+		{src: nil},
+		{src: str(`{}`), ints: []int64{}, strs: []string{}},
+		{src: str(`{1,-2,3}`), ints: []int64{1, -2, 3}, strs: []string{"1", "-2", "3"}},
+		{src: str(`{a,"b,c","d\"e","f\\g",""}`), strs: []string{"a", "b,c", `d"e`, `f\g`, ""}, err: true},
+		{src: str(`{1,NULL}`), err: true},
+		{src: str(`{{1,2},{3,4}}`), err: true},
+		{src: str(`[0:1]={1,2}`), err: true},
+		{src: str(`{"a}`), err: true},
+		{src: str(`{1,}`), err: true},
+		{src: str(`1,2`), err: true},
+	} {
+		name := "NULL"
+		if tc.src != nil {
+			name = *tc.src
+		}
+		t.Run(name, func(t *testing.T) {
+			ints, err := getInts(ctx, tc.src)
+			if tc.ints == nil && tc.err {
+				if err == nil {
+					t.Errorf("[]int64: error expected, got %v", ints)
+				}
+			} else if err != nil {
+				t.Errorf("[]int64: %v", err)
+			} else if !reflect.DeepEqual(ints, tc.ints) {
+				t.Errorf("[]int64: got %#v, expected %#v", ints, tc.ints)
+			}
+
+			strs, err := getStrings(ctx, tc.src)
+			if tc.strs == nil && tc.err {
+				if err == nil {
+					t.Errorf("[]string: error expected, got %q", strs)
+				}
+			} else if err != nil {
+				t.Errorf("[]string: %v", err)
+			} else if !reflect.DeepEqual(strs, tc.strs) {
+				t.Errorf("[]string: got %#v, expected %#v", strs, tc.strs)
+			}
+		})
+	}
+}
@@ -1,3 +1,23 @@
 package sqlfunc
 
 var InternalRegistry = &registry
+
+// ResetRegistryForTest removes the implementations registered by [ForEach], [Precompile] and
+// [RegisterForEach], so that the next calls pay again the cost of the first call.
+// An implementation that ForEach registers in the background may still be registered after the
+// reset: wait for the pending calls of ForEach before resetting.
+func ResetRegistryForTest() {
+	registry.ForEach.Reset()
+}
+
+var CountPlaceholders = countPlaceholders
+
+var NamedPlaceholders = namedPlaceholders
+
+var ExpandIn = expandIn
+
+var InArgsCount = inArgsCount
+
+var ReplaceLimits = replaceLimits
+
+var PositionalQuery = positionalQuery
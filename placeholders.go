@@ -0,0 +1,346 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// placeholder is a bind parameter found in a query.
+type placeholder struct {
+	start, end int    // position in the query
+	num        int    // N for "$N" and "?N", 0 otherwise
+	name       string // name for ":name" and "@name"
+}
+
+// parsePlaceholders returns the placeholders found in query, outside of string literals,
+// quoted identifiers and comments.
+//
+// ok is false if the query uses syntax that is not handled reliably (backslashes in literals,
+// Postgres dollar-quoted strings, SQL Server bracketed identifiers...).
+func parsePlaceholders(query string) (placeholders []placeholder, ok bool) {
+	n := len(query)
+	for i := 0; i < n; i++ {
+		switch c := query[i]; c {
+		case '\'', '"', '`':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				return nil, false
+			}
+			if c != '`' && strings.IndexByte(query[i+1:i+1+end], '\\') >= 0 {
+				return nil, false // escaping rules depend on the database
+			}
+			i += 1 + end // a doubled quote is read as two consecutive literals
+		case '#':
+			return nil, false // MySQL comment or operator
+		case '[':
+			return nil, false // SQL Server identifier or Postgres array
+		case '-':
+			if i+1 < n && query[i+1] == '-' {
+				end := strings.IndexByte(query[i:], '\n')
+				if end < 0 {
+					return placeholders, true
+				}
+				i += end
+			}
+		case '/':
+			if i+1 < n && query[i+1] == '*' {
+				end := strings.Index(query[i+2:], "*/")
+				if end < 0 {
+					return nil, false
+				}
+				i += 2 + end + 1
+			}
+		case '?':
+			if isQuestionOperator(query, i) {
+				return nil, false // Postgres jsonb operator
+			}
+			j := digitsEnd(query, i+1)
+			p := placeholder{start: i, end: j}
+			if j > i+1 {
+				p.num = atoi(query[i+1 : j])
+			}
+			placeholders = append(placeholders, p)
+			i = j - 1
+		case '$':
+			j := digitsEnd(query, i+1)
+			if j == i+1 {
+				return nil, false // $name or dollar-quoted string
+			}
+			placeholders = append(placeholders, placeholder{start: i, end: j, num: atoi(query[i+1 : j])})
+			i = j - 1
+		case ':', '@':
+			if i+1 < n && query[i+1] == c {
+				i++ // Postgres cast "::", MySQL system variable "@@"
+				continue
+			}
+			if i > 0 && isNameChar(query[i-1]) {
+				continue // part of a word (ex: time literal)
+			}
+			j := i + 1
+			for j < n && isNameChar(query[j]) {
+				j++
+			}
+			if j == i+1 || isDigit(query[i+1]) {
+				continue
+			}
+			placeholders = append(placeholders, placeholder{start: i, end: j, name: query[i+1 : j]})
+			i = j - 1
+		}
+	}
+	return placeholders, true
+}
+
+// isQuestionOperator reports whether the '?' at index i of query is part of an operator
+// (Postgres "?|", "?&", "?-", "?#", "@?") or is the jsonb operator "?" (followed by a literal)
+// instead of a placeholder.
+func isQuestionOperator(query string, i int) bool {
+	if i > 0 && query[i-1] == '@' {
+		return true
+	}
+	if i+1 < len(query) && strings.IndexByte("|&-#", query[i+1]) >= 0 {
+		return true
+	}
+	rest := strings.TrimLeft(query[i+1:], " \t\r\n")
+	return rest != "" && rest[0] == '\''
+}
+
+// countPlaceholders returns the number of arguments expected by query,
+// or -1 if that can't be determined reliably.
+//
+// dollar tells that the driver uses "$N" placeholders: a '?' is then not a placeholder for
+// the driver but an operator, so the count is -1 if query has any.
+func countPlaceholders(query string, dollar bool) int {
+	placeholders, ok := parsePlaceholders(query)
+	if !ok {
+		return -1
+	}
+	var positional, numbered, max int
+	for _, p := range placeholders {
+		switch {
+		case p.name != "":
+			return -1
+		case dollar && query[p.start] == '?':
+			return -1
+		case p.num > 0:
+			numbered++
+			if p.num > max {
+				max = p.num
+			}
+		default:
+			positional++
+		}
+	}
+	switch {
+	case numbered == 0:
+		return positional
+	case positional == 0:
+		return max
+	default:
+		return -1
+	}
+}
+
+// namedPlaceholders returns the distinct names of the named placeholders of query
+// (":name" or "@name"), in order of first appearance, or nil if query has no named placeholders,
+// has other placeholders or can't be parsed reliably.
+func namedPlaceholders(query string) []string {
+	placeholders, ok := parsePlaceholders(query)
+	if !ok {
+		return nil
+	}
+	var names []string
+	seen := make(map[string]bool, len(placeholders))
+	for _, p := range placeholders {
+		if p.name == "" {
+			return nil
+		}
+		if !seen[p.name] {
+			seen[p.name] = true
+			names = append(names, p.name)
+		}
+	}
+	return names
+}
+
+// positionalQuery replaces the named placeholders of query (":name" or "@name"), which must be
+// the only placeholders, with positional ones: "$N" if dollar is set (the same number for all
+// the occurrences of a name), "?" otherwise. names are the names of the arguments, in order.
+func positionalQuery(query string, dollar bool) (q string, names []string, err error) {
+	placeholders, ok := parsePlaceholders(query)
+	if !ok {
+		return "", nil, fmt.Errorf("sqlfunc: query can't be parsed reliably for named placeholders: %q", query)
+	}
+	var b strings.Builder
+	last := 0
+	numbers := make(map[string]int)
+	for _, p := range placeholders {
+		if p.name == "" {
+			return "", nil, fmt.Errorf("sqlfunc: query must have only named placeholders: %q", query)
+		}
+		b.WriteString(query[last:p.start])
+		last = p.end
+		if !dollar {
+			b.WriteByte('?')
+			names = append(names, p.name)
+			continue
+		}
+		n, ok := numbers[p.name]
+		if !ok {
+			names = append(names, p.name)
+			n = len(names)
+			numbers[p.name] = n
+		}
+		b.WriteByte('$')
+		b.WriteString(strconv.Itoa(n))
+	}
+	b.WriteString(query[last:])
+	return b.String(), names, nil
+}
+
+// expandIn replaces the single placeholder of queryTemplate with n placeholders of the same style.
+func expandIn(queryTemplate string, n int) (string, error) {
+	placeholders, ok := parsePlaceholders(queryTemplate)
+	if !ok || len(placeholders) != 1 || placeholders[0].name != "" {
+		return "", fmt.Errorf("sqlfunc: query must have exactly one placeholder for the keys: %q", queryTemplate)
+	}
+	p := placeholders[0]
+	var b strings.Builder
+	b.WriteString(queryTemplate[:p.start])
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte(queryTemplate[p.start]) // "?" or "$"
+		if p.num > 0 {
+			b.WriteString(strconv.Itoa(p.num + i))
+		}
+	}
+	b.WriteString(queryTemplate[p.end:])
+	return b.String(), nil
+}
+
+// inArgsCount returns the number of placeholders for keys in a query expanded by expandIn:
+// keys rounded up to the next power of two, but not beyond max (unless keys is already
+// beyond max).
+func inArgsCount(keys, max int) int {
+	n := 1
+	for n < keys {
+		n <<= 1
+	}
+	if n > max {
+		n = max
+		if n < keys {
+			n = keys
+		}
+	}
+	return n
+}
+
+// replaceLimits replaces the placeholder following each keyword of limits (such as "LIMIT") in
+// query with the integer literal value. Numbered placeholders are renumbered.
+func replaceLimits(query string, limits map[string]int64) (string, error) {
+	placeholders, ok := parsePlaceholders(query)
+	if !ok {
+		return "", fmt.Errorf("sqlfunc: query can't be parsed reliably to replace its LIMIT/OFFSET placeholders: %q", query)
+	}
+	replaced := make([]bool, len(placeholders))
+	var removed []int // numbers of the replaced numbered placeholders
+	found := make(map[string]bool, len(limits))
+	for i, p := range placeholders {
+		kw := strings.ToUpper(wordBefore(query, p.start))
+		if _, ok := limits[kw]; !ok {
+			continue
+		}
+		if found[kw] {
+			return "", fmt.Errorf("sqlfunc: query has multiple %s placeholders: %q", kw, query)
+		}
+		found[kw] = true
+		replaced[i] = true
+		if p.num > 0 {
+			removed = append(removed, p.num)
+		}
+	}
+	for kw := range limits {
+		if !found[kw] {
+			return "", fmt.Errorf("sqlfunc: query has no %s placeholder: %q", kw, query)
+		}
+	}
+
+	var b strings.Builder
+	last := 0
+	for i, p := range placeholders {
+		if !replaced[i] && (p.num == 0 || len(removed) == 0) {
+			continue
+		}
+		b.WriteString(query[last:p.start])
+		last = p.end
+		if replaced[i] {
+			b.WriteString(strconv.FormatInt(limits[strings.ToUpper(wordBefore(query, p.start))], 10))
+			continue
+		}
+		num := p.num
+		for _, r := range removed {
+			if r == p.num {
+				return "", fmt.Errorf("sqlfunc: placeholder %s is used outside of LIMIT/OFFSET: %q", query[p.start:p.end], query)
+			}
+			if r < p.num {
+				num--
+			}
+		}
+		b.WriteByte(query[p.start]) // "?" or "$"
+		b.WriteString(strconv.Itoa(num))
+	}
+	b.WriteString(query[last:])
+	return b.String(), nil
+}
+
+// wordBefore returns the word that precedes position i of s, skipping spaces.
+func wordBefore(s string, i int) string {
+	for i > 0 && (s[i-1] == ' ' || s[i-1] == '\t' || s[i-1] == '\n' || s[i-1] == '\r') {
+		i--
+	}
+	end := i
+	for i > 0 && isNameChar(s[i-1]) {
+		i--
+	}
+	return s[i:end]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func digitsEnd(s string, i int) int {
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
+
+func atoi(s string) (n int) {
+	for i := 0; i < len(s); i++ {
+		n = n*10 + int(s[i]-'0')
+	}
+	return
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func TestCountPlaceholders(t *testing.T) {
+	for _, tc := range []struct {
+		query  string
+		n      int
+		dollar bool
+	}{
+		{`SELECT 1`, 0, false},
+		{`SELECT ?`, 1, false},
+		{`SELECT ?, ?, ?`, 3, false},
+		{`SELECT $1, $2, $1`, 2, false},
+		{`SELECT ?2, ?1`, 2, false},
+		{`SELECT '?', "?", ` + "`?`" + `, ?`, 1, false},
+		{`SELECT 'it''s ?', ?`, 1, false},
+		{"SELECT ? -- ?\n, ?", 2, false},
+		{`SELECT ? /* ? */, ?`, 2, false},
+		{`SELECT ?::int, ?`, 2, false},
+		{`SELECT :name`, -1, false},
+		{`SELECT @name`, -1, false},
+		{`SELECT ?, $1`, -1, false},
+		{`SELECT $name`, -1, false},
+		{`SELECT $$?$$`, -1, false},
+		{`SELECT 'a\'?'`, -1, false},
+		{`SELECT "a\"?b"`, -1, false},
+		{`SELECT [a?b], ?`, -1, false},
+		{"SELECT `a\\`, ?", 1, false},
+		{`SELECT ? # ?`, -1, false},
+		{`SELECT 'unterminated`, -1, false},
+		// Postgres jsonb operators
+		{`SELECT data ? 'a' FROM t WHERE id = ?`, -1, false},
+		{`SELECT data ?| array['a', 'b'] FROM t`, -1, false},
+		{`SELECT data ?& array['a'] FROM t`, -1, false},
+		{`SELECT data @? '$.a' FROM t`, -1, false},
+		{`SELECT id FROM t WHERE id=? AND name=?`, 2, false},
+		// "$N" drivers: '?' is an operator
+		{`SELECT $1, $2`, 2, true},
+		{`SELECT data ? $1 FROM t`, -1, true},
+	} {
+		if n := sqlfunc.CountPlaceholders(tc.query, tc.dollar); n != tc.n {
+			t.Errorf("%s (dollar: %t): got %d, expected %d", tc.query, tc.dollar, n, tc.n)
+		}
+	}
+}
+
+func TestNamedPlaceholders(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		names []string
+	}{
+		{`SELECT 1`, nil},
+		{`SELECT :a, @b, :a`, []string{"a", "b"}},
+		{`SELECT :a::int, ':b', '12:30'`, []string{"a"}},
+		{`SELECT :a, ?`, nil},
+		{`SELECT :a, $1`, nil},
+		{`SELECT :a # comment`, nil},
+	} {
+		if names := sqlfunc.NamedPlaceholders(tc.query); strings.Join(names, ",") != strings.Join(tc.names, ",") || (names == nil) != (tc.names == nil) {
+			t.Errorf("%s: got %q, expected %q", tc.query, names, tc.names)
+		}
+	}
+}
+
+func TestExpandIn(t *testing.T) {
+	for _, tc := range []struct {
+		query    string
+		expanded string
+	}{
+		{`SELECT name FROM t WHERE id IN (?)`, `SELECT name FROM t WHERE id IN (?, ?, ?)`},
+		{`SELECT name FROM t WHERE id IN (?1) -- ?`, `SELECT name FROM t WHERE id IN (?1, ?2, ?3) -- ?`},
+		{`SELECT '?' FROM t WHERE id IN ($1)`, `SELECT '?' FROM t WHERE id IN ($1, $2, $3)`},
+		{`SELECT name FROM t`, ""},
+		{`SELECT name FROM t WHERE id IN (?) AND k = ?`, ""},
+		{`SELECT name FROM t WHERE id IN (:ids)`, ""},
+	} {
+		expanded, err := sqlfunc.ExpandIn(tc.query, 3)
+		if expanded != tc.expanded || (err == nil) != (tc.expanded != "") {
+			t.Errorf("%s: got %q, %v, expected %q", tc.query, expanded, err, tc.expanded)
+		}
+	}
+}
+
+func TestInArgsCount(t *testing.T) {
+	for _, tc := range []struct {
+		keys, max, n int
+	}{
+		{1, 65535, 1},
+		{3, 65535, 4},
+		{4, 65535, 4},
+		{40000, 65535, 65535},
+		{20000, 32766, 32766},
+		{40000, 32766, 40000},
+		{65535, 65535, 65535},
+	} {
+		if n := sqlfunc.InArgsCount(tc.keys, tc.max); n != tc.n {
+			t.Errorf("%d keys, max %d: got %d, expected %d", tc.keys, tc.max, n, tc.n)
+		}
+	}
+}
+
+func TestReplaceLimits(t *testing.T) {
+	limits := map[string]int64{"LIMIT": 10, "OFFSET": 20}
+	for _, tc := range []struct {
+		query    string
+		replaced string
+	}{
+		{`SELECT name FROM t WHERE k = ? LIMIT ? OFFSET ?`, `SELECT name FROM t WHERE k = ? LIMIT 10 OFFSET 20`},
+		{"SELECT name FROM t\nlimit\n\t? offset ? -- ?", "SELECT name FROM t\nlimit\n\t10 offset 20 -- ?"},
+		{`SELECT name FROM t WHERE k = $1 LIMIT $2 OFFSET $3`, `SELECT name FROM t WHERE k = $1 LIMIT 10 OFFSET 20`},
+		{`SELECT name FROM t WHERE k = $3 LIMIT $1 OFFSET $2`, `SELECT name FROM t WHERE k = $1 LIMIT 10 OFFSET 20`},
+		{`SELECT name FROM t WHERE k = :k LIMIT :limit OFFSET :offset`, `SELECT name FROM t WHERE k = :k LIMIT 10 OFFSET 20`},
+		{`SELECT name FROM t LIMIT ?`, ""},          // no OFFSET
+		{`SELECT name FROM t LIMIT 5 OFFSET ?`, ""}, // no LIMIT placeholder
+		{`SELECT name FROM t LIMIT $1 OFFSET $2 -- $1`, `SELECT name FROM t LIMIT 10 OFFSET 20 -- $1`},
+		{`SELECT $1 FROM t LIMIT $1 OFFSET $2`, ""},                     // $1 reused
+		{`SELECT name FROM t WHERE k = 'it''s' LIMIT ? OFFSET ? #`, ""}, // can't parse
+	} {
+		replaced, err := sqlfunc.ReplaceLimits(tc.query, limits)
+		if replaced != tc.replaced || (err == nil) != (tc.replaced != "") {
+			t.Errorf("%s: got %q, %v, expected %q", tc.query, replaced, err, tc.replaced)
+		}
+	}
+}
+
+func TestPositionalQuery(t *testing.T) {
+	for _, tc := range []struct {
+		query  string
+		dollar bool
+		q      string
+		names  string
+	}{
+		{`INSERT INTO t (a, b) VALUES (:a, @b)`, false, `INSERT INTO t (a, b) VALUES (?, ?)`, "[a b]"},
+		{`SELECT :a, ':b', :a::text`, false, `SELECT ?, ':b', ?::text`, "[a a]"},
+		{`SELECT :a, ':b', :a::text`, true, `SELECT $1, ':b', $1::text`, "[a]"},
+		{`SELECT :a, :b, :a`, true, `SELECT $1, $2, $1`, "[a b]"},
+		{`SELECT 1`, true, `SELECT 1`, "[]"},
+		{`SELECT :a, ?`, false, "", ""},
+		{`SELECT :a # comment`, false, "", ""},
+	} {
+		q, names, err := sqlfunc.PositionalQuery(tc.query, tc.dollar)
+		if q != tc.q || (err == nil) != (tc.q != "") || (err == nil && fmt.Sprint(names) != tc.names) {
+			t.Errorf("%s: got %q, %q, %v, expected %q, %s", tc.query, q, names, err, tc.q, tc.names)
+		}
+	}
+}
+
+func TestArgsCountMismatch(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	expectPanic := func(t *testing.T, f func()) {
+		t.Helper()
+		defer func() {
+			r := recover()
+			if r == nil {
+				t.Fatal("panic expected")
+			}
+			if msg, _ := r.(string); !strings.Contains(msg, "binds 1 arguments but the query expects 2") {
+				t.Errorf("unexpected panic: %v", r)
+			}
+		}()
+		f()
+	}
+
+	t.Run("Exec", func(t *testing.T) {
+		var f func(ctx context.Context, a int) (sql.Result, error)
+		expectPanic(t, func() { sqlfunc.Exec(ctx, db, `SELECT ?, ?`, &f) })
+	})
+	t.Run("Exec-tx", func(t *testing.T) {
+		var f func(ctx context.Context, tx *sql.Tx, a int) (sql.Result, error)
+		expectPanic(t, func() { sqlfunc.Exec(ctx, db, `SELECT ?, ?`, &f) })
+	})
+	t.Run("QueryRow", func(t *testing.T) {
+		var f func(ctx context.Context, a int) (int, error)
+		expectPanic(t, func() { sqlfunc.QueryRow(ctx, db, `SELECT $1 + $2`, &f) })
+	})
+	t.Run("Query", func(t *testing.T) {
+		var f func(ctx context.Context, a int) (*sql.Rows, error)
+		expectPanic(t, func() { sqlfunc.Query(ctx, db, `SELECT ?, ?`, &f) })
+	})
+
+	t.Run("runtime", func(t *testing.T) {
+		// Named parameters are not counted: the mismatch is reported by the driver
+		var f func(ctx context.Context, a int) (int, error)
+		close, err := sqlfunc.QueryRow(ctx, db, `SELECT :a + :b`, &f)
+		if err != nil {
+			t.Fatalf("QueryRow: %v", err)
+		}
+		defer close()
+		_, err = f(ctx, 1)
+		if err == nil || !strings.Contains(err.Error(), "func(context.Context, int) (int, error)") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ArgsProvider", func(t *testing.T) {
+		// The number of arguments is known at call time
+		var f func(ctx context.Context, args *providedArgs) (*sql.Rows, error)
+		close, err := sqlfunc.Query(ctx, db, `SELECT ?, ?`, &f)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		defer close()
+		_, err = f(ctx, &providedArgs{A: 1, B: 2})
+		if err == nil || !strings.Contains(err.Error(), "expected 2 arguments, got 3") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,8 @@
+module github.com/dolmen-go/sqlfunc/protoscan
+
+go 1.23
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.22
+	google.golang.org/protobuf v1.36.11
+)
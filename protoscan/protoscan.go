@@ -0,0 +1,216 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package protoscan scans SQL rows into protobuf messages.
+//
+// The fields of the message are populated through [protoreflect], so any message is supported:
+// generated code or [google.golang.org/protobuf/types/dynamicpb]. This package is a separate
+// module to keep [github.com/dolmen-go/sqlfunc] free from the protobuf dependency.
+//
+// Supported field kinds are the scalars (bool, integers, floating points, string, bytes), enums
+// (from the number or the name) and [google.golang.org/protobuf/types/known/timestamppb.Timestamp].
+// Repeated, map and other message fields are not supported. A NULL value clears the field.
+package protoscan
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const timestampName protoreflect.FullName = "google.protobuf.Timestamp"
+
+// Mapping maps column names to the names (as in the .proto file) of message fields.
+// A column absent from the mapping is stored in the field with the same name.
+type Mapping map[string]string
+
+// Scan scans the current row of rows into msg (see [sql.Rows.Scan]).
+//
+// Each column is stored in the field named by mapping (the column name by default). A column
+// without a matching field is an error.
+func Scan(rows *sql.Rows, msg proto.Message, mapping Mapping) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	m := msg.ProtoReflect()
+	fields, err := mapping.fields(m.Descriptor(), columns)
+	if err != nil {
+		return err
+	}
+	dest := make([]interface{}, len(fields))
+	for i, fd := range fields {
+		dest[i] = newDest(fd)
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return err
+	}
+	for i, fd := range fields {
+		if t, isTime := dest[i].(*sql.NullTime); isTime {
+			if !t.Valid {
+				m.Clear(fd)
+				continue
+			}
+			m.Set(fd, protoreflect.ValueOfMessage(timestamp(m.NewField(fd).Message(), t.Time)))
+			continue
+		}
+		v, ok, err := value(fd, dest[i])
+		if err != nil {
+			return fmt.Errorf("protoscan: column %q: %w", columns[i], err)
+		}
+		if !ok {
+			m.Clear(fd)
+			continue
+		}
+		m.Set(fd, v)
+	}
+	return nil
+}
+
+// ForEach scans each row of rows into a new message obtained from newMsg and calls cb with it.
+// rows are closed before returning.
+func ForEach(rows *sql.Rows, newMsg func() proto.Message, mapping Mapping, cb func(proto.Message) error) (err error) {
+	defer func() {
+		if e := rows.Close(); err == nil {
+			err = e
+		}
+	}()
+	for rows.Next() {
+		msg := newMsg()
+		if err = Scan(rows, msg, mapping); err != nil {
+			return err
+		}
+		if err = cb(msg); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// fields returns the descriptors of the fields matching the columns.
+func (mapping Mapping) fields(md protoreflect.MessageDescriptor, columns []string) ([]protoreflect.FieldDescriptor, error) {
+	fields := make([]protoreflect.FieldDescriptor, len(columns))
+	for i, col := range columns {
+		name := col
+		if n, ok := mapping[col]; ok {
+			name = n
+		}
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return nil, fmt.Errorf("protoscan: column %q: no field %q in %s", col, name, md.FullName())
+		}
+		if fd.IsList() || fd.IsMap() || (fd.Message() != nil && fd.Message().FullName() != timestampName) {
+			return nil, fmt.Errorf("protoscan: column %q: field %s: unsupported type", col, fd.FullName())
+		}
+		fields[i] = fd
+	}
+	return fields, nil
+}
+
+// newDest returns the destination for scanning a value for the field fd.
+func newDest(fd protoreflect.FieldDescriptor) interface{} {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return new(sql.NullBool)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return new(sql.NullInt64)
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return new(sql.NullFloat64)
+	case protoreflect.StringKind, protoreflect.EnumKind:
+		return new(sql.NullString)
+	case protoreflect.BytesKind:
+		return new([]byte)
+	case protoreflect.MessageKind: // Timestamp
+		return new(sql.NullTime)
+	default:
+		return new(interface{})
+	}
+}
+
+var errRange = errors.New("value out of range")
+
+// value converts the scanned dest to the value of field fd. ok is false for NULL.
+func value(fd protoreflect.FieldDescriptor, dest interface{}) (v protoreflect.Value, ok bool, err error) {
+	switch d := dest.(type) {
+	case *sql.NullBool:
+		return protoreflect.ValueOfBool(d.Bool), d.Valid, nil
+	case *sql.NullInt64:
+		if !d.Valid {
+			return v, false, nil
+		}
+		n := d.Int64
+		switch fd.Kind() {
+		case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+			if n < math.MinInt32 || n > math.MaxInt32 {
+				return v, false, errRange
+			}
+			return protoreflect.ValueOfInt32(int32(n)), true, nil
+		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+			if n < 0 || n > math.MaxUint32 {
+				return v, false, errRange
+			}
+			return protoreflect.ValueOfUint32(uint32(n)), true, nil
+		case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+			if n < 0 {
+				return v, false, errRange
+			}
+			return protoreflect.ValueOfUint64(uint64(n)), true, nil
+		default:
+			return protoreflect.ValueOfInt64(n), true, nil
+		}
+	case *sql.NullFloat64:
+		if fd.Kind() == protoreflect.FloatKind {
+			return protoreflect.ValueOfFloat32(float32(d.Float64)), d.Valid, nil
+		}
+		return protoreflect.ValueOfFloat64(d.Float64), d.Valid, nil
+	case *sql.NullString:
+		if !d.Valid {
+			return v, false, nil
+		}
+		if fd.Kind() != protoreflect.EnumKind {
+			return protoreflect.ValueOfString(d.String), true, nil
+		}
+		if n, err := strconv.ParseInt(d.String, 10, 32); err == nil {
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), true, nil
+		}
+		ev := fd.Enum().Values().ByName(protoreflect.Name(d.String))
+		if ev == nil {
+			return v, false, fmt.Errorf("invalid %s value %q", fd.Enum().FullName(), d.String)
+		}
+		return protoreflect.ValueOfEnum(ev.Number()), true, nil
+	case *[]byte:
+		return protoreflect.ValueOfBytes(*d), *d != nil, nil
+	default:
+		return v, false, fmt.Errorf("field %s: unsupported type", fd.FullName())
+	}
+}
+
+// timestamp fills the google.protobuf.Timestamp message m with t.
+func timestamp(m protoreflect.Message, t time.Time) protoreflect.Message {
+	fields := m.Descriptor().Fields()
+	m.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(t.Unix()))
+	m.Set(fields.ByName("nanos"), protoreflect.ValueOfInt32(int32(t.Nanosecond())))
+	return m
+}
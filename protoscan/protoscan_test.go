@@ -0,0 +1,210 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protoscan_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/dolmen-go/sqlfunc/protoscan"
+)
+
+// poiDescriptor builds the descriptor of this message (usually obtained from generated code):
+//
+//	message POI {
+//	  string name = 1;
+//	  double latitude = 2;
+//	  double longitude = 3;
+//	  Kind kind = 4;
+//	  google.protobuf.Timestamp updated = 5;
+//	  enum Kind { UNKNOWN = 0; CASTLE = 1; MONUMENT = 2; }
+//	}
+func poiDescriptor() protoreflect.MessageDescriptor {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	enumValue := func(name string, number int32) *descriptorpb.EnumValueDescriptorProto {
+		return &descriptorpb.EnumValueDescriptorProto{Name: proto.String(name), Number: proto.Int32(number)}
+	}
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("poi.proto"),
+		Package:    proto.String("example"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("POI"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("latitude", 2, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+				field("longitude", 3, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+				field("kind", 4, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".example.POI.Kind"),
+				field("updated", 5, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+			},
+			EnumType: []*descriptorpb.EnumDescriptorProto{{
+				Name:  proto.String("Kind"),
+				Value: []*descriptorpb.EnumValueDescriptorProto{enumValue("UNKNOWN", 0), enumValue("CASTLE", 1), enumValue("MONUMENT", 2)},
+			}},
+		}},
+	}
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		panic(err)
+	}
+	return fd.Messages().ByName("POI")
+}
+
+func Example() {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", "file:../testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `SELECT name, lat, lon FROM poi ORDER BY name`)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+
+	poi := poiDescriptor()
+	mapping := protoscan.Mapping{"lat": "latitude", "lon": "longitude"}
+	err = protoscan.ForEach(rows, func() proto.Message {
+		return dynamicpb.NewMessage(poi)
+	}, mapping, func(msg proto.Message) error {
+		m := msg.ProtoReflect()
+		fields := m.Descriptor().Fields()
+		fmt.Printf("%s (%.4f %.4f)\n",
+			m.Get(fields.ByName("name")).String(),
+			m.Get(fields.ByName("latitude")).Float(),
+			m.Get(fields.ByName("longitude")).Float(),
+		)
+		return nil
+	})
+	if err != nil {
+		fmt.Println("ForEach:", err)
+	}
+
+	// Output:
+	// Château de Versailles (48.8016 2.1204)
+	// Villeperdue (47.2009 0.6317)
+}
+
+func TestScan(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	// The declared type of the column lets the driver return a time.Time
+	if _, err = db.ExecContext(ctx, `CREATE TABLE t (updated DATETIME)`); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	updated := time.Date(2022, 5, 4, 12, 30, 0, 0, time.UTC)
+	if _, err = db.ExecContext(ctx, `INSERT INTO t (updated) VALUES (?)`, updated); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	poi := poiDescriptor()
+
+	for _, tc := range []struct {
+		query string
+		check func(t *testing.T, msg protoreflect.Message)
+		err   bool
+	}{{
+		query: `SELECT 'Louvre' AS name, 'MONUMENT' AS kind, updated FROM t`,
+		check: func(t *testing.T, msg protoreflect.Message) {
+			fields := poi.Fields()
+			if got := msg.Get(fields.ByName("kind")).Enum(); got != 2 {
+				t.Errorf("kind: got %d", got)
+			}
+			var ts timestamppb.Timestamp
+			proto.Merge(&ts, msg.Get(fields.ByName("updated")).Message().Interface())
+			if !ts.AsTime().Equal(updated) {
+				t.Errorf("updated: got %v", ts.AsTime())
+			}
+		},
+	}, {
+		query: `SELECT NULL AS name, 1 AS kind, NULL AS updated`,
+		check: func(t *testing.T, msg protoreflect.Message) {
+			fields := poi.Fields()
+			if msg.Has(fields.ByName("name")) || msg.Has(fields.ByName("updated")) {
+				t.Error("NULL must clear the field")
+			}
+			if got := msg.Get(fields.ByName("kind")).Enum(); got != 1 {
+				t.Errorf("kind: got %d", got)
+			}
+		},
+	}, {
+		query: `SELECT 'CHURCH' AS kind`,
+		err:   true,
+	}, {
+		query: `SELECT 1 AS unknown`,
+		err:   true,
+	}} {
+		t.Run(tc.query, func(t *testing.T) {
+			rows, err := db.QueryContext(ctx, tc.query)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			defer rows.Close()
+			if !rows.Next() {
+				t.Fatalf("no row: %v", rows.Err())
+			}
+			msg := dynamicpb.NewMessage(poi)
+			// Pre-fill to check that NULL clears the field
+			msg.Set(poi.Fields().ByName("name"), protoreflect.ValueOfString("x"))
+			err = protoscan.Scan(rows, msg, nil)
+			if tc.err {
+				if err == nil {
+					t.Fatal("error expected")
+				}
+				t.Log(err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+			tc.check(t, msg)
+		})
+	}
+}
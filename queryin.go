@@ -0,0 +1,181 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// InStmts holds the statements prepared by [QueryInCollect] on a connection, for each query
+// template and number of keys. Create it with [NewInStmts].
+type InStmts struct {
+	db      PrepareConn
+	maxArgs int
+
+	m      sync.Mutex
+	stmts  map[inStmtKey]*sql.Stmt
+	closed bool
+}
+
+type inStmtKey struct {
+	query string // the template
+	n     int    // the number of placeholders
+}
+
+// NewInStmts creates the cache of the statements prepared on db by [QueryInCollect].
+//
+// The statements stay open until [InStmts.Close] is called, which must be done before
+// closing db (or ending the transaction if db is an [*sql.Tx]).
+func NewInStmts(db PrepareConn) *InStmts {
+	return &InStmts{
+		db:      db,
+		maxArgs: maxArgs(driverPkgPath(db)),
+	}
+}
+
+// maxArgs returns the maximum number of arguments of a statement for driver (65535 for
+// Postgres and MySQL, which is also the default if the driver is unknown).
+func maxArgs(driver string) int {
+	switch {
+	case isSQLiteDriver(driver):
+		return 32766
+	case driver == "github.com/denisenkom/go-mssqldb" || driver == "github.com/microsoft/go-mssqldb":
+		return 2100
+	}
+	return 65535
+}
+
+// QueryInCollect runs queryTemplate with its placeholder expanded into one placeholder per key,
+// and collects the rows returned with scan. This is the "fetch many by ids" pattern:
+//
+//	users, err := sqlfunc.QueryInCollect(ctx, inStmts,
+//		`SELECT id, name FROM user WHERE id IN (?)`, ids,
+//		func(rows *sql.Rows) (u user, err error) {
+//			err = rows.Scan(&u.ID, &u.Name)
+//			return
+//		})
+//
+// queryTemplate must have exactly one placeholder ("?", "?N" or "$N"): it is replaced by as
+// many placeholders of the same style as needed ("?, ?, ?" or "$1, $2, $3").
+// The registered converters are applied to keys. No query is run if keys is empty.
+//
+// The statements are prepared and cached in s for each number of placeholders and
+// queryTemplate. The number of placeholders is rounded up to the next power of two (the last
+// key is repeated, which doesn't change the result of IN) to bound the number of statements,
+// but not beyond the maximum number of arguments supported by the driver.
+// After [InStmts.Close], QueryInCollect returns [ErrClosed].
+func QueryInCollect[T, K any](ctx context.Context, s *InStmts, queryTemplate string, keys []K, scan func(*sql.Rows) (T, error)) ([]T, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	n := inArgsCount(len(keys), s.maxArgs)
+	args := make([]interface{}, n)
+	for i := range args {
+		if i < len(keys) {
+			args[i] = keys[i]
+		} else {
+			args[i] = keys[len(keys)-1]
+		}
+	}
+	args, err := bindValues(args)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := s.stmt(ctx, queryTemplate, n)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]T, 0, len(keys))
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, rows.Close()
+}
+
+// stmt returns the statement for queryTemplate expanded to n placeholders, from the cache or
+// prepared on s.db.
+func (s *InStmts) stmt(ctx context.Context, queryTemplate string, n int) (*sql.Stmt, error) {
+	key := inStmtKey{queryTemplate, n}
+	s.m.Lock()
+	stmt, closed := s.stmts[key], s.closed
+	s.m.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	if stmt != nil {
+		return stmt, nil
+	}
+
+	query, err := expandIn(queryTemplate, n)
+	if err != nil {
+		return nil, err
+	}
+	// Prepare outside of the lock: concurrent calls may prepare the same statement
+	stmt, err = s.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.closed {
+		stmt.Close()
+		return nil, ErrClosed
+	}
+	if st := s.stmts[key]; st != nil {
+		stmt.Close()
+		return st, nil
+	}
+	if s.stmts == nil {
+		s.stmts = make(map[inStmtKey]*sql.Stmt)
+	}
+	s.stmts[key] = stmt
+	return stmt, nil
+}
+
+// Close closes the statements prepared by [QueryInCollect].
+// The first error from closing a statement is returned.
+func (s *InStmts) Close() (err error) {
+	s.m.Lock()
+	stmts := s.stmts
+	s.stmts = nil
+	s.closed = true
+	s.m.Unlock()
+	for _, stmt := range stmts {
+		if e := stmt.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
@@ -0,0 +1,127 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+type user struct {
+	ID   int64
+	Name string
+}
+
+func scanUser(rows *sql.Rows) (u user, err error) {
+	err = rows.Scan(&u.ID, &u.Name)
+	return
+}
+
+func ExampleQueryInCollect() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+	inStmts := sqlfunc.NewInStmts(db)
+	defer inStmts.Close()
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE user (id INTEGER, name TEXT);`+
+		`INSERT INTO user VALUES (1, 'alice'), (2, 'bob'), (3, 'carol'), (4, 'dave')`)
+	if err != nil {
+		fmt.Println("Create:", err)
+		return
+	}
+
+	users, err := sqlfunc.QueryInCollect(ctx, inStmts,
+		`SELECT id, name FROM user WHERE id IN (?) ORDER BY id`, []int64{4, 1, 3},
+		scanUser)
+	if err != nil {
+		fmt.Println("QueryInCollect:", err)
+		return
+	}
+	for _, u := range users {
+		fmt.Println(u.ID, u.Name)
+	}
+
+	// Output:
+	// 1 alice
+	// 3 carol
+	// 4 dave
+}
+
+func TestQueryInCollect(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	inStmts := sqlfunc.NewInStmts(db)
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE user (id INTEGER, name TEXT);`+
+		`INSERT INTO user VALUES (1, 'alice'), (2, 'bob'), (3, 'carol'), (4, 'dave')`)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	const query = `SELECT id, name FROM user WHERE id IN (?1) ORDER BY id`
+	for _, tc := range []struct {
+		ids   []int64
+		names string
+	}{
+		{nil, "[]"},
+		{[]int64{2}, "[bob]"},
+		{[]int64{2, 5}, "[bob]"},
+		{[]int64{3, 2, 1}, "[alice bob carol]"},
+		{[]int64{1, 2, 3, 4, 5}, "[alice bob carol dave]"},
+	} {
+		users, err := sqlfunc.QueryInCollect(ctx, inStmts, query, tc.ids, scanUser)
+		if err != nil {
+			t.Errorf("%v: %v", tc.ids, err)
+			continue
+		}
+		names := make([]string, len(users))
+		for i, u := range users {
+			names[i] = u.Name
+		}
+		if got := fmt.Sprint(names); got != tc.names {
+			t.Errorf("%v: got %s, expected %s", tc.ids, got, tc.names)
+		}
+	}
+
+	if _, err = sqlfunc.QueryInCollect(ctx, inStmts, `SELECT id, name FROM user`, []int64{1}, scanUser); err == nil {
+		t.Error("error expected for a query without placeholder")
+	}
+
+	if err = inStmts.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if _, err = sqlfunc.QueryInCollect(ctx, inStmts, query, []int64{1}, scanUser); !errors.Is(err, sqlfunc.ErrClosed) {
+		t.Errorf("got %v, expected %v", err, sqlfunc.ErrClosed)
+	}
+}
@@ -3,6 +3,7 @@ package sqlfunc
 import (
 	"database/sql"
 	"reflect"
+	"sort"
 	"sync"
 	"sync/atomic"
 )
@@ -25,6 +26,7 @@ type registryForEach struct {
 	disabled uint32
 	m        sync.RWMutex
 	r        map[reflect.Type]funcForEach
+	count    uint64 // number of calls to Register, for tests
 }
 
 func (r *registryForEach) Disable(ig bool) {
@@ -51,4 +53,69 @@ func (r *registryForEach) Register(t interface{}, f funcForEach) {
 	r.m.Lock()
 	defer r.m.Unlock()
 	r.r[reflect.TypeOf(t)] = f
+	r.count++
+}
+
+// Reset removes all the registrations.
+func (r *registryForEach) Reset() {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.r = make(map[reflect.Type]funcForEach)
+}
+
+func (r *registryForEach) Count() uint64 {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return r.count
+}
+
+func (r *registryForEach) Types() []reflect.Type {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	types := make([]reflect.Type, 0, len(r.r))
+	for t := range r.r {
+		types = append(types, t)
+	}
+	return types
+}
+
+// RegisteredTypes returns the func types that have an implementation registered
+// in the internal registries, sorted by their string representation.
+//
+// RegisteredTypes is intended for diagnostics only (for example to check that
+// generated code registered all the call sites). It exposes internal details
+// that may change without notice.
+func RegisteredTypes() []reflect.Type {
+	types := registry.ForEach.Types()
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].String() < types[j].String()
+	})
+	return types
+}
+
+// Precompile builds and registers upfront the implementations of [ForEach] for the given callbacks,
+// so that the first call of ForEach with a callback of the same type has no setup cost and doesn't
+// register the implementation from a background goroutine.
+//
+// Each item is either a callback (only its type matters, so a typed nil func is enough)
+// or a pointer to a func variable holding a callback.
+// Precompile panics if an item isn't a valid callback for ForEach.
+//
+// The functions created by [Scan], [Exec], [QueryRow] and [Query] are built eagerly and
+// don't need precompilation.
+func Precompile(callbacks ...interface{}) {
+	for _, cb := range callbacks {
+		fnType := reflect.TypeOf(cb)
+		if fnType == nil {
+			panic("callback must be a func")
+		}
+		if fnType.Kind() == reflect.Ptr {
+			fnType = fnType.Elem()
+		}
+		if registry.ForEach.Get(fnType) != nil {
+			continue
+		}
+		r := newRunForEach(fnType)
+		registry.ForEach.Register(reflect.Zero(fnType).Interface(), r.run)
+	}
 }
@@ -0,0 +1,62 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"database/sql"
+	"reflect"
+)
+
+// RegisterForEach registers impl as the implementation of [ForEach] for the callbacks of type
+// Func, instead of the implementation based on reflection. impl receives the rows and the
+// callback given to ForEach, and must follow the contract of ForEach (including the closing of
+// rows). This allows to hand-optimize hot iterations:
+//
+//	sqlfunc.RegisterForEach[func(id int64, name string)](func(rows *sql.Rows, callback any) (err error) {
+//		defer func() {
+//			if e := rows.Close(); err == nil {
+//				err = e
+//			}
+//		}()
+//		cb := callback.(func(int64, string))
+//		for rows.Next() {
+//			var id int64
+//			var name string
+//			if err = rows.Scan(&id, &name); err != nil {
+//				return err
+//			}
+//			cb(id, name)
+//		}
+//		return rows.Err()
+//	})
+//
+// impl is used only by the calls of ForEach without options. Register it before the first call
+// of ForEach with a callback of type Func (for example in an init func), or it may be replaced
+// by the implementation that ForEach registers in the background.
+//
+// RegisterForEach panics if Func isn't a valid callback type for ForEach.
+func RegisterForEach[Func any](impl func(rows *sql.Rows, callback any) error) {
+	if impl == nil {
+		panic("impl must be non-nil")
+	}
+	fnType := reflect.TypeOf((*Func)(nil)).Elem()
+	newRunForEach(fnType) // check the callback type
+	registry.ForEach.Register(reflect.Zero(fnType).Interface(), impl)
+}
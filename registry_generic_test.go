@@ -0,0 +1,85 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func TestRegisterForEach(t *testing.T) {
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	type id int32
+	type callback = func(n id, s string) bool
+
+	var calls int
+	sqlfunc.RegisterForEach[callback](func(rows *sql.Rows, cb any) (err error) {
+		calls++
+		defer func() {
+			if e := rows.Close(); err == nil {
+				err = e
+			}
+		}()
+		f := cb.(callback)
+		for rows.Next() {
+			var n id
+			var s string
+			if err = rows.Scan(&n, &s); err != nil {
+				return err
+			}
+			if !f(n, s) {
+				break
+			}
+		}
+		return rows.Err()
+	})
+
+	rows, err := db.Query(`SELECT 1, 'a' UNION ALL SELECT 2, 'b' UNION ALL SELECT 3, 'c'`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var sum id
+	err = sqlfunc.ForEach(rows, func(n id, s string) bool {
+		sum += n
+		return n < 2
+	})
+	if err != nil || sum != 3 {
+		t.Errorf("ForEach: got %d, %v", sum, err)
+	}
+	if calls != 1 {
+		t.Errorf("registered impl called %d times, expected 1", calls)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("panic expected for an invalid callback type")
+			}
+		}()
+		sqlfunc.RegisterForEach[func() int](func(*sql.Rows, any) error { return nil })
+	}()
+}
@@ -0,0 +1,78 @@
+package sqlfunc_test
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func TestRegisteredTypes(t *testing.T) {
+	type callback = func(int8, uint8) error
+	typ := reflect.TypeOf(callback(nil))
+
+	for _, rt := range sqlfunc.RegisteredTypes() {
+		if rt == typ {
+			t.Fatalf("%v already registered", typ)
+		}
+	}
+
+	sqlfunc.InternalRegistry.ForEach.Register(callback(nil), func(*sql.Rows, interface{}) error { return nil })
+
+	types := sqlfunc.RegisteredTypes()
+	for _, rt := range types {
+		if rt == typ {
+			return
+		}
+	}
+	t.Errorf("%v not found in %v", typ, types)
+}
+
+func TestPrecompile(t *testing.T) {
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	type id int64
+	callback := func(n id) {}
+	var callbackVar func(n id, s string) bool
+
+	sqlfunc.Precompile(callback, &callbackVar)
+	for _, typ := range []reflect.Type{reflect.TypeOf(callback), reflect.TypeOf(callbackVar)} {
+		if sqlfunc.InternalRegistry.ForEach.Get(typ) == nil {
+			t.Fatalf("%v not registered", typ)
+		}
+	}
+
+	rows, err := db.Query(`SELECT 1 UNION ALL SELECT 2 UNION ALL SELECT 3`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	count := sqlfunc.InternalRegistry.ForEach.Count()
+	var sum id
+	if err = sqlfunc.ForEach(rows, func(n id) { sum += n }); err != nil || sum != 6 {
+		t.Errorf("ForEach: got %d, %v", sum, err)
+	}
+	time.Sleep(10 * time.Millisecond) // Let a background registration, if any, happen
+	if n := sqlfunc.InternalRegistry.ForEach.Count(); n != count {
+		t.Errorf("%d registrations after precompilation", n-count)
+	}
+}
+
+func TestResetRegistryForTest(t *testing.T) {
+	type callback = func(int16, uint16) error
+	typ := reflect.TypeOf(callback(nil))
+
+	sqlfunc.Precompile(callback(nil))
+	if sqlfunc.InternalRegistry.ForEach.Get(typ) == nil {
+		t.Fatalf("%v not registered", typ)
+	}
+	sqlfunc.ResetRegistryForTest()
+	if sqlfunc.InternalRegistry.ForEach.Get(typ) != nil {
+		t.Errorf("%v still registered after reset", typ)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RenderQuery returns query with its placeholders replaced by literal representations of args,
+// for logging and debugging.
+//
+// WARNING: the result is meant to be read by humans only. The quoting of values is not
+// guaranteed to match the rules of any database and the result must NEVER be executed:
+// that would open the door to SQL injection.
+//
+// Positional placeholders ("?") consume args in order, numbered placeholders ("$N", "?N")
+// refer to args[N-1] and named placeholders (":name", "@name") refer to the [sql.NamedArg]
+// with the same name. Placeholders without a matching argument are left as is.
+// Arguments are converted like the functions created by [Exec], [QueryRow] and [Query] do
+// (registered converters, [database/sql/driver.Valuer]).
+//
+// If the query can't be parsed reliably (see the limitations of placeholders detection
+// in [Exec]), it is returned unchanged.
+func RenderQuery(query string, args []interface{}) string {
+	placeholders, ok := parsePlaceholders(query)
+	if !ok || len(placeholders) == 0 {
+		return query
+	}
+	var b strings.Builder
+	var pos, next int
+	for _, p := range placeholders {
+		var (
+			v     interface{}
+			found bool
+		)
+		switch {
+		case p.name != "":
+			for _, a := range args {
+				if na, isNamed := a.(sql.NamedArg); isNamed && na.Name == p.name {
+					v, found = na.Value, true
+					break
+				}
+			}
+		case p.num > 0:
+			if p.num <= len(args) {
+				v, found = args[p.num-1], true
+			}
+		default:
+			if next < len(args) {
+				v, found = args[next], true
+				next++
+			}
+		}
+		if !found {
+			continue
+		}
+		b.WriteString(query[pos:p.start])
+		b.WriteString(renderValue(v))
+		pos = p.end
+	}
+	b.WriteString(query[pos:])
+	return b.String()
+}
+
+// renderValue returns a literal representation of v, an argument of a query.
+func renderValue(v interface{}) string {
+	if na, isNamed := v.(sql.NamedArg); isNamed {
+		v = na.Value
+	}
+	if v != nil {
+		var err error
+		if v, err = bindArg(reflect.ValueOf(v)); err != nil {
+			return "/* " + strings.ReplaceAll(err.Error(), "*/", "* /") + " */"
+		}
+	}
+	dv, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if err != nil {
+		// Types handled by the driver itself (driver.NamedValueChecker)
+		return quoteString(fmt.Sprint(v))
+	}
+	switch v := dv.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return quoteString(v)
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'"
+	case time.Time:
+		return quoteString(v.Format(time.RFC3339Nano))
+	default:
+		return quoteString(fmt.Sprint(v))
+	}
+}
+
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
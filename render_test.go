@@ -0,0 +1,64 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func ExampleRenderQuery() {
+	fmt.Println(sqlfunc.RenderQuery(
+		`SELECT name FROM poi WHERE name = ? AND lat > ? AND visited = ?`,
+		[]interface{}{"Château d'Eau", 48.8, true},
+	))
+	// Output:
+	// SELECT name FROM poi WHERE name = 'Château d''Eau' AND lat > 48.8 AND visited = TRUE
+}
+
+func TestRenderQuery(t *testing.T) {
+	s := "x"
+	for _, tc := range []struct {
+		query string
+		args  []interface{}
+		want  string
+	}{
+		{`SELECT 1`, nil, `SELECT 1`},
+		{`SELECT ?, ?`, []interface{}{1, nil}, `SELECT 1, NULL`},
+		{`SELECT ?, '?', ?`, []interface{}{1}, `SELECT 1, '?', ?`},
+		{`SELECT $2, $1, $2`, []interface{}{"a", int64(-2)}, `SELECT -2, 'a', -2`},
+		{`SELECT ?2, ?1`, []interface{}{1.5, uint8(3)}, `SELECT 3, 1.5`},
+		{`SELECT :b, @a, :c`, []interface{}{sql.Named("a", 1), sql.Named("b", "B")}, `SELECT 'B', 1, :c`},
+		{`SELECT ?`, []interface{}{[]byte{0xca, 0xfe}}, `SELECT X'cafe'`},
+		{`SELECT ?, ?`, []interface{}{&s, (*string)(nil)}, `SELECT 'x', NULL`},
+		{`SELECT ?`, []interface{}{time.Date(2022, 12, 25, 8, 30, 0, 0, time.UTC)}, `SELECT '2022-12-25T08:30:00Z'`},
+		{`SELECT ?`, []interface{}{sql.NullInt64{}}, `SELECT NULL`},
+		{`SELECT ?`, []interface{}{big.NewInt(42)}, `SELECT '42'`},          // converter
+		{`SELECT ?, $x`, []interface{}{1}, `SELECT ?, $x`},                  // not parsed
+		{`SELECT ? -- ?`, []interface{}{1, 2}, `SELECT 1 -- ?`},             // comment
+		{`SELECT ? /* ? */, ?`, []interface{}{1, 2}, `SELECT 1 /* ? */, 2`}, // comment
+	} {
+		if got := sqlfunc.RenderQuery(tc.query, tc.args); got != tc.want {
+			t.Errorf("%q %v: got %q, expected %q", tc.query, tc.args, got, tc.want)
+		}
+	}
+}
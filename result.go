@@ -0,0 +1,41 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrNoCommandTag is returned by the functions created by [Exec] that return a command tag
+// when the [sql.Result] of the statement doesn't provide one (see [CommandTag]).
+var ErrNoCommandTag = errors.New("sqlfunc: command tag not supported by the result")
+
+// CommandTag returns the command tag of r (such as "INSERT 0 1" with PostgreSQL), if r provides
+// one with a method CommandTag() string.
+//
+// [database/sql] always hides the result of the driver behind its own [sql.Result], even if the
+// driver provides a command tag: command tags are available only for results that don't come
+// from [sql.Stmt], [sql.DB], [sql.Conn] or [sql.Tx], such as the results of a wrapper of a
+// connection used with [WithoutPrepare] or the results returned by a [Middleware].
+func CommandTag(r sql.Result) (tag string, ok bool) {
+	t, ok := r.(interface{ CommandTag() string })
+	if !ok {
+		return "", false
+	}
+	return t.CommandTag(), true
+}
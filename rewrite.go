@@ -0,0 +1,76 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"database/sql"
+)
+
+// RewriteConn is a [PrepareConn] that rewrites queries before preparing them on the wrapped
+// PrepareConn. As all the functions of this package that prepare statements take a PrepareConn,
+// this is an interception point for all their queries: prefixing table names with the schema of
+// a tenant, adjusting the SQL dialect...
+//
+// Rewriters are stacked with [RewriteConn.Then] and applied in the order they are added:
+//
+//	db := sqlfunc.Rewrite(sqlDB, expandSchema).Then(logQuery) // expandSchema, then logQuery
+//
+// Wrapping a RewriteConn with [Rewrite] applies the outer rewriters first.
+//
+// Only PrepareContext is provided: [WithoutPrepare] is not supported.
+type RewriteConn struct {
+	db        PrepareConn
+	rewriters []func(query string) string
+}
+
+// Rewrite returns a [RewriteConn] that applies rewrite to the queries prepared on db.
+func Rewrite(db PrepareConn, rewrite func(query string) string) *RewriteConn {
+	if rewrite == nil {
+		panic("rewrite must be non-nil")
+	}
+	return &RewriteConn{db: db, rewriters: []func(string) string{rewrite}}
+}
+
+// Then returns a new [RewriteConn] that applies rewrite after the rewriters of c.
+// c is unchanged.
+func (c *RewriteConn) Then(rewrite func(query string) string) *RewriteConn {
+	if rewrite == nil {
+		panic("rewrite must be non-nil")
+	}
+	rewriters := make([]func(string) string, len(c.rewriters), len(c.rewriters)+1)
+	copy(rewriters, c.rewriters)
+	return &RewriteConn{db: c.db, rewriters: append(rewriters, rewrite)}
+}
+
+// Rewrite returns query rewritten by the rewriters of c, in order.
+func (c *RewriteConn) Rewrite(query string) string {
+	for _, rewrite := range c.rewriters {
+		query = rewrite(query)
+	}
+	return query
+}
+
+// PrepareContext prepares the rewritten query on the wrapped PrepareConn.
+func (c *RewriteConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return c.db.PrepareContext(ctx, c.Rewrite(query))
+}
+
+// Unwrap returns the wrapped PrepareConn.
+func (c *RewriteConn) Unwrap() PrepareConn {
+	return c.db
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func ExampleRewrite() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // the attached databases are per connection
+
+	// With SQLite, a schema is an attached database
+	for _, tenant := range []string{"acme", "globex"} {
+		_, err = db.ExecContext(ctx, `ATTACH ':memory:' AS `+tenant+`;`+
+			`CREATE TABLE `+tenant+`.poi (name TEXT);`+
+			`INSERT INTO `+tenant+`.poi VALUES ('`+tenant+` HQ')`)
+		if err != nil {
+			fmt.Println("Attach:", err)
+			return
+		}
+	}
+
+	// Queries use the "{schema}." prefix for the tables of a tenant
+	tenantConn := func(tenant string) sqlfunc.PrepareConn {
+		return sqlfunc.Rewrite(db, func(query string) string {
+			return strings.ReplaceAll(query, "{schema}.", tenant+".")
+		}).Then(func(query string) string {
+			fmt.Println("prepare:", query) // sees the query rewritten for the tenant
+			return query
+		})
+	}
+
+	for _, tenant := range []string{"acme", "globex"} {
+		var firstPOI func(ctx context.Context) (string, error)
+		closeFirstPOI, err := sqlfunc.QueryRow(ctx, tenantConn(tenant), `SELECT name FROM {schema}.poi`, &firstPOI)
+		if err != nil {
+			fmt.Println("QueryRow:", err)
+			return
+		}
+		name, err := firstPOI(ctx)
+		closeFirstPOI()
+		if err != nil {
+			fmt.Println("firstPOI:", err)
+			return
+		}
+		fmt.Println(name)
+	}
+
+	// Output:
+	// prepare: SELECT name FROM acme.poi
+	// acme HQ
+	// prepare: SELECT name FROM globex.poi
+	// globex HQ
+}
+
+// recordConn records the prepared queries.
+type recordConn []string
+
+func (r *recordConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	*r = append(*r, query)
+	return nil, fmt.Errorf("not implemented")
+}
+
+func TestRewriteOrder(t *testing.T) {
+	appendRewriter := func(s string) func(string) string {
+		return func(query string) string { return query + s }
+	}
+	var rec recordConn
+	inner := sqlfunc.Rewrite(&rec, appendRewriter("a"))
+	chained := inner.Then(appendRewriter("b"))
+	outer := sqlfunc.Rewrite(chained, appendRewriter("c"))
+
+	for _, db := range []sqlfunc.PrepareConn{inner, chained, outer} {
+		_, _ = db.PrepareContext(context.Background(), "q")
+	}
+	// Then doesn't change the receiver, and the outer rewriters apply first
+	if got := fmt.Sprint(rec); got != "[qa qab qcab]" {
+		t.Errorf("got %s", got)
+	}
+	if outer.Unwrap() != sqlfunc.PrepareConn(chained) {
+		t.Error("Unwrap")
+	}
+}
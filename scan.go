@@ -17,8 +17,16 @@ limitations under the License.
 package sqlfunc
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Scan allows to define a function that will scan one row from an [*sql.Rows].
@@ -27,7 +35,26 @@ import (
 // Two styles are available:
 //   - as pointer variables (like [sql.Rows.Scan]): func (rows *sql.Rows, pval1 *int, pval2 *string) error
 //   - as returned values (implies copies): func (rows *sql.Rows) (val1 int, val2 string, err error)
-func Scan(fnPtr interface{}) {
+//
+// In the pointer style, pointers to structs (see [ScanPtr] for the types scanned by column name)
+// receive consecutive columns, matched to fields by name, which allows to scan a row of a join
+// into multiple structs:
+//
+//	// SELECT u.*, a.* FROM users u JOIN addresses a ON a.user_id = u.id
+//	var scanUserAddress func(rows *sql.Rows, u *User, a *Address) error
+//
+// The columns are partitioned in order: a destination receives columns until a column has no
+// matching field in it, or matches a field that already received a column (such as the second
+// "id" of a join), or has a different table qualifier ("u.id" then "a.id": the qualifier is
+// ignored for matching fields, and only drivers or aliases that report it give one). The next
+// column goes to the next destination. Other pointers receive a single column. Each destination
+// must receive at least one column. If *T implements [AfterScanner], its AfterScan method is
+// called once the row is scanned.
+//
+// The following options are supported: [WithAllocator], [WithLocation], [WithNullAsZero],
+// [WithNullDefault].
+func Scan(fnPtr interface{}, opts ...Option) {
+	o := newOptions(opts)
 	vPtr := reflect.ValueOf(fnPtr)
 	if vPtr.Type().Kind() != reflect.Ptr {
 		panic("fnPtr must be a *pointer* to a func variable")
@@ -65,28 +92,31 @@ func Scan(fnPtr interface{}) {
 	}
 
 	var fn func(in []reflect.Value) []reflect.Value
-	if numIn > 1 {
-		scanners := make([]interface{}, numIn-1)
-		out := make([]reflect.Value, 1)
+	if numIn > 1 && hasStructDest(fnType) {
+		fn = scanStructsFunc(fnType, o)
+	} else if numIn > 1 {
+		plan := newScanPlan(nil, numIn-1)
 		fn = func(in []reflect.Value) []reflect.Value {
+			scanners := plan.scanners()
 			// in[0] is *sql.Rows, scanners follow...
 			for i := range in[1:] {
-				scanners[i] = in[i+1].Interface()
+				(*scanners)[i] = o.scanner(in[i+1])
 			}
-			err := in[0].Interface().(*sql.Rows).Scan(scanners...)
-			out[0] = reflect.ValueOf(&err).Elem()
-			return out
+			err := in[0].Interface().(*sql.Rows).Scan(*scanners...)
+			plan.release(scanners)
+			if err == nil {
+				return noError // read-only: shared by concurrent calls
+			}
+			return []reflect.Value{reflect.ValueOf(&err).Elem()}
 		}
 	} else { // numOut > 1
-		scanners := make([]interface{}, numOut-1)
-		out := make([]reflect.Value, numOut)
+		plan := newScanPlan(outTypes(fnType, numOut-1), numOut-1)
 		fn = func(in []reflect.Value) []reflect.Value {
-			for i := range scanners {
-				ptr := reflect.New(fnType.Out(i))
-				scanners[i] = ptr.Interface()
-				out[i] = ptr.Elem()
-			}
-			err := in[0].Interface().(*sql.Rows).Scan(scanners...)
+			out := make([]reflect.Value, numOut)
+			scanners := plan.scanners()
+			plan.dest(o, *scanners, out)
+			err := in[0].Interface().(*sql.Rows).Scan(*scanners...)
+			plan.release(scanners)
 			out[numOut-1] = reflect.ValueOf(&err).Elem()
 			return out
 		}
@@ -94,68 +124,391 @@ func Scan(fnPtr interface{}) {
 	vPtr.Elem().Set(reflect.MakeFunc(fnType, fn))
 }
 
+// hasStructDest reports whether fnType, a func of the pointer style of [Scan], has a pointer
+// to a struct scanned by column name.
+func hasStructDest(fnType reflect.Type) bool {
+	for i := 1; i < fnType.NumIn(); i++ {
+		if t := fnType.In(i); t.Kind() == reflect.Ptr && isStructDest(t.Elem()) {
+			return true
+		}
+	}
+	return false
+}
+
+// columnDest is the destination of a column: the index of the argument, and the index path
+// of the field for a struct destination.
+type columnDest struct {
+	arg  int
+	path []int
+}
+
+// partitionColumns assigns the columns to the destinations of the given types: struct types
+// (scanned by column name) receive consecutive columns, other types a single column.
+// See [Scan] for the rules.
+func partitionColumns(types []reflect.Type, columns []string) ([]columnDest, error) {
+	dests := make([]columnDest, len(columns))
+	d := 0
+	var (
+		fields    map[string][]int // of types[d], if a struct
+		assigned  map[string]bool  // fields of types[d] that received a column
+		qualifier string           // of the first column of types[d]
+	)
+	next := func() {
+		d++
+		fields, assigned = nil, nil
+	}
+	for i, col := range columns {
+		qual, name := "", col
+		if dot := strings.LastIndexByte(col, '.'); dot >= 0 {
+			qual, name = col[:dot], col[dot+1:]
+		}
+		name = strings.ToLower(name)
+		for {
+			if d >= len(types) {
+				return nil, fmt.Errorf("sqlfunc: column %q has no destination", col)
+			}
+			if !isStructDest(types[d]) {
+				if assigned != nil {
+					next()
+					continue
+				}
+				assigned = map[string]bool{}
+				dests[i] = columnDest{arg: d}
+				break
+			}
+			if fields == nil {
+				fields = structFields(types[d])
+			}
+			path, ok := fields[name]
+			if len(assigned) > 0 && (!ok || assigned[name] || !strings.EqualFold(qual, qualifier)) {
+				next()
+				continue
+			}
+			if !ok {
+				return nil, fmt.Errorf("sqlfunc: column %q has no matching field in %v", col, types[d])
+			}
+			if assigned == nil {
+				assigned = map[string]bool{}
+				qualifier = qual
+			}
+			assigned[name] = true
+			dests[i] = columnDest{arg: d, path: path}
+			break
+		}
+	}
+	missing := d // first destination without column
+	if assigned != nil {
+		missing++
+	}
+	if missing < len(types) {
+		return nil, fmt.Errorf("sqlfunc: %d columns for %d destinations: destination %d (%v) has no column", len(columns), len(types), missing+1, types[missing])
+	}
+	return dests, nil
+}
+
+// scanStructsFunc returns the implementation of a func of the pointer style of [Scan] with
+// struct destinations.
+func scanStructsFunc(fnType reflect.Type, o *options) func(in []reflect.Value) []reflect.Value {
+	types := make([]reflect.Type, fnType.NumIn()-1)
+	for i := range types {
+		types[i] = fnType.In(i + 1).Elem()
+	}
+	var plans sync.Map // map[string][]columnDest, by columns
+	return func(in []reflect.Value) []reflect.Value {
+		err := func() error {
+			rows := in[0].Interface().(*sql.Rows)
+			columns, err := rows.Columns()
+			if err != nil {
+				return err
+			}
+			key := strings.Join(columns, "\x00")
+			var dests []columnDest
+			if p, ok := plans.Load(key); ok {
+				dests = p.([]columnDest)
+			} else {
+				if dests, err = partitionColumns(types, columns); err != nil {
+					return err
+				}
+				plans.Store(key, dests)
+			}
+			for i, v := range in[1:] {
+				if v.IsNil() {
+					return fmt.Errorf("sqlfunc: nil destination %d (%v)", i+1, v.Type())
+				}
+			}
+			scanners := make([]interface{}, len(dests))
+			for i, dest := range dests {
+				v := in[dest.arg+1]
+				if dest.path != nil {
+					v = v.Elem().FieldByIndex(dest.path).Addr()
+				}
+				scanners[i] = o.scanner(v)
+			}
+			if err = rows.Scan(scanners...); err != nil {
+				return err
+			}
+			for _, v := range in[1:] {
+				if s, ok := v.Interface().(AfterScanner); ok && isStructDest(v.Type().Elem()) {
+					if err = s.AfterScan(); err != nil {
+						return err // user error: don't wrap
+					}
+				}
+			}
+			return nil
+		}()
+		if err == nil {
+			return noError
+		}
+		return []reflect.Value{reflect.ValueOf(&err).Elem()}
+	}
+}
+
+// noError is the result of a func returning only a nil error.
+var noError = []reflect.Value{reflect.Zero(typeError)}
+
+// scanPlan prepares the scanning of the values of a row with few allocations per row:
+// the slices of scanners given to [sql.Rows.Scan] are pooled and the destinations of
+// the values are allocated at once as the fields of a struct.
+type scanPlan struct {
+	typ  reflect.Type // struct type with a field for each value
+	pool sync.Pool    // *[]interface{}
+}
+
+// newScanPlan returns a plan for n scanners. types are the types of the values, if the plan
+// allocates the destinations (see [scanPlan.dest]).
+func newScanPlan(types []reflect.Type, n int) *scanPlan {
+	p := &scanPlan{}
+	if types != nil {
+		fields := make([]reflect.StructField, len(types))
+		for i, t := range types {
+			fields[i] = reflect.StructField{Name: "V" + strconv.Itoa(i), Type: t}
+		}
+		p.typ = reflect.StructOf(fields)
+	}
+	p.pool.New = func() interface{} {
+		s := make([]interface{}, n)
+		return &s
+	}
+	return p
+}
+
+// scanners returns a slice of scanners from the pool, to give back with release.
+func (p *scanPlan) scanners() *[]interface{} {
+	return p.pool.Get().(*[]interface{})
+}
+
+// release gives back scanners to the pool, without retaining the destinations.
+func (p *scanPlan) release(scanners *[]interface{}) {
+	for i := range *scanners {
+		(*scanners)[i] = nil
+	}
+	p.pool.Put(scanners)
+}
+
+// dest allocates zero values as destinations, sets their scanners and sets the values in out.
+// The values are not reused: they can be returned by a func built with [reflect.MakeFunc].
+func (p *scanPlan) dest(o *options, scanners []interface{}, out []reflect.Value) {
+	if len(scanners) == 1 || o.allocator != nil {
+		for i := range scanners {
+			ptr := o.new(p.typ.Field(i).Type)
+			scanners[i] = o.scanner(ptr)
+			out[i] = ptr.Elem()
+		}
+		return
+	}
+	v := reflect.New(p.typ).Elem()
+	for i := range scanners {
+		f := v.Field(i)
+		scanners[i] = o.scanner(f.Addr())
+		out[i] = f
+	}
+}
+
 // ForEach iterates an [*sql.Rows], scans the values of the row and calls the given callback function with the values.
 //
 // The callback receives the scanned columns values as arguments and may return an error or a bool (false) to stop iterating.
+// It may also return both (bool, error): iteration stops if the bool is false or if the error is non-nil,
+// and the error is returned.
+// If the first argument of callback is a [*bytes.Buffer], it is a scratch buffer (see [ForEachBuf]).
 //
-// rows are closed before returning.
-func ForEach(rows *sql.Rows, callback interface{}) error {
+// The following options are supported: [WithAfterScan], [WithAllocator], [WithLocation], [WithoutClose],
+// [WithRowMetrics], [WithRowTimeout].
+//
+// rows are closed before returning (unless [WithoutClose] is given). The error from closing rows
+// is returned only if the iteration succeeded: use [ForEachCloseErr] to get both errors.
+func ForEach(rows *sql.Rows, callback interface{}, opts ...Option) error {
 	fnType := reflect.TypeOf(callback)
+	if len(opts) > 0 {
+		r := newRunForEach(fnType)
+		r.o = newOptions(opts)
+		return r.run(rows, callback)
+	}
 	f := registry.ForEach.Get(fnType)
 	if f == nil {
+		f = newRunForEach(fnType).run
+		// Register in the background
+		go registry.ForEach.Register(callback, f)
+	}
+	return f(rows, callback)
+}
 
-		if fnType.Kind() != reflect.Func {
-			panic("callback must be a func")
-		}
-		numIn := fnType.NumIn()
-		if numIn == 0 {
-			panic("callback must accept at least one argument")
+// ForEachBuf is like [ForEach] but callback receives, before the scanned column values, a
+// [*bytes.Buffer] that is reset before each call:
+//
+//	func(buf *bytes.Buffer, col1 string, col2 int64) error
+//
+// The same buffer is given for all rows, so callbacks that format each row (to write it to an
+// output, for example) don't allocate per row once the buffer is grown. The content of the
+// buffer is only valid until callback returns.
+//
+// The options of [ForEach] are supported.
+func ForEachBuf(rows *sql.Rows, callback interface{}, opts ...Option) error {
+	fnType := reflect.TypeOf(callback)
+	if fnType == nil || fnType.Kind() != reflect.Func || fnType.NumIn() == 0 || fnType.In(0) != typeBuffer {
+		panic("callback must be a func with a first *bytes.Buffer argument")
+	}
+	return ForEach(rows, callback, opts...)
+}
+
+// ForEachContext is like [ForEach] but stops iterating once ctx is done, and also returns
+// the number of rows processed: the number of calls of callback that completed without error.
+//
+// If ctx is done before all rows are read, ctx.Err() is returned with the number of rows
+// processed until then. This allows to report the progress of a long iteration, or to resume it.
+//
+// The options of [ForEach] are supported.
+func ForEachContext(ctx context.Context, rows *sql.Rows, callback interface{}, opts ...Option) (processed int, err error) {
+	r := newRunForEach(reflect.TypeOf(callback))
+	r.o = newOptions(opts)
+	return r.iterate(ctx, true, rows, callback)
+}
+
+// ForEachCancelable is like [ForEach] but iterates in a new goroutine, and returns immediately
+// a func stop that stops the iteration and a channel done that receives the error of the
+// iteration (nil on success) once it is over. This allows, for example, a user interface to
+// cancel a long iteration.
+//
+// stop can be called at any time, multiple times and from any goroutine: the iteration stops
+// before the next row, and [context.Canceled] is the error received from done (unless the
+// iteration was already over). stop doesn't interrupt a call of callback in progress.
+//
+// rows are closed once the iteration is over (unless [WithoutClose] is given), whether it
+// stopped or not. done is buffered and closed after the error is sent: the goroutine exits even
+// if done is never read. But the goroutine (and the connection held by rows) is not released
+// until the iteration is over: call stop if the result isn't needed anymore.
+//
+// The options of [ForEach] are supported.
+func ForEachCancelable(rows *sql.Rows, callback interface{}, opts ...Option) (stop func(), done <-chan error) {
+	// Checked before starting the goroutine, where the panic couldn't be recovered
+	if v := reflect.ValueOf(callback); !v.IsValid() || v.Kind() == reflect.Func && v.IsNil() {
+		panic("callback must be non-nil")
+	}
+	r := newRunForEach(reflect.TypeOf(callback))
+	r.o = newOptions(opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan error, 1)
+	go func() {
+		defer cancel()
+		_, err := r.iterate(ctx, true, rows, callback)
+		ch <- err
+		close(ch)
+	}()
+	return cancel, ch
+}
+
+// ForEachCloseErr is like [ForEach] but returns separately iterErr, the error of the iteration
+// (from scanning, from the callback or from [database/sql.Rows.Err]), and closeErr, the error
+// from closing rows. This allows to distinguish a failure of the processing from a failure
+// of the cleanup, which [ForEach] merges.
+//
+// closeErr is always nil with [WithoutClose].
+func ForEachCloseErr(rows *sql.Rows, callback interface{}, opts ...Option) (iterErr error, closeErr error) {
+	r := newRunForEach(reflect.TypeOf(callback))
+	r.o = newOptions(opts)
+	_, iterErr = r.each(context.Background(), false, rows, callback)
+	if !r.o.withoutClose && iterErr != ErrRowTimeout {
+		closeErr = rows.Close()
+	}
+	return
+}
+
+func newRunForEach(fnType reflect.Type) *runForEach {
+	if fnType.Kind() != reflect.Func {
+		panic("callback must be a func")
+	}
+	numIn := fnType.NumIn()
+	if numIn == 0 {
+		panic("callback must accept at least one argument")
+	}
+	// A first *bytes.Buffer argument is a scratch buffer (see ForEachBuf)
+	first := 0
+	if fnType.In(0) == typeBuffer {
+		if numIn == 1 {
+			panic("callback must accept at least one argument after the *bytes.Buffer")
 		}
+		first = 1
+	}
 
-		var returnType int
-		switch fnType.NumOut() {
-		case 0:
-		case 1:
-			switch fnType.Out(0) {
-			case typeBool:
-				returnType = 1
-			case typeError:
-				returnType = 2
-			default:
-				panic("callback may only return an error or a bool")
-			}
+	var returnType int
+	switch fnType.NumOut() {
+	case 0:
+	case 1:
+		switch fnType.Out(0) {
+		case typeBool:
+			returnType = 1
+		case typeError:
+			returnType = 2
 		default:
-			panic("callback may only return an error or a bool")
+			panic("callback may only return an error, a bool, or (bool, error)")
 		}
-
-		inTypes := make([]reflect.Type, numIn, numIn)
-		for i := 0; i < numIn; i++ {
-			inTypes[i] = fnType.In(i)
+	case 2:
+		if fnType.Out(0) != typeBool || fnType.Out(1) != typeError {
+			panic("callback may only return an error, a bool, or (bool, error)")
 		}
+		returnType = 3
+	default:
+		panic("callback may only return an error, a bool, or (bool, error)")
+	}
 
-		f = (&runForEach{
-			inTypes:    inTypes,
-			returnType: returnType,
-		}).run
-		// Register in the background
-		go registry.ForEach.Register(callback, f)
+	return &runForEach{
+		inTypes:    inTypes(fnType, first),
+		withBuffer: first == 1,
+		returnType: returnType,
+		o:          &options{},
 	}
-	return f(rows, callback)
 }
 
 type runForEach struct {
 	inTypes    []reflect.Type
-	returnType int
+	withBuffer bool // the callback takes a scratch *bytes.Buffer first
+	returnType int  // 0: none, 1: bool, 2: error, 3: (bool, error)
+	o          *options
 }
 
-func (r *runForEach) run(rows *sql.Rows, callback interface{}) (err error) {
-	defer func() {
-		e := rows.Close()
-		if err == nil {
-			err = e // TODO wrap
-		}
-	}()
+func (r *runForEach) run(rows *sql.Rows, callback interface{}) error {
+	_, err := r.iterate(context.Background(), false, rows, callback)
+	return err
+}
 
+// iterate implements [ForEach] and, with cancelable set, [ForEachContext]: the iteration then
+// stops once ctx is done.
+func (r *runForEach) iterate(ctx context.Context, cancelable bool, rows *sql.Rows, callback interface{}) (processed int, err error) {
+	if !r.o.withoutClose {
+		defer func() {
+			if err == ErrRowTimeout {
+				return // closed by scanTimeout
+			}
+			e := rows.Close()
+			if err == nil {
+				err = e // TODO wrap
+			}
+		}()
+	}
+	return r.each(ctx, cancelable, rows, callback)
+}
+
+// each iterates rows without closing them.
+func (r *runForEach) each(ctx context.Context, cancelable bool, rows *sql.Rows, callback interface{}) (processed int, err error) {
 	fn := reflect.ValueOf(callback)
 	if fn.IsNil() {
 		panic("callback must be non-nil")
@@ -164,25 +517,68 @@ func (r *runForEach) run(rows *sql.Rows, callback interface{}) (err error) {
 	numIn := len(r.inTypes)
 	scanners := make([]interface{}, numIn)
 	fnArgs := make([]reflect.Value, numIn)
+	scanned := fnArgs
+	var buf *bytes.Buffer
+	if r.withBuffer {
+		buf = new(bytes.Buffer)
+		fnArgs = append([]reflect.Value{reflect.ValueOf(buf)}, scanned...)
+		scanned = fnArgs[1:]
+	}
+
+	var (
+		scannedRows  int
+		scannedBytes int64
+	)
+	if r.o.rowMetrics != nil {
+		defer func() { r.o.rowMetrics(scannedRows, scannedBytes) }()
+	}
 
 	for rows.Next() {
+		if cancelable {
+			if err = ctx.Err(); err != nil {
+				return
+			}
+		}
 		for i := 0; i < numIn; i++ {
-			ptr := reflect.New(r.inTypes[i])
-			scanners[i] = ptr.Interface()
-			fnArgs[i] = ptr.Elem()
+			ptr := r.o.new(r.inTypes[i])
+			scanners[i] = r.o.scanner(ptr)
+			scanned[i] = ptr.Elem()
 		}
 
-		err = rows.Scan(scanners...)
+		if r.o.rowTimeout > 0 {
+			err = scanTimeout(rows, scanners, r.o.rowTimeout, !r.o.withoutClose)
+		} else {
+			err = rows.Scan(scanners...)
+		}
 		if err != nil {
 			// TODO wrap err
 			return
 		}
+		if r.o.rowMetrics != nil {
+			scannedRows++
+			for _, v := range scanned {
+				scannedBytes += valueSize(v)
+			}
+		}
+		if buf != nil {
+			buf.Reset()
+		}
+		if r.o.afterScan != nil {
+			values := make([]interface{}, numIn)
+			for i := range scanned {
+				values[i] = scanned[i].Interface()
+			}
+			if err = r.o.afterScan(values); err != nil {
+				return // user error: don't wrap
+			}
+		}
 		switch r.returnType {
 		case 0:
 			fn.Call(fnArgs)
 		case 1:
 			// Stop iteration if callback returns false
 			if !fn.Call(fnArgs)[0].Interface().(bool) {
+				processed++
 				return
 			}
 		case 2:
@@ -190,9 +586,313 @@ func (r *runForEach) run(rows *sql.Rows, callback interface{}) (err error) {
 			if err, isError = fn.Call(fnArgs)[0].Interface().(error); isError {
 				return // user error: don't wrap
 			}
+		case 3:
+			res := fn.Call(fnArgs)
+			var isError bool
+			if err, isError = res[1].Interface().(error); isError {
+				return // user error: don't wrap
+			}
+			if !res[0].Interface().(bool) {
+				processed++
+				return
+			}
 		}
+		processed++
 	}
 
 	err = rows.Err() // TODO wrap
 	return
 }
+
+// ErrRowTimeout is returned by [ForEach] when the scan of a row exceeds the duration set
+// with [WithRowTimeout].
+var ErrRowTimeout = errors.New("sqlfunc: row scan timed out")
+
+// scanTimeout runs rows.Scan(dest...) in a goroutine and returns [ErrRowTimeout] if it doesn't
+// complete within d. [database/sql.Rows.Close] waits for a Scan in progress, so after a timeout
+// rows are closed (if closeRows) by the goroutine once Scan returns.
+func scanTimeout(rows *sql.Rows, dest []interface{}, d time.Duration, closeRows bool) error {
+	done := make(chan struct{})
+	var err error
+	go func() {
+		defer close(done)
+		err = rows.Scan(dest...)
+	}()
+	timer := time.NewTimer(d)
+	select {
+	case <-done:
+		timer.Stop()
+		return err
+	case <-timer.C:
+	}
+	if closeRows {
+		go func() {
+			<-done
+			_ = rows.Close()
+		}()
+	}
+	return ErrRowTimeout
+}
+
+var typeNullString = reflect.TypeOf(sql.NullString{})
+
+// valueSize returns the length of v if it is a string or a []byte (see [WithRowMetrics]).
+func valueSize(v reflect.Value) int64 {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return 0
+		}
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.String:
+		return int64(v.Len())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return int64(v.Len())
+	case v.Type() == typeNullString:
+		return int64(v.Field(0).Len())
+	}
+	return 0
+}
+
+// AfterScanner is implemented by types that need processing after being scanned from a row,
+// such as computing derived fields, normalizing or validating values.
+//
+// [ScanOne], [ScanPtr], [ScanAll], [ForEachT] and [QueryChanInto] call the AfterScan method of
+// the value (if *T implements AfterScanner) after each row is scanned into it. An error
+// returned by AfterScan is returned as is and stops the iteration.
+type AfterScanner interface {
+	AfterScan() error
+}
+
+// isStructDest reports whether destinations of type t are scanned by column name
+// (see [ScanPtr] for the rules).
+func isStructDest(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct &&
+		t != typeTime &&
+		!reflect.PtrTo(t).Implements(typeScanner) &&
+		!isTextDest(reflect.PtrTo(t)) &&
+		converterFor(t) == nil
+}
+
+// structFieldsCache caches the result of structFields by type.
+var structFieldsCache sync.Map // map[reflect.Type]map[string][]int
+
+// structFields maps lowercased column names to the index path of the fields of struct type t.
+func structFields(t reflect.Type) map[string][]int {
+	if m, ok := structFieldsCache.Load(t); ok {
+		return m.(map[string][]int)
+	}
+	m := make(map[string][]int)
+	collectFields(t, nil, "", m)
+	structFieldsCache.Store(t, m)
+	return m
+}
+
+func collectFields(t reflect.Type, index []int, prefix string, m map[string][]int) {
+	type embeddedField struct {
+		i      int
+		prefix string
+	}
+	var embedded []embeddedField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("sql")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && isStructDest(f.Type) {
+			// The tag of an embedded struct is a prefix for the columns of its fields
+			embedded = append(embedded, embeddedField{i, prefix + strings.ToLower(tag)})
+			continue
+		}
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = f.Name
+		}
+		name = prefix + strings.ToLower(name)
+		if _, exists := m[name]; !exists {
+			m[name] = append(index[:len(index):len(index)], i)
+		}
+	}
+	// Fields of embedded structs have lower precedence
+	for _, e := range embedded {
+		collectFields(t.Field(e.i).Type, append(index[:len(index):len(index)], e.i), e.prefix, m)
+	}
+}
+
+// columnPlanKey is the key of columnPlanCache: a struct type and a set of columns.
+type columnPlanKey struct {
+	t       reflect.Type
+	columns string // column names joined with NUL
+}
+
+// columnPlanCache caches the result of columnFields.
+var columnPlanCache sync.Map // map[columnPlanKey][][]int
+
+// columnFields returns, for each column, the index path of the matching field of struct type t.
+// The result is cached by (t, columns) and must not be modified.
+func columnFields(t reflect.Type, columns []string) ([][]int, error) {
+	key := columnPlanKey{t, strings.Join(columns, "\x00")}
+	if paths, ok := columnPlanCache.Load(key); ok {
+		return paths.([][]int), nil
+	}
+	fields := structFields(t)
+	paths := make([][]int, len(columns))
+	for i, col := range columns {
+		path, ok := fields[strings.ToLower(col)]
+		if !ok {
+			return nil, fmt.Errorf("sqlfunc: column %q has no matching field in %v", col, t)
+		}
+		paths[i] = path
+	}
+	columnPlanCache.Store(key, paths)
+	return paths, nil
+}
+
+// mappedFields returns the index paths of the fields of struct type t given by mapping
+// (see [WithColumnMapping]) for numColumns columns.
+func mappedFields(t reflect.Type, numColumns int, mapping []int) ([][]int, error) {
+	if len(mapping) != numColumns {
+		return nil, fmt.Errorf("sqlfunc: column mapping has %d fields for %d columns", len(mapping), numColumns)
+	}
+	paths := make([][]int, numColumns)
+	for i, f := range mapping {
+		if f < 0 || f >= t.NumField() {
+			return nil, fmt.Errorf("sqlfunc: column %d is mapped to field %d, but %v has %d fields", i, f, t, t.NumField())
+		}
+		if t.Field(f).PkgPath != "" {
+			return nil, fmt.Errorf("sqlfunc: column %d is mapped to field %s of %v which is unexported", i, t.Field(f).Name, t)
+		}
+		paths[i] = []int{f}
+	}
+	return paths, nil
+}
+
+// structPlan returns, for each column of rows, the index path of the matching field of
+// struct type t, applying the checks enabled by o.
+func structPlan(rows *sql.Rows, t reflect.Type, o *options) ([][]int, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if err = o.checkColumns(columns); err != nil {
+		return nil, err
+	}
+	if err = o.checkExpectedColumns(columns); err != nil {
+		return nil, err
+	}
+	var paths [][]int
+	if o.columnMapping != nil {
+		paths, err = mappedFields(t, len(columns), o.columnMapping)
+	} else {
+		paths, err = columnFields(t, columns)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if o.checkColumnTypes {
+		columnTypes, err := rows.ColumnTypes()
+		if err != nil {
+			return nil, err
+		}
+		for i, ct := range columnTypes {
+			f := t.FieldByIndex(paths[i])
+			if !compatibleScanType(f.Type, ct.ScanType()) {
+				return nil, fmt.Errorf("sqlfunc: column %q of type %s is incompatible with field %s %v of %v", ct.Name(), ct.DatabaseTypeName(), f.Name, f.Type, t)
+			}
+		}
+	}
+	return paths, nil
+}
+
+var (
+	typeRawBytes = reflect.TypeOf(sql.RawBytes(nil))
+	typeBytes    = reflect.TypeOf([]byte(nil))
+
+	// nullScanTypes maps the sql.Null* types used as ScanType by drivers to the type of their value.
+	nullScanTypes = map[reflect.Type]reflect.Type{
+		reflect.TypeOf(sql.NullBool{}):    typeBool,
+		reflect.TypeOf(sql.NullByte{}):    reflect.TypeOf(byte(0)),
+		reflect.TypeOf(sql.NullInt16{}):   reflect.TypeOf(int16(0)),
+		reflect.TypeOf(sql.NullInt32{}):   reflect.TypeOf(int32(0)),
+		reflect.TypeOf(sql.NullInt64{}):   reflect.TypeOf(int64(0)),
+		reflect.TypeOf(sql.NullFloat64{}): reflect.TypeOf(float64(0)),
+		reflect.TypeOf(sql.NullString{}):  reflect.TypeOf(""),
+		reflect.TypeOf(sql.NullTime{}):    typeTime,
+		typeRawBytes:                      typeBytes,
+	}
+)
+
+// compatibleScanType reports whether a column with the given ScanType may be scanned into
+// a destination of type dest. Unknown types are assumed compatible.
+func compatibleScanType(dest, scanType reflect.Type) bool {
+	if scanType == nil {
+		return true
+	}
+	if t, ok := nullScanTypes[scanType]; ok {
+		scanType = t
+	}
+	for scanType.Kind() == reflect.Ptr {
+		scanType = scanType.Elem()
+	}
+	if scanType.Kind() == reflect.Interface {
+		return true // the driver doesn't know
+	}
+	for dest.Kind() == reflect.Ptr {
+		if converterFor(dest) != nil || dest.Implements(typeScanner) || isTextDest(dest) {
+			return true
+		}
+		dest = dest.Elem()
+	}
+	if converterFor(dest) != nil || reflect.PtrTo(dest).Implements(typeScanner) || isTextDest(reflect.PtrTo(dest)) {
+		return true
+	}
+
+	src := scanType.Kind()
+	switch dest.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.String:
+		return src == reflect.String || scanType == typeBytes
+	case reflect.Slice:
+		if dest.Elem().Kind() != reflect.Uint8 {
+			return true
+		}
+		return src == reflect.String || scanType == typeBytes
+	case reflect.Bool:
+		return src == reflect.Bool || isIntKind(src)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return isIntKind(src)
+	case reflect.Float32, reflect.Float64:
+		return isIntKind(src) || src == reflect.Float32 || src == reflect.Float64
+	case reflect.Struct:
+		if dest == typeTime {
+			return scanType == typeTime
+		}
+	}
+	return true
+}
+
+func isIntKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// structScanners returns the scanners for the fields of v, an addressable struct value,
+// matching the columns.
+func (o *options) structScanners(v reflect.Value, paths [][]int) []interface{} {
+	scanners := make([]interface{}, len(paths))
+	for i, path := range paths {
+		scanners[i] = o.scanner(v.FieldByIndex(path).Addr())
+	}
+	return scanners
+}
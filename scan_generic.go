@@ -0,0 +1,323 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// ForEachBatch iterates an [*sql.Rows], scans the single column of each row into a value of type T
+// and calls callback with batches of up to batchSize values.
+// The last batch may be smaller than batchSize.
+//
+// The slice given to callback is reused for the next batch: it is only valid until callback returns.
+// If callback returns an error, iteration stops and that error is returned.
+//
+// rows are closed before returning.
+func ForEachBatch[T any](rows *sql.Rows, batchSize int, callback func([]T) error) (err error) {
+	if batchSize <= 0 {
+		panic("batchSize must be positive")
+	}
+	if callback == nil {
+		panic("callback must be non-nil")
+	}
+
+	defer func() {
+		e := rows.Close()
+		if err == nil {
+			err = e
+		}
+	}()
+
+	var zero T
+	batch := make([]T, 0, batchSize)
+	for rows.Next() {
+		batch = append(batch, zero)
+		if err = rows.Scan(scanner(reflect.ValueOf(&batch[len(batch)-1]))); err != nil {
+			return
+		}
+		if len(batch) == batchSize {
+			if err = callback(batch); err != nil {
+				return // user error: don't wrap
+			}
+			batch = batch[:0]
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	if len(batch) > 0 {
+		err = callback(batch)
+	}
+	return
+}
+
+// ScanOne scans the current row of rows into a new value of type T.
+//
+// See [ScanPtr] for the scanning rules.
+func ScanOne[T any](rows *sql.Rows, opts ...Option) (T, error) {
+	var v T
+	err := ScanPtr(rows, &v, opts...)
+	return v, err
+}
+
+// ScanPtr scans the current row of rows into dest.
+//
+// If T is a struct type (except [time.Time], types implementing [database/sql.Scanner] or
+// [TextScanner] and types having a registered [Converter]), the columns are matched by name to the fields of
+// the struct: the name of a field is given by its `sql` tag or else is the field name, compared
+// case-insensitively. Fields tagged with `sql:"-"` and unexported fields are ignored. The fields of
+// embedded structs are promoted (with lower precedence). The `sql` tag of an embedded struct,
+// if any, is a prefix prepended to the names of its fields (prefixes of nested embedded structs
+// are concatenated): with `sql:"user_"`, the field ID of the embedded struct matches the
+// column "user_id". Every column must match a field.
+// Use pointer fields to handle NULL values.
+//
+// Otherwise the row must have a single column that is scanned into dest.
+//
+// If *T implements [AfterScanner], its AfterScan method is called once dest is filled.
+//
+// The following options are supported for struct types: [WithAllowedColumns], [WithColumnMapping],
+// [WithColumnTypesCheck], [WithExpectedColumns].
+func ScanPtr[T any](rows *sql.Rows, dest *T, opts ...Option) error {
+	v := reflect.ValueOf(dest).Elem()
+	var err error
+	if !isStructDest(v.Type()) {
+		err = rows.Scan(scanner(v.Addr()))
+	} else {
+		o := newOptions(opts)
+		var paths [][]int
+		if paths, err = structPlan(rows, v.Type(), o); err != nil {
+			return err
+		}
+		err = rows.Scan(o.structScanners(v, paths)...)
+	}
+	if err != nil {
+		return err
+	}
+	if s, ok := any(dest).(AfterScanner); ok {
+		return s.AfterScan()
+	}
+	return nil
+}
+
+// ScanAll iterates rows and appends the values scanned from each row to *dest.
+//
+// See [ScanPtr] for the scanning rules. The matching of columns to struct fields is done once.
+//
+// The following options are supported for struct types: [WithAllowedColumns], [WithColumnMapping],
+// [WithColumnTypesCheck], [WithExpectedColumns].
+//
+// rows are closed before returning.
+func ScanAll[T any](rows *sql.Rows, dest *[]T, opts ...Option) (err error) {
+	defer func() {
+		e := rows.Close()
+		if err == nil {
+			err = e
+		}
+	}()
+
+	var zero T
+	_, afterScan := any(&zero).(AfterScanner)
+	o := newOptions(opts)
+	var paths [][]int
+	if t := reflect.TypeOf(&zero).Elem(); isStructDest(t) {
+		if paths, err = structPlan(rows, t, o); err != nil {
+			return
+		}
+	}
+
+	for rows.Next() {
+		*dest = append(*dest, zero)
+		v := reflect.ValueOf(&(*dest)[len(*dest)-1]).Elem()
+		if paths != nil {
+			err = rows.Scan(o.structScanners(v, paths)...)
+		} else {
+			err = rows.Scan(scanner(v.Addr()))
+		}
+		if err == nil && afterScan {
+			err = v.Addr().Interface().(AfterScanner).AfterScan()
+		}
+		if err != nil {
+			*dest = (*dest)[:len(*dest)-1]
+			return
+		}
+	}
+	return rows.Err()
+}
+
+// ForEachT iterates rows, scans each row into a value of type T and calls callback with it.
+//
+// See [ScanPtr] for the scanning rules. Unlike [ForEach], no func is built with reflection:
+// the matching of columns to struct fields is done once, before iterating.
+// If callback returns an error, iteration stops and that error is returned.
+//
+// The following options are supported for struct types: [WithAllowedColumns], [WithColumnMapping],
+// [WithColumnTypesCheck], [WithExpectedColumns].
+//
+// rows are closed before returning.
+func ForEachT[T any](rows *sql.Rows, callback func(T) error, opts ...Option) (err error) {
+	if callback == nil {
+		panic("callback must be non-nil")
+	}
+
+	defer func() {
+		e := rows.Close()
+		if err == nil {
+			err = e
+		}
+	}()
+
+	var zero, value T
+	afterScan, _ := any(&value).(AfterScanner)
+	v := reflect.ValueOf(&value).Elem()
+	var scanners []interface{}
+	if t := v.Type(); isStructDest(t) {
+		o := newOptions(opts)
+		paths, err := structPlan(rows, t, o)
+		if err != nil {
+			return err
+		}
+		scanners = o.structScanners(v, paths)
+	} else {
+		scanners = []interface{}{scanner(v.Addr())}
+	}
+
+	for rows.Next() {
+		value = zero
+		if err = rows.Scan(scanners...); err != nil {
+			return
+		}
+		if afterScan != nil {
+			if err = afterScan.AfterScan(); err != nil {
+				return // user error: don't wrap
+			}
+		}
+		if err = callback(value); err != nil {
+			return // user error: don't wrap
+		}
+	}
+	return rows.Err()
+}
+
+// QueryChanInto runs query with args and sends each row, scanned into a value of type T,
+// to ch. It returns once all rows are sent, or on the first error.
+//
+// See [ScanPtr] for the scanning rules.
+//
+// The caller owns ch: QueryChanInto doesn't close it. Sending blocks until the value is received
+// or ctx is done (in that case the error of ctx is returned); QueryChanInto doesn't block
+// after the last value is sent.
+func QueryChanInto[T any](ctx context.Context, db QueryConn, query string, ch chan<- T, args ...interface{}) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return ForEachT(rows, func(v T) error {
+		select {
+		case ch <- v:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// QueryMap runs query with args and returns a map built from the rows: the first column is
+// scanned as the key and the second as the value.
+//
+// The query must return exactly two columns. A NULL key or a duplicate key is an error.
+// Use a pointer type for V to handle NULL values.
+func QueryMap[K comparable, V any](ctx context.Context, db QueryConn, query string, args ...interface{}) (m map[K]V, err error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		e := rows.Close()
+		if err == nil {
+			err = e
+		}
+		if err != nil {
+			m = nil
+		}
+	}()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) != 2 {
+		return nil, fmt.Errorf("sqlfunc: QueryMap expects 2 columns, got %d", len(columns))
+	}
+
+	m = make(map[K]V)
+	var (
+		k K
+		v V
+	)
+	kv := reflect.ValueOf(&k).Elem()
+	nullableKey := kv.Kind() == reflect.Ptr || kv.Kind() == reflect.Interface
+	scanners := []interface{}{scanner(kv.Addr()), scanner(reflect.ValueOf(&v))}
+	var zeroK K
+	var zeroV V
+	for rows.Next() {
+		k, v = zeroK, zeroV
+		if err = rows.Scan(scanners...); err != nil {
+			return
+		}
+		if nullableKey && kv.IsNil() {
+			return nil, fmt.Errorf("sqlfunc: NULL key in column %q", columns[0])
+		}
+		if _, exists := m[k]; exists {
+			return nil, fmt.Errorf("sqlfunc: duplicate key %v in column %q", k, columns[0])
+		}
+		m[k] = v
+	}
+	return m, rows.Err()
+}
+
+// QueryGroup runs query with args, scans each row into a value of type V and groups the values by
+// the key computed by keyFn: this loads the children of multiple parents in one query
+// (a one-to-many join). The values keep the order of the rows in each group.
+//
+// See [ScanPtr] for the scanning rules. An empty result gives an empty non-nil map.
+func QueryGroup[K comparable, V any](ctx context.Context, db QueryConn, query string, keyFn func(V) K, args ...interface{}) (map[K][]V, error) {
+	if keyFn == nil {
+		panic("keyFn must be non-nil")
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[K][]V)
+	err = ForEachT(rows, func(v V) error {
+		k := keyFn(v)
+		m[k] = append(m[k], v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
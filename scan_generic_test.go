@@ -0,0 +1,982 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func querySeries(t testing.TB, db *sql.DB, n int) *sql.Rows {
+	t.Helper()
+	rows, err := db.QueryContext(context.Background(), ``+
+		`WITH RECURSIVE series(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM series WHERE n < ?)`+
+		` SELECT n FROM series WHERE n <= ?`, n, n)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	return rows
+}
+
+func ExampleForEachBatch() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, ``+
+		`WITH RECURSIVE series(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM series WHERE n < 7)`+
+		` SELECT n FROM series`)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+
+	err = sqlfunc.ForEachBatch(rows, 3, func(batch []int) error {
+		fmt.Println(batch)
+		return nil
+	})
+	if err != nil {
+		fmt.Println("ForEachBatch:", err)
+	}
+
+	// Output:
+	// [1 2 3]
+	// [4 5 6]
+	// [7]
+}
+
+func TestForEachBatch(t *testing.T) {
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	for _, tc := range []struct {
+		rows, batchSize int
+		expected        []int // batch sizes
+	}{
+		{0, 3, nil},
+		{1, 3, []int{1}},
+		{3, 3, []int{3}},
+		{4, 3, []int{3, 1}},
+		{6, 2, []int{2, 2, 2}},
+	} {
+		var sizes []int
+		var values []int64
+		err := sqlfunc.ForEachBatch(querySeries(t, db, tc.rows), tc.batchSize, func(batch []int64) error {
+			sizes = append(sizes, len(batch))
+			values = append(values, batch...)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%d rows by %d: %v", tc.rows, tc.batchSize, err)
+			continue
+		}
+		if !reflect.DeepEqual(sizes, tc.expected) {
+			t.Errorf("%d rows by %d: got batches %v, expected %v", tc.rows, tc.batchSize, sizes, tc.expected)
+		}
+		if tc.rows > 0 && (len(values) != tc.rows || values[0] != 1 || values[tc.rows-1] != int64(tc.rows)) {
+			t.Errorf("%d rows by %d: got values %v", tc.rows, tc.batchSize, values)
+		}
+	}
+
+	// Abort on callback error
+	var calls int
+	err = sqlfunc.ForEachBatch(querySeries(t, db, 10), 2, func(batch []int64) error {
+		calls++
+		if calls == 2 {
+			return io.EOF
+		}
+		return nil
+	})
+	if !errors.Is(err, io.EOF) || calls != 2 {
+		t.Errorf("got %v after %d calls", err, calls)
+	}
+}
+
+type poi struct {
+	Name string
+	Lat  float64 `sql:"latitude"`
+	Lon  float64 `sql:"longitude"`
+	Note *string
+	Skip string `sql:"-"`
+}
+
+func ExampleScanOne() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `SELECT name, lat AS latitude, lon AS longitude FROM poi ORDER BY name`)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := sqlfunc.ScanOne[poi](rows)
+		if err != nil {
+			fmt.Println("ScanOne:", err)
+			return
+		}
+		fmt.Printf("%s (%.4f %.4f)\n", p.Name, p.Lat, p.Lon)
+	}
+	if err = rows.Err(); err != nil {
+		fmt.Println("Next:", err)
+	}
+
+	// Output:
+	// Château de Versailles (48.8016 2.1204)
+	// Villeperdue (47.2009 0.6317)
+}
+
+func TestScanPtr(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	scanFirst := func(t *testing.T, query string, dest interface{}) error {
+		t.Helper()
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		defer rows.Close()
+		if !rows.Next() {
+			t.Fatalf("Next: %v", rows.Err())
+		}
+		switch dest := dest.(type) {
+		case *poi:
+			return sqlfunc.ScanPtr(rows, dest)
+		case *int:
+			return sqlfunc.ScanPtr(rows, dest)
+		case *time.Time:
+			return sqlfunc.ScanPtr(rows, dest)
+		default:
+			panic("unexpected type")
+		}
+	}
+
+	var p poi
+	if err = scanFirst(t, `SELECT 'a' AS NAME, 1.5 AS latitude, NULL AS note`, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "a" || p.Lat != 1.5 || p.Note != nil {
+		t.Errorf("got %+v", p)
+	}
+	if err = scanFirst(t, `SELECT 'b' AS name, 'x' AS note`, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "b" || p.Note == nil || *p.Note != "x" {
+		t.Errorf("got %+v", p)
+	}
+	if err = scanFirst(t, `SELECT 'c' AS skip`, &p); err == nil || !strings.Contains(err.Error(), `"skip"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	var n int
+	if err = scanFirst(t, `SELECT 42`, &n); err != nil || n != 42 {
+		t.Errorf("got %d, %v", n, err)
+	}
+
+	// time.Time is not scanned as a struct
+	var tm time.Time
+	if err = scanFirst(t, `SELECT 'x'`, &tm); err == nil || strings.Contains(err.Error(), "no matching field") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+type embeddedPOI struct {
+	poi
+	Name string // shadows poi.Name
+	ID   int64
+}
+
+func TestScanPtrEmbedded(t *testing.T) {
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT 1 AS id, 'x' AS name, 2.5 AS latitude`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+	rows.Next()
+	v, err := sqlfunc.ScanOne[embeddedPOI](rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ID != 1 || v.Name != "x" || v.poi.Name != "" || v.Lat != 2.5 {
+		t.Errorf("got %+v", v)
+	}
+}
+
+func ExampleScanPtr_prefix() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.ExecContext(ctx, ``+
+		`CREATE TABLE user (id INTEGER PRIMARY KEY, name TEXT);`+
+		`CREATE TABLE address (user_id INTEGER, city TEXT);`+
+		`INSERT INTO user VALUES (1, 'Olivier'), (2, 'Alice');`+
+		`INSERT INTO address VALUES (1, 'Paris'), (2, 'Lyon')`)
+	if err != nil {
+		fmt.Println("Create:", err)
+		return
+	}
+
+	type User struct {
+		ID   int64
+		Name string
+	}
+	type Address struct {
+		City string
+	}
+	type UserWithAddress struct {
+		User    `sql:"user_"`
+		Address `sql:"addr_"`
+	}
+
+	rows, err := db.QueryContext(ctx, ``+
+		`SELECT u.id AS user_id, u.name AS user_name, a.city AS addr_city`+
+		` FROM user u JOIN address a ON a.user_id = u.id ORDER BY u.id`)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u UserWithAddress
+		if err := sqlfunc.ScanPtr(rows, &u); err != nil {
+			fmt.Println("ScanPtr:", err)
+			return
+		}
+		fmt.Println(u.ID, u.Name, u.City)
+	}
+	if err := rows.Err(); err != nil {
+		fmt.Println("Next:", err)
+	}
+
+	// Output:
+	// 1 Olivier Paris
+	// 2 Alice Lyon
+}
+
+func BenchmarkScanOne(b *testing.B) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		b.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	stmt, err := db.PrepareContext(ctx, ``+
+		`WITH RECURSIVE series(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM series WHERE n < 500)`+
+		` SELECT n, 'name' || n AS name FROM series`)
+	if err != nil {
+		b.Fatalf("Prepare: %v", err)
+	}
+	defer stmt.Close()
+
+	run := func(b *testing.B, scan func(rows *sql.Rows) error) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows, err := stmt.Query()
+			if err != nil {
+				b.Fatal(err)
+			}
+			for rows.Next() {
+				if err := scan(rows); err != nil {
+					b.Fatal(err)
+				}
+			}
+			rows.Close()
+		}
+	}
+
+	b.Run("sqlfunc.Scan_return", func(b *testing.B) {
+		var scan func(rows *sql.Rows) (int, string, error)
+		sqlfunc.Scan(&scan)
+		run(b, func(rows *sql.Rows) error {
+			_, _, err := scan(rows)
+			return err
+		})
+	})
+
+	type row struct {
+		N    int
+		Name string
+	}
+	b.Run("sqlfunc.ScanOne_struct", func(b *testing.B) {
+		run(b, func(rows *sql.Rows) error {
+			_, err := sqlfunc.ScanOne[row](rows)
+			return err
+		})
+	})
+
+	b.Run("sqlfunc.ScanPtr_struct", func(b *testing.B) {
+		var r row
+		run(b, func(rows *sql.Rows) error {
+			return sqlfunc.ScanPtr(rows, &r)
+		})
+	})
+}
+
+func TestWithAllowedColumns(t *testing.T) {
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	allowed := sqlfunc.WithAllowedColumns([]string{"name", "Latitude", "longitude"})
+
+	for _, tc := range []struct {
+		query string
+		err   string
+	}{
+		{`SELECT 'a' AS name, 1.5 AS latitude`, ""},
+		{`SELECT 'a' AS NAME, 1.5 AS LATITUDE, 2.5 AS longitude`, ""},
+		{`SELECT 'a' AS name, 'x' AS note`, `unexpected column "note"`},
+	} {
+		rows, err := db.Query(tc.query)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		rows.Next()
+		_, err = sqlfunc.ScanOne[poi](rows, allowed)
+		rows.Close()
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tc.query, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%s: got %v, expected %q", tc.query, err, tc.err)
+		}
+	}
+}
+
+func TestScanOneExpectedColumns(t *testing.T) {
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	expected := sqlfunc.WithExpectedColumns([]string{"name", "latitude"})
+
+	for _, tc := range []struct {
+		query string
+		err   string
+	}{
+		{`SELECT 'a' AS name, 1.5 AS latitude`, ""},
+		{`SELECT 1.5 AS latitude, 'a' AS name`, `column 1 is "latitude", expected "name"`},
+		{`SELECT 'a' AS name`, `got 1 columns ["name"], expected 2 columns`},
+	} {
+		rows, err := db.Query(tc.query)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		rows.Next()
+		_, err = sqlfunc.ScanOne[poi](rows, expected)
+		rows.Close()
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tc.query, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%s: got %v, expected %q", tc.query, err, tc.err)
+		}
+	}
+}
+
+func ExampleScanAll() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `SELECT name, lat AS latitude, lon AS longitude FROM poi ORDER BY name`)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+	var pois []poi
+	if err = sqlfunc.ScanAll(rows, &pois); err != nil {
+		fmt.Println("ScanAll:", err)
+		return
+	}
+	for _, p := range pois {
+		fmt.Printf("%s (%.4f %.4f)\n", p.Name, p.Lat, p.Lon)
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT name FROM poi ORDER BY name`)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+	var names []string
+	if err = sqlfunc.ScanAll(rows, &names); err != nil {
+		fmt.Println("ScanAll:", err)
+		return
+	}
+	fmt.Println(names)
+
+	// Output:
+	// Château de Versailles (48.8016 2.1204)
+	// Villeperdue (47.2009 0.6317)
+	// [Château de Versailles Villeperdue]
+}
+
+func BenchmarkScanAll(b *testing.B) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		b.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	const nbRows = 500
+	stmt, err := db.PrepareContext(ctx, ``+
+		`WITH RECURSIVE series(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM series WHERE n < 500)`+
+		` SELECT n, 'name' || n AS name FROM series`)
+	if err != nil {
+		b.Fatalf("Prepare: %v", err)
+	}
+	defer stmt.Close()
+
+	type row struct {
+		N    int
+		Name string
+	}
+	values := make([]row, 0, nbRows)
+
+	b.Run("sqlfunc.ForEach", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows, err := stmt.Query()
+			if err != nil {
+				b.Fatal(err)
+			}
+			values = values[:0]
+			err = sqlfunc.ForEach(rows, func(n int, name string) {
+				values = append(values, row{n, name})
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(values) != nbRows {
+				b.Fatal("unexpected result")
+			}
+		}
+	})
+
+	b.Run("sqlfunc.ScanAll", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows, err := stmt.Query()
+			if err != nil {
+				b.Fatal(err)
+			}
+			values = values[:0]
+			if err = sqlfunc.ScanAll(rows, &values); err != nil {
+				b.Fatal(err)
+			}
+			if len(values) != nbRows {
+				b.Fatal("unexpected result")
+			}
+		}
+	})
+
+	b.Run("sqlfunc.ForEachT", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows, err := stmt.Query()
+			if err != nil {
+				b.Fatal(err)
+			}
+			values = values[:0]
+			err = sqlfunc.ForEachT(rows, func(r row) error {
+				values = append(values, r)
+				return nil
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(values) != nbRows {
+				b.Fatal("unexpected result")
+			}
+		}
+	})
+}
+
+func ExampleForEachT() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, ``+
+		`SELECT 'Château de Versailles' AS name, 'Versailles' AS city`+
+		` UNION ALL SELECT 'Tour Eiffel', NULL`)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+
+	type place struct {
+		Name string
+		City *string // NULL => nil
+	}
+	err = sqlfunc.ForEachT(rows, func(p place) error {
+		if p.City == nil {
+			fmt.Printf("%s (unknown city)\n", p.Name)
+		} else {
+			fmt.Printf("%s (%s)\n", p.Name, *p.City)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("ForEachT:", err)
+	}
+
+	// Output:
+	// Château de Versailles (Versailles)
+	// Tour Eiffel (unknown city)
+}
+
+// account normalizes and validates its fields after scanning.
+type account struct {
+	ID    int
+	Email string
+}
+
+func (a *account) AfterScan() error {
+	a.Email = strings.ToLower(strings.TrimSpace(a.Email))
+	if !strings.Contains(a.Email, "@") {
+		return fmt.Errorf("account %d: invalid email %q", a.ID, a.Email)
+	}
+	return nil
+}
+
+func ExampleAfterScanner() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, ``+
+		`SELECT 1 AS id, ' Alice@Example.COM ' AS email`+
+		` UNION ALL SELECT 2, 'bob'`+
+		` UNION ALL SELECT 3, 'carol@example.com'`)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+
+	err = sqlfunc.ForEachT(rows, func(a account) error {
+		fmt.Printf("%d: %s\n", a.ID, a.Email)
+		return nil
+	})
+	if err != nil {
+		fmt.Println("ForEachT:", err)
+	}
+
+	// Output:
+	// 1: alice@example.com
+	// ForEachT: account 2: invalid email "bob"
+}
+
+func TestForEachT(t *testing.T) {
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	// Single column
+	var sum int
+	err = sqlfunc.ForEachT(querySeries(t, db, 10), func(n int) error {
+		sum += n
+		return nil
+	})
+	if err != nil || sum != 55 {
+		t.Errorf("got %d, %v", sum, err)
+	}
+
+	// Callback error stops iteration
+	errStop := errors.New("stop")
+	var count int
+	err = sqlfunc.ForEachT(querySeries(t, db, 10), func(n int) error {
+		count++
+		if n == 3 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop || count != 3 {
+		t.Errorf("got %d, %v", count, err)
+	}
+
+	// Unmatched column
+	rows, err := db.Query(`SELECT 1 AS unknown`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	err = sqlfunc.ForEachT(rows, func(p poi) error {
+		t.Error("unexpected call")
+		return nil
+	})
+	if err == nil {
+		t.Error("error expected")
+	}
+}
+
+func TestWithColumnTypesCheck(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.ExecContext(ctx, ``+
+		`CREATE TABLE poi (id INTEGER, name TEXT, lat REAL);`+
+		`INSERT INTO poi VALUES (1, 'Château de Versailles', 48.8016)`)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	type good struct {
+		ID   int64
+		Name *string
+		Lat  float64
+	}
+	type bad struct {
+		ID   string // integer column
+		Name string
+		Lat  float64
+	}
+
+	query := func() *sql.Rows {
+		rows, err := db.QueryContext(ctx, `SELECT id, name, lat FROM poi`)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		return rows
+	}
+
+	var goods []good
+	if err = sqlfunc.ScanAll(query(), &goods, sqlfunc.WithColumnTypesCheck()); err != nil || len(goods) != 1 {
+		t.Errorf("good: got %v, %v", goods, err)
+	}
+
+	// Without the check, database/sql converts the integer to a string
+	var bads []bad
+	if err = sqlfunc.ScanAll(query(), &bads); err != nil || len(bads) != 1 || bads[0].ID != "1" {
+		t.Errorf("bad without check: got %v, %v", bads, err)
+	}
+
+	bads = nil
+	err = sqlfunc.ScanAll(query(), &bads, sqlfunc.WithColumnTypesCheck())
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	if len(bads) != 0 {
+		t.Errorf("no values expected: %v", bads)
+	}
+	if msg := err.Error(); !strings.Contains(msg, `"id"`) || !strings.Contains(msg, "ID string") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func ExampleQueryChanInto() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	type place struct {
+		Name string
+		Lat  float64
+	}
+
+	ch := make(chan place)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- sqlfunc.QueryChanInto(ctx, db, `SELECT name, lat FROM poi WHERE name = ?`, ch, "Château de Versailles")
+		close(ch) // The channel is owned by the caller
+	}()
+
+	// Consumer
+	for p := range ch {
+		fmt.Printf("%s %.4f\n", p.Name, p.Lat)
+	}
+	if err := <-errc; err != nil {
+		fmt.Println("QueryChanInto:", err)
+	}
+
+	// Output:
+	// Château de Versailles 48.8016
+}
+
+func TestQueryChanIntoCancel(t *testing.T) {
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch := make(chan int)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- sqlfunc.QueryChanInto(ctx, db, ``+
+			`WITH RECURSIVE series(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM series WHERE n < 1000)`+
+			` SELECT n FROM series`, ch)
+	}()
+
+	if n := <-ch; n != 1 {
+		t.Errorf("got %d, expected 1", n)
+	}
+	cancel() // The consumer stops receiving
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, expected %v", err, context.Canceled)
+	}
+}
+
+func ExampleQueryMap() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.ExecContext(ctx, ``+
+		`CREATE TABLE settings (k TEXT PRIMARY KEY, v TEXT);`+
+		`INSERT INTO settings VALUES ('lang', 'fr'), ('theme', 'dark')`)
+	if err != nil {
+		fmt.Println("Create:", err)
+		return
+	}
+
+	settings, err := sqlfunc.QueryMap[string, string](ctx, db, `SELECT k, v FROM settings`)
+	if err != nil {
+		fmt.Println("QueryMap:", err)
+		return
+	}
+	fmt.Println(settings["lang"], settings["theme"])
+
+	// Output:
+	// fr dark
+}
+
+func TestQueryMap(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	m, err := sqlfunc.QueryMap[int, *string](ctx, db, `SELECT 1, 'a' UNION ALL SELECT 2, NULL`)
+	if err != nil || len(m) != 2 || *m[1] != "a" || m[2] != nil {
+		t.Errorf("got %v, %v", m, err)
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  string
+	}{
+		{`SELECT 1`, "2 columns"},
+		{`SELECT 1, 2, 3`, "2 columns"},
+		{`SELECT 1, 'a' UNION ALL SELECT 1, 'b'`, "duplicate key 1"},
+		{`SELECT NULL, 'a'`, "NULL"},
+	} {
+		m, err := sqlfunc.QueryMap[int, string](ctx, db, tc.query)
+		if err == nil || !strings.Contains(err.Error(), tc.want) || m != nil {
+			t.Errorf("%s: got %v, %v; expected error %q", tc.query, m, err, tc.want)
+		}
+	}
+
+	// NULL key with a nullable key type
+	if m, err := sqlfunc.QueryMap[interface{}, string](ctx, db, `SELECT NULL, 'a'`); err == nil {
+		t.Errorf("got %v, error expected", m)
+	}
+}
+
+func ExampleWithColumnMapping() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	type pair struct {
+		From, To string
+		LatDelta float64
+	}
+
+	// Both name columns are named "name": map the columns to the fields by index
+	rows, err := db.QueryContext(ctx, `SELECT ROUND(ABS(a.lat - b.lat), 2), a.name, b.name FROM poi a JOIN poi b ON a.name < b.name`)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+	var pairs []pair
+	if err = sqlfunc.ScanAll(rows, &pairs, sqlfunc.WithColumnMapping([]int{2, 0, 1})); err != nil {
+		fmt.Println("ScanAll:", err)
+		return
+	}
+	for _, p := range pairs {
+		fmt.Printf("%s -> %s: %.2f\n", p.From, p.To, p.LatDelta)
+	}
+
+	// The mapping must give a field for each column
+	rows, err = db.QueryContext(ctx, `SELECT a.name, b.name FROM poi a JOIN poi b ON a.name < b.name`)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+	err = sqlfunc.ScanAll(rows, &pairs, sqlfunc.WithColumnMapping([]int{0}))
+	fmt.Println(err)
+
+	// Output:
+	// Château de Versailles -> Villeperdue: 1.60
+	// sqlfunc: column mapping has 1 fields for 2 columns
+}
+
+func ExampleQueryGroup() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.ExecContext(ctx, ``+
+		`CREATE TABLE addresses (id INTEGER, user_id INTEGER, city TEXT);`+
+		`INSERT INTO addresses VALUES (10, 1, 'Paris'), (11, 2, 'Lyon'), (12, 1, 'Nice'), (13, 3, 'Brest')`)
+	if err != nil {
+		fmt.Println("Create:", err)
+		return
+	}
+
+	type Address struct {
+		ID     int64
+		UserID int64 `sql:"user_id"`
+		City   string
+	}
+
+	byUser, err := sqlfunc.QueryGroup(ctx, db,
+		`SELECT id, user_id, city FROM addresses WHERE user_id IN (?, ?) ORDER BY id`,
+		func(a Address) int64 { return a.UserID },
+		1, 2)
+	if err != nil {
+		fmt.Println("QueryGroup:", err)
+		return
+	}
+	for _, userID := range []int64{1, 2, 3} {
+		fmt.Println(userID, byUser[userID])
+	}
+
+	// Output:
+	// 1 [{10 1 Paris} {12 1 Nice}]
+	// 2 [{11 2 Lyon}]
+	// 3 []
+}
+
+func TestQueryGroup(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	// Scalar values
+	m, err := sqlfunc.QueryGroup(ctx, db,
+		`SELECT 'a' UNION ALL SELECT 'bb' UNION ALL SELECT 'c' UNION ALL SELECT 'dd'`,
+		func(s string) int { return len(s) })
+	if err != nil || len(m) != 2 || fmt.Sprint(m[1]) != "[a c]" || fmt.Sprint(m[2]) != "[bb dd]" {
+		t.Errorf("got %v, %v", m, err)
+	}
+
+	empty, err := sqlfunc.QueryGroup(ctx, db, `SELECT 1 WHERE 0`, func(n int) int { return n })
+	if err != nil || empty == nil || len(empty) != 0 {
+		t.Errorf("no rows: got %#v, %v", empty, err)
+	}
+
+	if _, err = sqlfunc.QueryGroup(ctx, db, `SELECT NULL`, func(n int) int { return n }); err == nil {
+		t.Error("scan error expected")
+	}
+}
@@ -17,12 +17,18 @@ limitations under the License.
 package sqlfunc_test
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -140,6 +146,136 @@ func ExampleForEach_returnError() {
 	// Done.
 }
 
+func ExampleForEachBuf() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		log.Printf("Open: %v", err)
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `SELECT name, lat, lon FROM poi ORDER BY name`)
+	if err != nil {
+		log.Printf("Query: %v", err)
+		return
+	}
+
+	// Write a CSV line per row
+	err = sqlfunc.ForEachBuf(rows, func(buf *bytes.Buffer, name string, lat, lon float64) error {
+		buf.WriteString(strconv.Quote(name))
+		buf.WriteByte(',')
+		buf.WriteString(strconv.FormatFloat(lat, 'f', 4, 64))
+		buf.WriteByte(',')
+		buf.WriteString(strconv.FormatFloat(lon, 'f', 4, 64))
+		buf.WriteByte('\n')
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	})
+	if err != nil {
+		log.Printf("ForEachBuf: %v", err)
+	}
+
+	// Output:
+	// "Château de Versailles",48.8016,2.1204
+	// "Villeperdue",47.2009,0.6317
+}
+
+func TestForEachBuf(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `SELECT 1, 'a' UNION ALL SELECT 2, 'b' UNION ALL SELECT 3, 'c'`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var (
+		bufs    []*bytes.Buffer
+		lines   []string
+		scanned []interface{}
+	)
+	err = sqlfunc.ForEach(rows, func(buf *bytes.Buffer, n int, s string) bool {
+		if buf.Len() != 0 {
+			t.Errorf("buffer not reset: %q", buf.String())
+		}
+		bufs = append(bufs, buf)
+		fmt.Fprint(buf, n, s)
+		lines = append(lines, buf.String())
+		return n < 2
+	}, sqlfunc.WithAfterScan(func(values []interface{}) error {
+		scanned = append(scanned, values...)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("ForEach: %v", err)
+	}
+	if len(bufs) != 2 || bufs[0] != bufs[1] {
+		t.Errorf("the buffer must be reused: %v", bufs)
+	}
+	if fmt.Sprint(lines) != "[1a 2b]" || fmt.Sprint(scanned) != "[1 a 2 b]" {
+		t.Errorf("got %q, %v", lines, scanned)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic expected for a callback without *bytes.Buffer")
+			}
+		}()
+		_ = sqlfunc.ForEachBuf(nil, func(n int) {})
+	}()
+}
+
+func TestForEachReturnBoolError(t *testing.T) {
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	errStop := errors.New("stop")
+	for _, tc := range []struct {
+		name      string
+		stopAt    int
+		stopErr   error
+		wantCalls int
+		wantErr   error
+	}{
+		{"continue", 0, nil, 3, nil},
+		{"stop", 2, nil, 2, nil},
+		{"error", 2, errStop, 2, errStop},
+		{"continue+error", -2, errStop, 2, errStop},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rows, err := db.Query(`SELECT 1 UNION ALL SELECT 2 UNION ALL SELECT 3`)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			var calls int
+			err = sqlfunc.ForEach(rows, func(n int) (bool, error) {
+				calls++
+				switch n {
+				case tc.stopAt:
+					return false, tc.stopErr
+				case -tc.stopAt:
+					return true, tc.stopErr
+				}
+				return true, nil
+			})
+			if err != tc.wantErr {
+				t.Errorf("got error %v, expected %v", err, tc.wantErr)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("got %d calls, expected %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
 func TestForEachMulti(t *testing.T) {
 	testForEachMulti := func(t *testing.T) {
 		ctx := context.Background()
@@ -247,6 +383,66 @@ func ExampleScan() {
 	// [a b]
 }
 
+func ExampleScan_join() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		log.Printf("Open: %v", err)
+		return
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, ``+
+		`CREATE TABLE users (id INTEGER, name TEXT);`+
+		`CREATE TABLE addresses (id INTEGER, user_id INTEGER, city TEXT);`+
+		`INSERT INTO users VALUES (1, 'Alice'), (2, 'Bob');`+
+		`INSERT INTO addresses VALUES (10, 1, 'Paris'), (11, 2, 'Lyon'), (12, 1, 'Nice');`)
+	if err != nil {
+		log.Printf("Create: %v", err)
+		return
+	}
+
+	type User struct {
+		ID   int64
+		Name string
+	}
+	type Address struct {
+		ID     int64
+		UserID int64 `sql:"user_id"`
+		City   string
+	}
+
+	// The columns of u go to *User, until the second "id" that goes to *Address
+	var scanUserAddress func(rows *sql.Rows, u *User, a *Address) error
+	sqlfunc.Scan(&scanUserAddress)
+
+	rows, err := db.QueryContext(ctx, `SELECT u.*, a.* FROM users u JOIN addresses a ON a.user_id = u.id ORDER BY a.id`)
+	if err != nil {
+		log.Printf("Query: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			u User
+			a Address
+		)
+		if err = scanUserAddress(rows, &u, &a); err != nil {
+			log.Printf("Scan: %v", err)
+			return
+		}
+		fmt.Printf("%+v %+v\n", u, a)
+	}
+	if err = rows.Err(); err != nil {
+		log.Printf("Next: %v", err)
+	}
+
+	// Output:
+	// {ID:1 Name:Alice} {ID:10 UserID:1 City:Paris}
+	// {ID:2 Name:Bob} {ID:11 UserID:2 City:Lyon}
+	// {ID:1 Name:Alice} {ID:12 UserID:1 City:Nice}
+}
+
 func ExampleScan_any() {
 	ctx := context.Background()
 	db, err := sql.Open(sqliteDriver, ":memory:")
@@ -471,4 +667,809 @@ func BenchmarkScan(b *testing.B) {
 			rows.Close()
 		}
 	})
+
+	stmt3, err := db.PrepareContext(ctx, `SELECT n, 'name' || n, n * 1.5 FROM (SELECT 1 AS n`+query[len("SELECT 1"):]+`)`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer stmt3.Close()
+
+	b.Run("sqlfunc.Scan_return3", func(b *testing.B) {
+		b.ReportAllocs()
+		var scan func(rows *sql.Rows) (int, string, float64, error)
+		sqlfunc.Scan(&scan)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			rows, err := stmt3.Query()
+			if err != nil {
+				log.Println(err)
+				break
+			}
+			for rows.Next() {
+				n, s, f, err := scan(rows)
+				if err != nil {
+					log.Println(err)
+					break
+				}
+				_, _, _ = n, s, f
+			}
+			rows.Close()
+		}
+	})
+
+	b.Run("sqlfunc.Scan_return3_slab", func(b *testing.B) {
+		b.ReportAllocs()
+		var scan func(rows *sql.Rows) (int, string, float64, error)
+		sqlfunc.Scan(&scan, sqlfunc.WithAllocator(newSlabAllocator(256).alloc))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			rows, err := stmt3.Query()
+			if err != nil {
+				log.Println(err)
+				break
+			}
+			for rows.Next() {
+				n, s, f, err := scan(rows)
+				if err != nil {
+					log.Println(err)
+					break
+				}
+				_, _, _ = n, s, f
+			}
+			rows.Close()
+		}
+	})
+}
+
+// slabAllocator allocates values by slabs of values of the same type.
+// It is not safe for concurrent use.
+type slabAllocator struct {
+	size  int
+	slabs map[reflect.Type]*slab
+}
+
+type slab struct {
+	values reflect.Value // slice
+	next   int
+}
+
+func newSlabAllocator(size int) *slabAllocator {
+	return &slabAllocator{size: size, slabs: make(map[reflect.Type]*slab)}
+}
+
+func (a *slabAllocator) alloc(t reflect.Type) reflect.Value {
+	s := a.slabs[t]
+	if s == nil {
+		s = &slab{}
+		a.slabs[t] = s
+	}
+	if !s.values.IsValid() || s.next == s.values.Len() {
+		s.values = reflect.MakeSlice(reflect.SliceOf(t), a.size, a.size)
+		s.next = 0
+	}
+	s.next++
+	return s.values.Index(s.next - 1).Addr()
+}
+
+func ExampleWithAllocator() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		log.Printf("Open: %v", err)
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `SELECT 1, 'a' UNION ALL SELECT 2, 'b' UNION ALL SELECT 3, 'c'`)
+	if err != nil {
+		log.Printf("Query: %v", err)
+		return
+	}
+
+	// The values are allocated by slabs of 1024 values of each type instead of one by one
+	slab := newSlabAllocator(1024)
+	err = sqlfunc.ForEach(rows, func(id int, name string) {
+		fmt.Println(id, name)
+	}, sqlfunc.WithAllocator(slab.alloc))
+	if err != nil {
+		fmt.Println("ForEach:", err)
+	}
+
+	// Output:
+	// 1 a
+	// 2 b
+	// 3 c
+}
+
+func TestForEachCancelable(t *testing.T) {
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	const query = `WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 1000) SELECT i FROM n`
+
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var count int
+	var stop func()
+	stopped := make(chan struct{})
+	stop, done := sqlfunc.ForEachCancelable(rows, func(i int) {
+		count++
+		if i == 3 {
+			<-stopped // wait for stop to be set
+			stop()
+		}
+	})
+	close(stopped)
+	if err = <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, expected %v", err, context.Canceled)
+	}
+	if count != 3 {
+		t.Errorf("got %d rows, expected 3", count)
+	}
+	if _, ok := <-done; ok {
+		t.Error("done should be closed")
+	}
+	if rows.Next() {
+		t.Error("rows should be closed")
+	}
+	stop() // no-op
+
+	// Without stop
+	rows, err = db.Query(query)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	count = 0
+	_, done = sqlfunc.ForEachCancelable(rows, func(i int) { count++ })
+	if err = <-done; err != nil || count != 1000 {
+		t.Errorf("got %d rows, %v", count, err)
+	}
+
+	// A nil callback panics on the goroutine of the caller
+	for _, callback := range []interface{}{nil, (func(int))(nil)} {
+		func() {
+			defer func() {
+				if r := recover(); r != "callback must be non-nil" {
+					t.Errorf("%#v: got panic %v", callback, r)
+				}
+			}()
+			sqlfunc.ForEachCancelable(nil, callback)
+		}()
+	}
+}
+
+func ExampleWithAfterScan() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		log.Printf("Open: %v", err)
+		return
+	}
+	defer db.Close()
+
+	query := `` +
+		`SELECT 1, 'a'` +
+		` UNION ALL` +
+		` SELECT 2, ''` +
+		` UNION ALL` +
+		` SELECT 3, 'c'`
+
+	// The hook validates the rows before they reach the callback
+	validate := sqlfunc.WithAfterScan(func(values []interface{}) error {
+		if values[1].(string) == "" {
+			return fmt.Errorf("row %d: empty name", values[0])
+		}
+		return nil
+	})
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		log.Printf("Query: %v", err)
+		return
+	}
+
+	err = sqlfunc.ForEach(rows, func(id int, name string) {
+		fmt.Println(id, name)
+	}, validate)
+	fmt.Println("Error:", err)
+
+	// Output:
+	// 1 a
+	// Error: row 2: empty name
+}
+
+func TestWithoutClose(t *testing.T) {
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT 1 AS n UNION ALL SELECT 2 UNION ALL SELECT 3`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+
+	// Stop after the first row
+	err = sqlfunc.ForEach(rows, func(n int) bool { return false }, sqlfunc.WithoutClose())
+	if err != nil {
+		t.Fatalf("ForEach: %v", err)
+	}
+
+	// rows are still open
+	if columns, err := rows.Columns(); err != nil || len(columns) != 1 || columns[0] != "n" {
+		t.Errorf("Columns: got %v, %v", columns, err)
+	}
+	var rest []int
+	err = sqlfunc.ForEach(rows, func(n int) { rest = append(rest, n) })
+	if err != nil || len(rest) != 2 || rest[0] != 2 {
+		t.Errorf("ForEach: got %v, %v", rest, err)
+	}
+}
+
+func TestForEachContext(t *testing.T) {
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	const query = `` +
+		`WITH RECURSIVE series(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM series WHERE n < 100)` +
+		` SELECT n FROM series`
+
+	// Complete iteration
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	n, err := sqlfunc.ForEachContext(context.Background(), rows, func(int) {})
+	if err != nil || n != 100 {
+		t.Errorf("got %d, %v", n, err)
+	}
+
+	// Cancelled in the middle
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rows, err = db.Query(query)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	n, err = sqlfunc.ForEachContext(ctx, rows, func(n int) {
+		if n == 10 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) || n != 10 {
+		t.Errorf("got %d, %v; expected 10, %v", n, err, context.Canceled)
+	}
+
+	// Callback error: the failing row is not processed
+	errStop := errors.New("stop")
+	rows, err = db.Query(query)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	n, err = sqlfunc.ForEachContext(context.Background(), rows, func(n int) error {
+		if n == 5 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop || n != 4 {
+		t.Errorf("got %d, %v; expected 4, %v", n, err, errStop)
+	}
+}
+
+// TestScanNullPatterns checks that values scanned from a row don't leak into the next rows.
+func TestScanNullPatterns(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	const query = `` +
+		`SELECT 1, 'a'` +
+		` UNION ALL` +
+		` SELECT NULL, NULL` +
+		` UNION ALL` +
+		` SELECT 2, NULL` +
+		` UNION ALL` +
+		` SELECT NULL, 'b'`
+	expected := []string{"1 a", "<nil> <nil>", "2 <nil>", "<nil> b"}
+
+	format := func(n *int64, s *string) string {
+		var r [2]string
+		r[0], r[1] = "<nil>", "<nil>"
+		if n != nil {
+			r[0] = fmt.Sprint(*n)
+		}
+		if s != nil {
+			r[1] = *s
+		}
+		return r[0] + " " + r[1]
+	}
+
+	check := func(t *testing.T, got []string) {
+		t.Helper()
+		if len(got) != len(expected) {
+			t.Fatalf("got %q", got)
+		}
+		for i := range got {
+			if got[i] != expected[i] {
+				t.Errorf("row %d: got %q, expected %q", i, got[i], expected[i])
+			}
+		}
+	}
+
+	queryRows := func(t *testing.T) *sql.Rows {
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		return rows
+	}
+
+	t.Run("ForEach", func(t *testing.T) {
+		var got []string
+		err := sqlfunc.ForEach(queryRows(t), func(n *int64, s *string) {
+			got = append(got, format(n, s))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, got)
+	})
+
+	t.Run("Scan_return", func(t *testing.T) {
+		var scan func(*sql.Rows) (*int64, *string, error)
+		sqlfunc.Scan(&scan)
+		rows := queryRows(t)
+		defer rows.Close()
+		var got []string
+		for rows.Next() {
+			n, s, err := scan(rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, format(n, s))
+		}
+		check(t, got)
+	})
+
+	t.Run("Scan_ptr", func(t *testing.T) {
+		var scan func(*sql.Rows, **int64, **string) error
+		sqlfunc.Scan(&scan)
+		rows := queryRows(t)
+		defer rows.Close()
+		var got []string
+		// Reuse the same destinations
+		var n *int64
+		var s *string
+		for rows.Next() {
+			if err := scan(rows, &n, &s); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, format(n, s))
+		}
+		check(t, got)
+	})
+}
+
+// TestScanConcurrent checks that the funcs created by Scan and QueryRow can be used
+// concurrently and that the scanned values are not shared between calls (run with -race).
+func TestScanConcurrent(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	const query = `WITH RECURSIVE series(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM series WHERE n < 50)` +
+		` SELECT n, 'n' || n, CASE WHEN n % 2 = 0 THEN n END FROM series`
+
+	var scan func(*sql.Rows) (int, string, *int, error)
+	sqlfunc.Scan(&scan)
+	var scanPtr func(*sql.Rows, *int, *string, **int) error
+	sqlfunc.Scan(&scanPtr)
+
+	var get func(ctx context.Context, n int) (int, string, error)
+	closeGet, err := sqlfunc.QueryRow(ctx, db, `SELECT ?1, 'n' || ?1`, &get)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeGet()
+
+	check := func(n int, s string, even *int) {
+		if s != fmt.Sprint("n", n) || (n%2 == 0) != (even != nil) || (even != nil && *even != n) {
+			t.Errorf("got %d, %q, %v", n, s, even)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rows, err := db.QueryContext(ctx, query)
+			if err != nil {
+				t.Errorf("Query: %v", err)
+				return
+			}
+			defer rows.Close()
+			var previous *int
+			for rows.Next() {
+				var n int
+				var s string
+				var even *int
+				if g%2 == 0 {
+					n, s, even, err = scan(rows)
+				} else {
+					err = scanPtr(rows, &n, &s, &even)
+				}
+				if err != nil {
+					t.Errorf("scan: %v", err)
+					return
+				}
+				check(n, s, even)
+				if previous != nil && even == previous {
+					t.Error("destination reused between rows")
+				}
+				if even != nil {
+					previous = even
+				}
+
+				if m, s, err := get(ctx, n); err != nil || m != n || s != fmt.Sprint("n", n) {
+					t.Errorf("get(%d): got %d, %q, %v", n, m, s, err)
+				}
+			}
+			if err = rows.Err(); err != nil {
+				t.Errorf("Next: %v", err)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// closeErrDriver is a [driver.Connector] whose queries return the rows 1, 2, 3 and whose rows
+// fail to close.
+type closeErrDriver struct{}
+
+var errRowsClose = errors.New("rows close failure")
+
+func (d closeErrDriver) Connect(context.Context) (driver.Conn, error) { return closeErrConn{}, nil }
+func (d closeErrDriver) Driver() driver.Driver                        { return d }
+func (d closeErrDriver) Open(string) (driver.Conn, error)             { return closeErrConn{}, nil }
+
+type closeErrConn struct{}
+
+func (closeErrConn) Prepare(query string) (driver.Stmt, error) { return closeErrStmt{}, nil }
+func (closeErrConn) Close() error                              { return nil }
+func (closeErrConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type closeErrStmt struct{}
+
+func (closeErrStmt) Close() error  { return nil }
+func (closeErrStmt) NumInput() int { return -1 }
+func (closeErrStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (closeErrStmt) Query([]driver.Value) (driver.Rows, error) { return &closeErrRows{}, nil }
+
+type closeErrRows struct{ n int64 }
+
+func (*closeErrRows) Columns() []string { return []string{"n"} }
+func (*closeErrRows) Close() error      { return errRowsClose }
+
+func (r *closeErrRows) Next(dest []driver.Value) error {
+	if r.n == 3 {
+		return io.EOF
+	}
+	r.n++
+	dest[0] = r.n
+	return nil
+}
+
+func TestForEachCloseErr(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(closeErrDriver{})
+	defer db.Close()
+
+	errStop := errors.New("stop")
+
+	rows, err := db.QueryContext(ctx, `SELECT n`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	iterErr, closeErr := sqlfunc.ForEachCloseErr(rows, func(n int) error {
+		if n == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if iterErr != errStop {
+		t.Errorf("iterErr: got %v, expected %v", iterErr, errStop)
+	}
+	if closeErr != errRowsClose {
+		t.Errorf("closeErr: got %v, expected %v", closeErr, errRowsClose)
+	}
+
+	// ForEach merges the errors: the error of the iteration wins
+	rows, err = db.QueryContext(ctx, `SELECT n`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	err = sqlfunc.ForEach(rows, func(n int) error {
+		if n == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Errorf("ForEach: got %v, expected %v", err, errStop)
+	}
+
+	// Stopped without iteration error
+	rows, err = db.QueryContext(ctx, `SELECT n`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	iterErr, closeErr = sqlfunc.ForEachCloseErr(rows, func(n int) bool { return false })
+	if iterErr != nil || closeErr != errRowsClose {
+		t.Errorf("got (%v, %v), expected (nil, %v)", iterErr, closeErr, errRowsClose)
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT n`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	iterErr, closeErr = sqlfunc.ForEachCloseErr(rows, func(n int) bool { return false }, sqlfunc.WithoutClose())
+	if iterErr != nil || closeErr != nil {
+		t.Errorf("WithoutClose: got (%v, %v), expected (nil, nil)", iterErr, closeErr)
+	}
+	if err = rows.Close(); err != errRowsClose {
+		t.Errorf("Close: got %v, expected %v", err, errRowsClose)
+	}
+}
+
+func TestScanStructs(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	type A struct {
+		ID   int
+		Name string
+	}
+	type B struct {
+		ID    int
+		Label string
+	}
+	var scanABn func(rows *sql.Rows, a *A, b *B, n *int) error
+	sqlfunc.Scan(&scanABn)
+
+	for _, tc := range []struct {
+		query string
+		a     A
+		b     B
+		n     int
+		err   bool
+	}{
+		{query: `SELECT 1 AS id, 'x' AS name, 2 AS id, 'y' AS label, 3`, a: A{1, "x"}, b: B{2, "y"}, n: 3},
+		// A column without a field in A starts B
+		{query: `SELECT 'x' AS name, 'y' AS label, 3`, a: A{Name: "x"}, b: B{Label: "y"}, n: 3},
+		// A change of qualifier starts B
+		{query: `SELECT 1 AS "a.id", 2 AS "b.id", 'y' AS "b.label", 3`, a: A{ID: 1}, b: B{2, "y"}, n: 3},
+		// No column for n
+		{query: `SELECT 1 AS id, 2 AS id`, err: true},
+		// Too many columns
+		{query: `SELECT 1 AS id, 2 AS id, 3, 4`, err: true},
+		// No field for the first column
+		{query: `SELECT 1 AS unknown, 2 AS id, 3`, err: true},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			rows, err := db.QueryContext(ctx, tc.query)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			defer rows.Close()
+			if !rows.Next() {
+				t.Fatalf("Next: %v", rows.Err())
+			}
+			var (
+				a A
+				b B
+				n int
+			)
+			err = scanABn(rows, &a, &b, &n)
+			if tc.err {
+				if err == nil {
+					t.Errorf("error expected, got %+v %+v %d", a, b, n)
+				} else {
+					t.Log(err)
+				}
+				return
+			}
+			if err != nil || a != tc.a || b != tc.b || n != tc.n {
+				t.Errorf("got %+v %+v %d, %v", a, b, n, err)
+			}
+		})
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT 1 AS id, 2 AS id, 3`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+	rows.Next()
+	var n int
+	if err = scanABn(rows, nil, &B{}, &n); err == nil {
+		t.Error("nil destination: error expected")
+	}
+}
+
+func TestWithRowMetrics(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `SELECT 'abc', X'0102', 'de', 42, NULL UNION ALL SELECT NULL, NULL, NULL, 1, 'fghi'`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var (
+		gotRows  = -1
+		gotBytes int64
+	)
+	err = sqlfunc.ForEach(rows, func(s *string, b []byte, ns sql.NullString, n int, v interface{}) {},
+		sqlfunc.WithRowMetrics(func(rows int, bytes int64) {
+			gotRows, gotBytes = rows, bytes
+		}))
+	if err != nil {
+		t.Fatalf("ForEach: %v", err)
+	}
+	if gotRows != 2 || gotBytes != 3+2+2+4 {
+		t.Errorf("got %d rows, %d bytes", gotRows, gotBytes)
+	}
+}
+
+// slowRowSource is a [driver.Connector] whose queries return a row for each delay: the
+// value of the row is a large object that takes that delay to be read by [blob.Scan].
+type slowRowSource struct {
+	delays []time.Duration
+	closed chan struct{} // closed when the rows are closed
+}
+
+func (d *slowRowSource) Connect(context.Context) (driver.Conn, error) {
+	return slowRowSourceConn{d}, nil
+}
+func (d *slowRowSource) Driver() driver.Driver            { return d }
+func (d *slowRowSource) Open(string) (driver.Conn, error) { return slowRowSourceConn{d}, nil }
+
+type slowRowSourceConn struct{ d *slowRowSource }
+
+func (c slowRowSourceConn) Prepare(query string) (driver.Stmt, error) {
+	return slowRowSourceStmt(c), nil
+}
+func (slowRowSourceConn) Close() error              { return nil }
+func (slowRowSourceConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type slowRowSourceStmt struct{ d *slowRowSource }
+
+func (slowRowSourceStmt) Close() error  { return nil }
+func (slowRowSourceStmt) NumInput() int { return -1 }
+func (slowRowSourceStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s slowRowSourceStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &slowRowSourceRows{d: s.d}, nil
+}
+
+type slowRowSourceRows struct {
+	d *slowRowSource
+	n int
+}
+
+func (*slowRowSourceRows) Columns() []string { return []string{"data"} }
+
+func (r *slowRowSourceRows) Close() error {
+	close(r.d.closed)
+	return nil
+}
+
+func (r *slowRowSourceRows) Next(dest []driver.Value) error {
+	if r.n == len(r.d.delays) {
+		return io.EOF
+	}
+	dest[0] = &lob{data: []byte(strconv.Itoa(r.n)), delay: r.d.delays[r.n]}
+	r.n++
+	return nil
+}
+
+// lob is a large object streamed by the driver.
+type lob struct {
+	data  []byte
+	delay time.Duration
+}
+
+// blob is scanned from a lob.
+type blob []byte
+
+func (b *blob) Scan(src interface{}) error {
+	l, ok := src.(*lob)
+	if !ok {
+		return fmt.Errorf("unexpected %T", src)
+	}
+	time.Sleep(l.delay)
+	*b = append((*b)[:0], l.data...)
+	return nil
+}
+
+func TestWithRowTimeout(t *testing.T) {
+	ctx := context.Background()
+	d := &slowRowSource{
+		delays: []time.Duration{0, 0, 500 * time.Millisecond, 0},
+		closed: make(chan struct{}),
+	}
+	db := sql.OpenDB(d)
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `SELECT data`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var got []string
+	start := time.Now()
+	err = sqlfunc.ForEach(rows, func(b blob) {
+		got = append(got, string(b))
+	}, sqlfunc.WithRowTimeout(50*time.Millisecond))
+	if err != sqlfunc.ErrRowTimeout {
+		t.Errorf("got %v, expected %v", err, sqlfunc.ErrRowTimeout)
+	}
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Errorf("ForEach returned after %v: scan not interrupted", elapsed)
+	}
+	if !reflect.DeepEqual(got, []string{"0", "1"}) {
+		t.Errorf("got rows %q", got)
+	}
+
+	// rows are closed once the slow scan is over
+	select {
+	case <-d.closed:
+	case <-time.After(5 * time.Second):
+		t.Error("rows not closed")
+	}
+
+	// No timeout
+	d.delays = []time.Duration{0, 10 * time.Millisecond, 0}
+	d.closed = make(chan struct{})
+	rows, err = db.QueryContext(ctx, `SELECT data`)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	got = nil
+	err = sqlfunc.ForEach(rows, func(b blob) {
+		got = append(got, string(b))
+	}, sqlfunc.WithRowTimeout(time.Second))
+	if err != nil {
+		t.Errorf("ForEach: %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"0", "1", "2"}) {
+		t.Errorf("got rows %q", got)
+	}
 }
@@ -0,0 +1,75 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// PrepareScoped prepares query for the lifetime of ctx: the statement is closed once ctx is
+// done, so request-scoped statements don't need a deferred close. The func then returns
+// [ErrClosed].
+//
+// The kind of statement depends on the first result of the func: [*database/sql.Rows] for
+// [Query], [database/sql.Result] for [Exec], anything else for [QueryRow] (use
+// [database/sql.Result] to get the number of rows affected by a statement).
+//
+// ctx is also used for the preparation. The statement is closed by a goroutine that waits
+// for ctx to be done. The returned func close closes the statement earlier and stops the
+// goroutine: it must be called if ctx may never be done (such as [context.Background]).
+// Calling close more than once is safe.
+func PrepareScoped(ctx context.Context, db PrepareConn, query string, fnPtr interface{}, opts ...Option) (func() error, error) {
+	prepare := prepareQueryRow
+	if t := reflect.TypeOf(fnPtr); t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Func && t.Elem().NumOut() > 0 {
+		switch t.Elem().Out(0) {
+		case typeRows:
+			prepare = prepareQuery
+		case typeResult:
+			prepare = prepareExec
+		}
+	}
+
+	o := newOptions(opts)
+	o.closed = new(uint32)
+	closeStmt, err := prepare(ctx, db, query, fnPtr, o)
+	if err != nil {
+		return func() error { return nil }, err
+	}
+
+	done := make(chan struct{})
+	var once sync.Once
+	var closeErr error
+	closeScoped := func() error {
+		once.Do(func() {
+			atomic.StoreUint32(o.closed, 1)
+			closeErr = closeStmt()
+			close(done)
+		})
+		return closeErr
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = closeScoped()
+		case <-done:
+		}
+	}()
+	return closeScoped, nil
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func ExamplePrepareScoped() {
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		// The statement is closed once the request is done
+		var countPOI func(ctx context.Context) (int64, error)
+		if _, err := sqlfunc.PrepareScoped(ctx, db, `SELECT COUNT(*) FROM poi`, &countPOI); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		n, err := countPOI(ctx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "%d POIs\n", n)
+	})
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		fmt.Println("Get:", err)
+		return
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Print(string(body))
+
+	// Output:
+	// 2 POIs
+}
+
+func TestPrepareScoped(t *testing.T) {
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	var one func(ctx context.Context) (int, error)
+
+	// Closed when ctx is done
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err = sqlfunc.PrepareScoped(ctx, db, `SELECT 1`, &one); err != nil {
+		t.Fatalf("PrepareScoped: %v", err)
+	}
+	if n, err := one(context.Background()); err != nil || n != 1 {
+		t.Errorf("got %d, %v", n, err)
+	}
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err = one(context.Background())
+		if errors.Is(err, sqlfunc.ErrClosed) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %v after ctx is done, expected %v", err, sqlfunc.ErrClosed)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Closed manually
+	closeOne, err := sqlfunc.PrepareScoped(context.Background(), db, `SELECT 1`, &one)
+	if err != nil {
+		t.Fatalf("PrepareScoped: %v", err)
+	}
+	if err = closeOne(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+	if err = closeOne(); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+	if _, err = one(context.Background()); !errors.Is(err, sqlfunc.ErrClosed) {
+		t.Errorf("got %v, expected %v", err, sqlfunc.ErrClosed)
+	}
+
+	// Exec and Query statements
+	var exec func(ctx context.Context) (sql.Result, error)
+	var query func(ctx context.Context) (*sql.Rows, error)
+	closeExec, err := sqlfunc.PrepareScoped(context.Background(), db, `CREATE TABLE t (n INTEGER)`, &exec)
+	if err != nil {
+		t.Fatalf("PrepareScoped: %v", err)
+	}
+	defer closeExec()
+	if _, err = exec(context.Background()); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	closeQuery, err := sqlfunc.PrepareScoped(context.Background(), db, `SELECT 1 UNION ALL SELECT 2`, &query)
+	if err != nil {
+		t.Fatalf("PrepareScoped: %v", err)
+	}
+	defer closeQuery()
+	rows, err := query(context.Background())
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	var got []int
+	if err = sqlfunc.ForEach(rows, func(n int) { got = append(got, n) }); err != nil || fmt.Sprint(got) != "[1 2]" {
+		t.Errorf("got %v, %v", got, err)
+	}
+
+	// Preparation failure
+	const invalidQuery = `SELECT FROM`
+	if _, err = sqlfunc.PrepareScoped(context.Background(), failingConn{db, invalidQuery}, invalidQuery, &one); !errors.Is(err, errPrepare) {
+		t.Errorf("got %v, expected %v", err, errPrepare)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// SplitConn is a [PrepareConn] for read/write-split setups: it prepares read-only statements
+// on a replica and the other statements on the primary.
+//
+// As [PrepareConn] only gives the query text, the routing decision is made from the query
+// (see [IsReadOnlyQuery]) unless the context given for preparation has been marked with [ReadOnly].
+//
+// Statements prepared on the replica can't be localized to a transaction of the primary:
+// functions that take an [*sql.Tx] argument must be prepared on the primary (use [ReadOnly]
+// with false to force that).
+type SplitConn struct {
+	Primary PrepareConn
+	Replica PrepareConn
+
+	// IsReadOnly classifies queries. If nil, IsReadOnlyQuery is used.
+	IsReadOnly func(query string) bool
+}
+
+var _ PrepareConn = (*SplitConn)(nil)
+
+// PrepareContext implements [PrepareConn].
+func (c *SplitConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	readOnly, forced := ctx.Value(readOnlyKey{}).(bool)
+	if !forced {
+		if c.IsReadOnly != nil {
+			readOnly = c.IsReadOnly(query)
+		} else {
+			readOnly = IsReadOnlyQuery(query)
+		}
+	}
+	if readOnly {
+		return c.Replica.PrepareContext(ctx, query)
+	}
+	return c.Primary.PrepareContext(ctx, query)
+}
+
+type readOnlyKey struct{}
+
+// ReadOnly returns a context that forces the routing of statements prepared by [SplitConn]:
+// on the replica if readOnly is true, on the primary otherwise.
+func ReadOnly(ctx context.Context, readOnly bool) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, readOnly)
+}
+
+// IsReadOnlyQuery is the heuristic used by [SplitConn] to classify queries: a query is
+// read-only if its first keyword (after comments and opening parentheses) is SELECT and it
+// doesn't contain a locking clause (FOR UPDATE, FOR NO KEY UPDATE, FOR SHARE, FOR KEY SHARE)
+// or INTO (locking reads and SELECT INTO must run on the primary).
+//
+// Queries starting with WITH are not considered read-only as common table expressions may
+// embed writes.
+func IsReadOnlyQuery(query string) bool {
+	q := query
+	for {
+		q = strings.TrimLeft(q, " \t\r\n(")
+		switch {
+		case strings.HasPrefix(q, "--"):
+			end := strings.IndexByte(q, '\n')
+			if end < 0 {
+				return false
+			}
+			q = q[end+1:]
+			continue
+		case strings.HasPrefix(q, "/*"):
+			end := strings.Index(q, "*/")
+			if end < 0 {
+				return false
+			}
+			q = q[end+2:]
+			continue
+		}
+		break
+	}
+	if len(q) < 6 || !strings.EqualFold(q[:6], "SELECT") || (len(q) > 6 && isNameChar(q[6])) {
+		return false
+	}
+	words := strings.Fields(strings.ToUpper(q))
+	for i, w := range words {
+		switch w {
+		case "INTO":
+			return false
+		case "FOR":
+			// FOR UPDATE, FOR NO KEY UPDATE, FOR SHARE, FOR KEY SHARE
+			j := i + 1
+			for j < len(words) && (words[j] == "NO" || words[j] == "KEY") {
+				j++
+			}
+			if j < len(words) && (words[j] == "UPDATE" || words[j] == "SHARE") {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func TestIsReadOnlyQuery(t *testing.T) {
+	for query, readOnly := range map[string]bool{
+		`SELECT 1`:                                true,
+		`select name from poi`:                    true,
+		`  (SELECT 1) UNION (SELECT 2)`:           true,
+		"-- comment\nSELECT 1":                    true,
+		`/* comment */ SELECT 1`:                  true,
+		`SELECT * FROM poi FOR UPDATE`:            false,
+		`SELECT * FROM poi FOR NO KEY UPDATE`:     false,
+		`SELECT * FROM poi FOR KEY SHARE NOWAIT`:  false,
+		`SELECT * FROM poi for share`:             false,
+		`SELECT * INTO poi2 FROM poi`:             false,
+		`SELECTED`:                                false,
+		`INSERT INTO poi VALUES (1, 2, 'a')`:      false,
+		`UPDATE poi SET name = 'b'`:               false,
+		`WITH x AS (SELECT 1) SELECT * FROM x`:    false,
+		`/* unterminated SELECT 1`:                false,
+		"-- SELECT 1":                             false,
+		`DELETE FROM poi WHERE name = 'SELECT 1'`: false,
+	} {
+		if got := sqlfunc.IsReadOnlyQuery(query); got != readOnly {
+			t.Errorf("%q: got %v, expected %v", query, got, readOnly)
+		}
+	}
+}
+
+func ExampleSplitConn() {
+	check := func(msg string, err error) {
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", msg, err))
+		}
+	}
+
+	ctx := context.Background()
+
+	open := func(name string) *sql.DB {
+		db, err := sql.Open(sqliteDriver, ":memory:")
+		check("Open", err)
+		db.SetMaxOpenConns(1)
+		_, err = db.ExecContext(ctx, `CREATE TABLE server (name VARCHAR(20))`)
+		check("Create table", err)
+		_, err = db.ExecContext(ctx, `INSERT INTO server (name) VALUES (?)`, name)
+		check("Insert", err)
+		return db
+	}
+	primary := open("primary")
+	defer primary.Close()
+	replica := open("replica")
+	defer replica.Close()
+
+	conn := &sqlfunc.SplitConn{Primary: primary, Replica: replica}
+
+	var serverName func(ctx context.Context) (string, error)
+	closeServerName, err := sqlfunc.QueryRow(ctx, conn, `SELECT name FROM server`, &serverName)
+	check("Prepare serverName", err)
+	defer closeServerName()
+
+	var rename func(ctx context.Context, name string) (sql.Result, error)
+	closeRename, err := sqlfunc.Exec(ctx, conn, `UPDATE server SET name = name || ?`, &rename)
+	check("Prepare rename", err)
+	defer closeRename()
+
+	var primaryName func(ctx context.Context) (string, error)
+	closePrimaryName, err := sqlfunc.QueryRow(sqlfunc.ReadOnly(ctx, false), conn, `SELECT name FROM server`, &primaryName)
+	check("Prepare primaryName", err)
+	defer closePrimaryName()
+
+	_, err = rename(ctx, " (updated)")
+	check("rename", err)
+
+	name, err := serverName(ctx)
+	check("serverName", err)
+	fmt.Println(name)
+
+	name, err = primaryName(ctx)
+	check("primaryName", err)
+	fmt.Println(name)
+
+	// Output:
+	// replica
+	// primary (updated)
+}
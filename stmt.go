@@ -19,23 +19,68 @@ package sqlfunc
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
 	"reflect"
+	"sync"
+	"sync/atomic"
 )
 
 var _ *sql.DB // Fake var just to have database/sql imported for go doc
 
+// Prepare prepares an SQL statement without binding it to a function: this validates the query
+// (syntax, tables and columns, as far as the server checks them at preparation) independently
+// of the signature of the functions later created by [Exec], [QueryRow] or [Query].
+// Some drivers (such as modernc.org/sqlite) defer the checks to the first execution.
+//
+// The returned func 'close' must be called once the statement is not needed anymore.
+//
+// Example:
+//
+//	for _, query := range queries {
+//		close, err := sqlfunc.Prepare(ctx, db, query)
+//		if err != nil {
+//			log.Fatalf("%q: %v", query, err)
+//		}
+//		close()
+//	}
+func Prepare(ctx context.Context, db PrepareConn, query string) (close func() error, err error) {
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return func() error { return nil }, err
+	}
+	return stmt.Close, nil
+}
+
 // Exec prepares an SQL statement and creates a function wrapping [sql.Stmt.ExecContext].
 //
 // fnPtr is a pointer to a func variable. The function signature tells how it will be called.
 //
 // The first argument is a [context.Context].
-// If a [*sql.Tx] is given as the second argument, the statement will be localized to the transaction (using [sql.Tx.StmtContext]).
+// If a [*sql.Tx] (or any [StmtLocalizer], such as a wrapper of *sql.Tx) is given as the second argument, the statement will be localized to the transaction (using [sql.Tx.StmtContext]).
 // The following arguments will be given as arguments to [sql.Stmt.ExecContext].
+// Arguments of a struct type embedding [Args] are expanded as one argument per exported field.
+// Instead, a single argument of a map type with string keys (such as map[string]interface{})
+// gives the values of the named placeholders of the query (":name" or "@name"), which must be
+// the only placeholders: the values are given to the driver as [sql.NamedArg] (the driver must
+// support named parameters, as SQLite and SQL Server drivers do). A missing key is reported as
+// an error when the function is called.
 //
-// The function will return an [sql.Result] and an error.
+// The function will return an [sql.Result] and an error. If the function returns an integer
+// type (such as int64) instead of an [sql.Result], it returns the number of rows affected
+// (see [sql.Result.RowsAffected]). If the function returns a string type, it returns the
+// command tag of the result (see [CommandTag]), or [ErrNoCommandTag] if the result provides none.
+// This needs a db (with [WithoutPrepare]) or a [Middleware] that returns its own [sql.Result]
+// with a CommandTag method: [database/sql] ([*sql.DB], [*sql.Conn], [*sql.Tx], [*sql.Stmt])
+// always hides the result of the driver, so through them the function always returns
+// [ErrNoCommandTag].
 //
 // The returned func 'close' must be called once the statement is not needed anymore.
 //
+// If the number of placeholders in the query can be determined and doesn't match the number
+// of arguments of the function, Exec panics.
+//
 // Example:
 //
 //	var f func(ctx context.Context, arg1 int64, arg2 string, arg3 sql.NullInt, arg4 *sql.Time) (sql.Result, error)
@@ -57,7 +102,11 @@ var _ *sql.DB // Fake var just to have database/sql imported for go doc
 //	// if err != nil ...
 //	err = tx.Commit()
 //	// if err != nil ...
-func Exec(ctx context.Context, db PrepareConn, query string, fnPtr interface{}) (close func() error, err error) {
+func Exec(ctx context.Context, db PrepareConn, query string, fnPtr interface{}, opts ...Option) (close func() error, err error) {
+	return prepareExec(ctx, db, query, fnPtr, newOptions(opts))
+}
+
+func prepareExec(ctx context.Context, db PrepareConn, query string, fnPtr interface{}, o *options) (close func() error, err error) {
 	vPtr := reflect.ValueOf(fnPtr)
 	if vPtr.Type().Kind() != reflect.Ptr {
 		panic("fnPtr must be a *pointer* to a func variable")
@@ -69,47 +118,81 @@ func Exec(ctx context.Context, db PrepareConn, query string, fnPtr interface{})
 	if fnType.Kind() != reflect.Func {
 		panic("fnPtr must be a pointer to a *func* variable")
 	}
-	numIn := fnType.NumIn()
-	if numIn < 1 || fnType.In(0) != typeContext {
+	if fnType.NumIn() < 1 || fnType.In(0) != typeContext {
 		panic("func first arg must be a context.Context")
 	}
 	// Optional *sql.Tx as In(1) (if db is not already a *sql.Tx)
-	withTx := false
+	withTx := hasTxArg(fnType) && !o.noTxArg
 	var firstArg = 1
-	if numIn > 1 && fnType.In(1).Implements(typeTxStmt) {
-		withTx = true
+	if withTx {
 		firstArg = 2
 	}
-	if fnType.NumOut() != 2 || fnType.Out(0) != typeResult || fnType.Out(1) != typeError {
-		panic("func must return (sql.Result, error)")
+	if fnType.NumOut() != 2 || fnType.Out(1) != typeError {
+		panic("func must return (sql.Result, error), (int64, error) or (string, error)")
+	}
+	// An integer result is the number of rows affected
+	affected := isIntKind(fnType.Out(0).Kind())
+	// A string result is the command tag
+	commandTag := fnType.Out(0).Kind() == reflect.String
+	if !affected && !commandTag && fnType.Out(0) != typeResult {
+		panic("func must return (sql.Result, error), (int64, error) or (string, error)")
 	}
+	query = o.withLimits(query)
+	binder := newArgsBinder(inTypes(fnType, firstArg))
+	binder.check = o.argsCheck
+	binder.checkPlaceholders(query, fnType, o.dollarPlaceholders(db))
+	o.setStmtInfo(query, fnType, firstArg, nil)
 
-	stmt, err := db.PrepareContext(ctx, query)
+	target, err := prepareTarget(ctx, db, query, fnType, withTx, o)
 	if err != nil {
 		return func() error { return nil }, err
 	}
 
 	fn := func(in []reflect.Value) []reflect.Value {
-		ctx := in[0].Interface().(context.Context)
-		stmtTx := stmt
+		if o.isClosed() {
+			return errorResults(fnType, ErrClosed)
+		}
+		ctx, cancel := o.withDefaultTimeout(in[0].Interface().(context.Context))
+		defer cancel()
+		t := target
 		if withTx && !in[1].IsNil() {
-			stmtTx = in[1].Interface().(txStmt).StmtContext(ctx, stmt)
-			defer stmtTx.Close()
-		}
-		var args []interface{}
-		if len(in) > firstArg {
-			args = make([]interface{}, len(in)-firstArg)
-			for i, a := range in[firstArg:] {
-				args[i] = a.Interface()
+			var release func() error
+			t, release = target.inTx(ctx, in[1].Interface())
+			defer release()
+		}
+		args, err := binder.bind(in[firstArg:])
+		if err != nil {
+			return errorResults(fnType, o.queryError(query, err))
+		}
+		r, err := o.exec(ctx, t, args)
+		if affected && err == nil {
+			var n int64
+			if n, err = r.RowsAffected(); err == nil {
+				return []reflect.Value{reflect.ValueOf(n).Convert(fnType.Out(0)), reflect.Zero(typeError)}
 			}
 		}
-		r, err := stmtTx.ExecContext(ctx, args...)
+		if commandTag && err == nil {
+			if tag, ok := CommandTag(r); ok {
+				return []reflect.Value{reflect.ValueOf(tag).Convert(fnType.Out(0)), reflect.Zero(typeError)}
+			}
+			err = ErrNoCommandTag
+		}
+		err = o.queryError(query, err)
+		if affected || commandTag {
+			return errorResults(fnType, err)
+		}
 		return []reflect.Value{reflect.ValueOf(&r).Elem(), reflect.ValueOf(&err).Elem()}
 	}
 
 	vPtr.Elem().Set(reflect.MakeFunc(fnType, fn))
 
-	return stmt.Close, nil
+	return target.close, nil
+}
+
+// hasTxArg reports whether the second argument of fnType is a transaction that
+// localizes the statement.
+func hasTxArg(fnType reflect.Type) bool {
+	return fnType.NumIn() > 1 && fnType.In(1).Implements(typeStmtLocalizer)
 }
 
 // QueryRow prepares an SQL statement and creates a function wrapping [sql.Stmt.QueryRowContext] and [sql.Row.Scan].
@@ -117,13 +200,43 @@ func Exec(ctx context.Context, db PrepareConn, query string, fnPtr interface{})
 // fnPtr is a pointer to a func variable. The function signature tells how it will be called.
 //
 // The first argument is a [context.Context].
-// If a [*sql.Tx] is given as the second argument, the statement will be localized to the transaction (using [sql.Tx.StmtContext]).
+// If a [*sql.Tx] (or any [StmtLocalizer], such as a wrapper of *sql.Tx) is given as the second argument, the statement will be localized to the transaction (using [sql.Tx.StmtContext]).
 // The following arguments will be given as arguments to [sql.Stmt.QueryRowContext].
+// Arguments of a struct type embedding [Args] are expanded as one argument per exported field.
+// A single argument of a map type with string keys gives the values of named placeholders (see [Exec]).
 //
 // The function will return values scanned from the [sql.Row] and an error.
+// QueryRow is strictly for queries returning a single row: as with [sql.Row], only the first row
+// is scanned and the other rows are silently ignored. Use [Query] (or [QueryValues] for a single
+// column, [Select] for structs) to get all the rows.
+//
+// Results of type interface{} receive a value of the type reported by the driver for the column
+// (see [sql.ColumnType.ScanType]), or nil for NULL, instead of the raw value given by the driver.
+// To get the column types, such functions run the query with [sql.Stmt.QueryContext] instead
+// of [sql.Stmt.QueryRowContext]: only the first row is scanned and the rows are closed before
+// returning, and [sql.ErrNoRows] is returned if there is no row, as with [sql.Row.Scan].
+//
+// Alternatively, the function may take, after the context and the optional transaction, a
+// pointer to a struct destination and return (found bool, err error):
+//
+//	var getPOI func(ctx context.Context, dest *POI, name string) (found bool, err error)
+//
+// The row is scanned into *dest by column name (see [ScanPtr] for the rules; fields without a
+// matching column are left unchanged). found is false if the query returns no rows, and err
+// reports the other errors. As the column names are needed, the query is run with
+// [sql.Stmt.QueryContext]: the middlewares see the [*sql.Rows], as for [Query].
+// The options [WithAllowedColumns], [WithColumnMapping], [WithColumnTypesCheck] and
+// [WithExpectedColumns] are supported for this form.
 //
 // The returned func 'close' must be called once the statement is not needed anymore.
-func QueryRow(ctx context.Context, db PrepareConn, query string, fnPtr interface{}) (close func() error, err error) {
+//
+// If the number of placeholders in the query can be determined and doesn't match the number
+// of arguments of the function, QueryRow panics.
+func QueryRow(ctx context.Context, db PrepareConn, query string, fnPtr interface{}, opts ...Option) (close func() error, err error) {
+	return prepareQueryRow(ctx, db, query, fnPtr, newOptions(opts))
+}
+
+func prepareQueryRow(ctx context.Context, db PrepareConn, query string, fnPtr interface{}, o *options) (close func() error, err error) {
 	vPtr := reflect.ValueOf(fnPtr)
 	if vPtr.Type().Kind() != reflect.Ptr {
 		panic("fnPtr must be a *pointer* to a func variable")
@@ -135,17 +248,18 @@ func QueryRow(ctx context.Context, db PrepareConn, query string, fnPtr interface
 	if fnType.Kind() != reflect.Func {
 		panic("fnPtr must be a pointer to a *func* variable")
 	}
-	numIn := fnType.NumIn()
-	if numIn < 1 || fnType.In(0) != typeContext {
+	if fnType.NumIn() < 1 || fnType.In(0) != typeContext {
 		panic("func first arg must be a context.Context")
 	}
 	// Optional *sql.Tx as In(1) (if db is not already a *sql.Tx)
-	withTx := false
+	withTx := hasTxArg(fnType) && !o.noTxArg
 	var firstArg = 1
-	if numIn > 1 && fnType.In(1).Implements(typeTxStmt) {
-		withTx = true
+	if withTx {
 		firstArg = 2
 	}
+	if isQueryRowInto(fnType, firstArg) {
+		return prepareQueryRowInto(ctx, db, query, vPtr, withTx, firstArg, o)
+	}
 	numOut := fnType.NumOut()
 	if numOut < 2 {
 		panic("func must return at least one column")
@@ -153,42 +267,232 @@ func QueryRow(ctx context.Context, db PrepareConn, query string, fnPtr interface
 	if fnType.Out(numOut-1) != typeError {
 		panic("func must return an error")
 	}
+	query = o.withLimits(query)
+	binder := newArgsBinder(inTypes(fnType, firstArg))
+	binder.check = o.argsCheck
+	binder.checkPlaceholders(query, fnType, o.dollarPlaceholders(db))
+	o.setStmtInfo(query, fnType, firstArg, outTypes(fnType, numOut-1))
 
-	stmt, err := db.PrepareContext(ctx, query)
+	// Results of type interface{} are scanned using the column types
+	var anyCols []int
+	for i := 0; i < numOut-1; i++ {
+		if fnType.Out(i) == typeAny {
+			anyCols = append(anyCols, i)
+		}
+	}
+
+	target, err := prepareTarget(ctx, db, query, fnType, withTx, o)
 	if err != nil {
 		return func() error { return nil }, err
 	}
+	target.prepareExplain(ctx, db, o)
+	plan := newScanPlan(outTypes(fnType, numOut-1), numOut-1)
+	cc := o.newColumnsCheck()
 
 	fn := func(in []reflect.Value) []reflect.Value {
-		ctx := in[0].Interface().(context.Context)
-		stmtTx := stmt
+		if o.isClosed() {
+			return errorResults(fnType, ErrClosed)
+		}
+		ctx, cancel := o.withDefaultTimeout(in[0].Interface().(context.Context))
+		defer cancel()
+		t := target
 		if withTx && !in[1].IsNil() {
-			stmtTx = in[1].Interface().(txStmt).StmtContext(ctx, stmt)
-			defer stmtTx.Close()
-		}
-		var args []interface{}
-		if len(in) > firstArg {
-			args = make([]interface{}, len(in)-firstArg)
-			for i, a := range in[firstArg:] {
-				args[i] = a.Interface()
-			}
+			var release func() error
+			t, release = target.inTx(ctx, in[1].Interface())
+			defer release()
 		}
-		out := make([]interface{}, numOut-1)
-		outValues := make([]reflect.Value, numOut)
-		for i := 0; i < numOut-1; i++ {
-			ptr := reflect.New(fnType.Out(i))
-			out[i] = ptr.Interface()
-			outValues[i] = ptr.Elem()
+		args, err := binder.bind(in[firstArg:])
+		if err != nil {
+			return errorResults(fnType, o.queryError(query, err))
 		}
+		outValues := make([]reflect.Value, numOut)
+		scanners := plan.scanners()
+		plan.dest(o, *scanners, outValues)
 
-		err := stmtTx.QueryRowContext(ctx, args...).Scan(out...)
+		err = o.queryError(query, o.queryRowScan(ctx, t, args, *scanners, outValues[:numOut-1], anyCols, cc))
+		plan.release(scanners)
 		outValues[numOut-1] = reflect.ValueOf(&err).Elem()
 		return outValues
 	}
 
 	vPtr.Elem().Set(reflect.MakeFunc(fnType, fn))
 
-	return stmt.Close, nil
+	return target.close, nil
+}
+
+// isQueryRowInto reports whether fnType has the form func(ctx, [tx,] dest *T, args...) (bool, error)
+// where T is a struct scanned by column name.
+func isQueryRowInto(fnType reflect.Type, firstArg int) bool {
+	if fnType.NumOut() != 2 || fnType.Out(0) != typeBool || fnType.Out(1) != typeError || fnType.NumIn() <= firstArg {
+		return false
+	}
+	dest := fnType.In(firstArg)
+	return dest.Kind() == reflect.Ptr && isStructDest(dest.Elem())
+}
+
+// prepareQueryRowInto implements [QueryRow] for functions that scan the row into a struct
+// given as argument and return (found bool, err error).
+func prepareQueryRowInto(ctx context.Context, db PrepareConn, query string, vPtr reflect.Value, withTx bool, firstArg int, o *options) (close func() error, err error) {
+	fnType := vPtr.Type().Elem()
+	query = o.withLimits(query)
+	binder := newArgsBinder(inTypes(fnType, firstArg+1))
+	binder.check = o.argsCheck
+	binder.checkPlaceholders(query, fnType, o.dollarPlaceholders(db))
+	o.setStmtInfo(query, fnType, firstArg+1, nil)
+
+	target, err := prepareTarget(ctx, db, query, fnType, withTx, o)
+	if err != nil {
+		return func() error { return nil }, err
+	}
+	target.prepareExplain(ctx, db, o)
+
+	fn := func(in []reflect.Value) []reflect.Value {
+		if o.isClosed() {
+			return errorResults(fnType, ErrClosed)
+		}
+		dest := in[firstArg]
+		if dest.IsNil() {
+			return errorResults(fnType, fmt.Errorf("sqlfunc: nil %v destination", dest.Type()))
+		}
+		ctx, cancel := o.withDefaultTimeout(in[0].Interface().(context.Context))
+		defer cancel()
+		t := target
+		if withTx && !in[1].IsNil() {
+			var release func() error
+			t, release = target.inTx(ctx, in[1].Interface())
+			defer release()
+		}
+		args, err := binder.bind(in[firstArg+1:])
+		if err != nil {
+			return errorResults(fnType, o.queryError(query, err))
+		}
+		found, err := o.scanRowInto(ctx, t, args, dest)
+		err = o.queryError(query, err)
+		return []reflect.Value{reflect.ValueOf(found), reflect.ValueOf(&err).Elem()}
+	}
+
+	vPtr.Elem().Set(reflect.MakeFunc(fnType, fn))
+
+	return target.close, nil
+}
+
+// scanRowInto runs the query of t and scans the first row into the struct pointed by dest.
+// found is false if there is no row.
+func (o *options) scanRowInto(ctx context.Context, t *stmtTarget, args []interface{}, dest reflect.Value) (found bool, err error) {
+	rows, err := o.queryRows(ctx, t, args)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if e := rows.Close(); err == nil && e != nil {
+			found, err = false, e
+		}
+	}()
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	paths, err := structPlan(rows, dest.Type().Elem(), o)
+	if err != nil {
+		return false, err
+	}
+	if err = rows.Scan(o.structScanners(dest.Elem(), paths)...); err != nil {
+		return false, err
+	}
+	if s, ok := dest.Interface().(AfterScanner); ok {
+		if err = s.AfterScan(); err != nil {
+			return false, err // user error: don't wrap
+		}
+	}
+	return true, nil
+}
+
+// QueryRowLazy prepares an SQL statement and creates a function wrapping [sql.Stmt.QueryRowContext]
+// that leaves the scanning of the row to the caller.
+//
+// fnPtr is a pointer to a func variable. The function signature tells how it will be called.
+// The arguments are the same as for [QueryRow]. The function returns the [sql.Row.Scan] method
+// of the fetched row, to be called with destinations chosen at runtime, and an error:
+//
+//	var getPOI func(ctx context.Context, id int64) (scan func(dest ...interface{}) error, err error)
+//
+// The row holds a connection (and the transaction-localized statement, if any) until scan is
+// called: scan must be called exactly once, even if the values are not needed.
+// Errors from the query itself are reported by scan, as with [sql.Row].
+//
+// The returned func 'close' must be called once the statement is not needed anymore.
+//
+// If the number of placeholders in the query can be determined and doesn't match the number
+// of arguments of the function, QueryRowLazy panics.
+func QueryRowLazy(ctx context.Context, db PrepareConn, query string, fnPtr interface{}, opts ...Option) (close func() error, err error) {
+	o := newOptions(opts)
+	vPtr := reflect.ValueOf(fnPtr)
+	if vPtr.Type().Kind() != reflect.Ptr {
+		panic("fnPtr must be a *pointer* to a func variable")
+	}
+	if vPtr.IsNil() {
+		panic("fnPtr must be non-nil")
+	}
+	fnType := reflect.TypeOf(fnPtr).Elem()
+	if fnType.Kind() != reflect.Func {
+		panic("fnPtr must be a pointer to a *func* variable")
+	}
+	if fnType.NumIn() < 1 || fnType.In(0) != typeContext {
+		panic("func first arg must be a context.Context")
+	}
+	// Optional *sql.Tx as In(1) (if db is not already a *sql.Tx)
+	withTx := hasTxArg(fnType) && !o.noTxArg
+	var firstArg = 1
+	if withTx {
+		firstArg = 2
+	}
+	if fnType.NumOut() != 2 || fnType.Out(0) != typeScanFunc || fnType.Out(1) != typeError {
+		panic("func must return (func(...interface{}) error, error)")
+	}
+	query = o.withLimits(query)
+	binder := newArgsBinder(inTypes(fnType, firstArg))
+	binder.check = o.argsCheck
+	binder.checkPlaceholders(query, fnType, o.dollarPlaceholders(db))
+	o.setStmtInfo(query, fnType, firstArg, nil)
+
+	target, err := prepareTarget(ctx, db, query, fnType, withTx, o)
+	if err != nil {
+		return func() error { return nil }, err
+	}
+
+	fn := func(in []reflect.Value) []reflect.Value {
+		if o.isClosed() {
+			return errorResults(fnType, ErrClosed)
+		}
+		ctx, cancel := o.withDefaultTimeout(in[0].Interface().(context.Context))
+		t := target
+		release := func() error { return nil }
+		if withTx && !in[1].IsNil() {
+			t, release = target.inTx(ctx, in[1].Interface())
+		}
+		args, err := binder.bind(in[firstArg:])
+		if err != nil {
+			release()
+			cancel()
+			return errorResults(fnType, o.queryError(query, err))
+		}
+		row := t.queryRow(ctx, args)
+		scan := func(dest ...interface{}) error {
+			defer cancel()
+			defer release()
+			scanners := make([]interface{}, len(dest))
+			for i, d := range dest {
+				if d != nil {
+					scanners[i] = o.scanner(reflect.ValueOf(d))
+				}
+			}
+			return o.queryError(query, row.Scan(scanners...))
+		}
+		return []reflect.Value{reflect.ValueOf(scan), reflect.Zero(typeError)}
+	}
+
+	vPtr.Elem().Set(reflect.MakeFunc(fnType, fn))
+
+	return target.close, nil
 }
 
 // Query prepares an SQL statement and creates a function wrapping [sql.Stmt.QueryContext].
@@ -198,11 +502,42 @@ func QueryRow(ctx context.Context, db PrepareConn, query string, fnPtr interface
 // The first argument is a [context.Context].
 // If an [*sql.Tx] is given as the second argument, the statement will be localized to the transaction (using [sql.Tx.StmtContext]).
 // The following arguments will be given as arguments to [sql.Stmt.QueryRowContext].
+// Arguments of a struct type embedding [Args] are expanded as one argument per exported field.
+// A single argument of a map type with string keys gives the values of named placeholders (see [Exec]).
 //
 // The function will return an [*sql.Rows] and an error.
 //
+// The function may also return a stop func between the [*sql.Rows] and the error:
+//
+//	var query func(ctx context.Context, arg1 int64) (rows *sql.Rows, stop func(), err error)
+//
+// stop cancels the context of the query (derived from the context given to the function),
+// without affecting the parent context. The cancellation is asynchronous: the iteration of the
+// rows doesn't stop immediately but ends, at some later row, with [context.Canceled]
+// (reported by [sql.Rows.Err]).
+// Like the cancel func of [context.WithCancel], stop must be called once the rows are not
+// needed anymore, even if the iteration completed, to release the resources of the context.
+// It is safe to call stop multiple times, before or after closing rows.
+// If the function fails, stop is nil (the context is already released).
+// Only this form applies [WithDefaultTimeout], as stop also releases the timeout.
+//
+// The function may instead return the names of the columns between the [*sql.Rows] and the
+// error, for layers that render rows generically (a header, then the rows):
+//
+//	var query func(ctx context.Context, arg1 int64) (rows *sql.Rows, columns []string, err error)
+//
+// The names are those of [sql.Rows.Columns]. If they can't be fetched, the rows are closed
+// and the error is returned.
+//
 // The returned func 'close' must be called once the statement is not needed anymore.
-func Query(ctx context.Context, db PrepareConn, query string, fnPtr interface{}) (close func() error, err error) {
+//
+// If the number of placeholders in the query can be determined and doesn't match the number
+// of arguments of the function, Query panics.
+func Query(ctx context.Context, db PrepareConn, query string, fnPtr interface{}, opts ...Option) (close func() error, err error) {
+	return prepareQuery(ctx, db, query, fnPtr, newOptions(opts))
+}
+
+func prepareQuery(ctx context.Context, db PrepareConn, query string, fnPtr interface{}, o *options) (close func() error, err error) {
 	vPtr := reflect.ValueOf(fnPtr)
 	if vPtr.Type().Kind() != reflect.Ptr {
 		panic("fnPtr must be a *pointer* to a func variable")
@@ -217,29 +552,381 @@ func Query(ctx context.Context, db PrepareConn, query string, fnPtr interface{})
 	if fnType.NumIn() < 1 || fnType.In(0) != typeContext {
 		panic("func first arg must be a context.Context")
 	}
-	if fnType.NumOut() != 2 || fnType.Out(0) != typeRows || fnType.Out(1) != typeError {
-		panic("func must return (*sql.Rows, error)")
+	numOut := fnType.NumOut()
+	if (numOut != 2 && numOut != 3) || fnType.Out(0) != typeRows || fnType.Out(numOut-1) != typeError ||
+		(numOut == 3 && fnType.Out(1) != typeStopFunc && fnType.Out(1) != typeStrings) {
+		panic("func must return (*sql.Rows, error), (*sql.Rows, func(), error) or (*sql.Rows, []string, error)")
 	}
+	withStop := numOut == 3 && fnType.Out(1) == typeStopFunc
+	withColumns := numOut == 3 && fnType.Out(1) == typeStrings
+	query = o.withLimits(query)
+	binder := newArgsBinder(inTypes(fnType, 1))
+	binder.check = o.argsCheck
+	binder.checkPlaceholders(query, fnType, o.dollarPlaceholders(db))
+	o.setStmtInfo(query, fnType, 1, nil)
 
-	stmt, err := db.PrepareContext(ctx, query)
+	target, err := prepareTarget(ctx, db, query, fnType, false, o)
 	if err != nil {
 		return func() error { return nil }, err
 	}
+	target.prepareExplain(ctx, db, o)
+
+	cc := o.newColumnsCheck()
+
+	// queryRows runs the query and checks the columns.
+	queryRows := func(ctx context.Context, args []interface{}) (*sql.Rows, error) {
+		rows, err := o.queryRows(ctx, target, args)
+		if err == nil && cc.pending() {
+			if err = cc.check(rows); err != nil {
+				rows.Close()
+				rows = nil
+			}
+		}
+		return rows, err
+	}
 
 	fn := func(in []reflect.Value) []reflect.Value {
+		if o.isClosed() {
+			return errorResults(fnType, ErrClosed)
+		}
+		args, err := binder.bind(in[1:])
+		if err != nil {
+			return errorResults(fnType, o.queryError(query, err))
+		}
 		ctx := in[0].Interface().(context.Context)
-		var args []interface{}
-		if len(in) > 1 {
-			args = make([]interface{}, len(in)-1)
-			for i, a := range in[1:] {
-				args[i] = a.Interface()
+		if withColumns {
+			rows, err := queryRows(ctx, args)
+			if err != nil {
+				return errorResults(fnType, o.queryError(query, err))
+			}
+			columns, err := rows.Columns()
+			if err != nil {
+				rows.Close()
+				return errorResults(fnType, o.queryError(query, err))
 			}
+			return []reflect.Value{reflect.ValueOf(rows), reflect.ValueOf(columns), reflect.Zero(typeError)}
+		}
+		if !withStop {
+			rows, err := queryRows(ctx, args)
+			err = o.queryError(query, err)
+			return []reflect.Value{reflect.ValueOf(&rows).Elem(), reflect.ValueOf(&err).Elem()}
+		}
+		// The context must stay alive while rows are iterated: the default timeout
+		// is released by stop.
+		ctx, cancel := o.withDefaultTimeout(ctx)
+		ctx, cancelStop := context.WithCancel(ctx)
+		stop := func() {
+			cancelStop()
+			cancel()
 		}
-		rows, err := stmt.QueryContext(ctx, args...)
-		return []reflect.Value{reflect.ValueOf(&rows).Elem(), reflect.ValueOf(&err).Elem()}
+		rows, err := queryRows(ctx, args)
+		if err != nil {
+			stop()
+			return errorResults(fnType, o.queryError(query, err))
+		}
+		return []reflect.Value{reflect.ValueOf(rows), reflect.ValueOf((func())(stop)), reflect.Zero(typeError)}
 	}
 
 	vPtr.Elem().Set(reflect.MakeFunc(fnType, fn))
 
-	return stmt.Close, nil
+	return target.close, nil
+}
+
+// Columns returns the names of the columns of rows (see [sql.Rows.Columns]), for example
+// rows returned by a function created by [Query], before iterating them.
+func Columns(rows *sql.Rows) ([]string, error) {
+	return rows.Columns()
+}
+
+// ColumnTypes returns the types of the columns of rows (see [sql.Rows.ColumnTypes]), for
+// example rows returned by a function created by [Query], before iterating them.
+func ColumnTypes(rows *sql.Rows) ([]*sql.ColumnType, error) {
+	return rows.ColumnTypes()
+}
+
+// directConn is the subset of [*database/sql.DB], [*database/sql.Conn] and [*database/sql.Tx]
+// used to run queries without preparing statements (see [WithoutPrepare]).
+type directConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+var typeDirectConn = reflect.TypeOf([]directConn(nil)).Elem()
+
+// stmtTarget is what the functions created by [Exec], [QueryRow] and [Query] run:
+// a prepared statement or, with [WithoutPrepare], the query on the connection.
+type stmtTarget struct {
+	stmt  *sql.Stmt
+	conn  directConn
+	query string
+
+	// db is set with WithAutoReprepare to prepare the statement again on a bad connection.
+	// mu then protects stmt.
+	db PrepareConn
+	mu sync.RWMutex
+
+	// explain runs the query giving the plan of query (see WithExplain).
+	explain *stmtTarget
+
+	// pool holds the copies of the statement (see WithStmtPool) used in turn, next being
+	// the counter of calls. Each copy is reprepared on its own.
+	pool []*stmtTarget
+	next uint32
+}
+
+// prepareTarget prepares the statement for query, unless disabled by [WithoutPrepare].
+// withTx tells if the In(1) argument of fnType is a transaction.
+func prepareTarget(ctx context.Context, db PrepareConn, query string, fnType reflect.Type, withTx bool, o *options) (*stmtTarget, error) {
+	if o.withoutPrepare {
+		conn, ok := db.(directConn)
+		if !ok {
+			panic("WithoutPrepare: db must implement ExecContext, QueryContext and QueryRowContext")
+		}
+		if withTx && !fnType.In(1).Implements(typeDirectConn) {
+			panic("WithoutPrepare: func second arg must implement ExecContext, QueryContext and QueryRowContext")
+		}
+		return &stmtTarget{conn: conn, query: query}, nil
+	}
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	t := &stmtTarget{stmt: stmt, query: query}
+	if o.autoReprepare {
+		t.db = db
+	}
+	if o.stmtPool > 1 {
+		if err = t.preparePool(ctx, db, o.stmtPool); err != nil {
+			_ = stmt.Close()
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// preparePool prepares n-1 more copies of the statement (see [WithStmtPool]).
+func (t *stmtTarget) preparePool(ctx context.Context, db PrepareConn, n int) error {
+	pool := make([]*stmtTarget, 1, n)
+	pool[0] = &stmtTarget{stmt: t.stmt, query: t.query, db: t.db}
+	for len(pool) < n {
+		stmt, err := db.PrepareContext(ctx, t.query)
+		if err != nil {
+			for _, c := range pool[1:] {
+				_ = c.stmt.Close()
+			}
+			return err
+		}
+		pool = append(pool, &stmtTarget{stmt: stmt, query: t.query, db: t.db})
+	}
+	t.pool = pool
+	t.db = nil // each copy is reprepared on its own
+	return nil
+}
+
+// pick returns the copy of the statement for the next call.
+func (t *stmtTarget) pick() *stmtTarget {
+	return t.pool[atomic.AddUint32(&t.next, 1)%uint32(len(t.pool))]
+}
+
+// current returns the prepared statement.
+func (t *stmtTarget) current() *sql.Stmt {
+	if t.pool != nil {
+		return t.pick().current()
+	}
+	if t.db == nil {
+		return t.stmt
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.stmt
+}
+
+// reprepare prepares the statement again if err reports a bad connection and
+// [WithAutoReprepare] is enabled. It reports whether the call must be retried.
+func (t *stmtTarget) reprepare(ctx context.Context, err error) bool {
+	if t.db == nil || !errors.Is(err, driver.ErrBadConn) {
+		return false
+	}
+	stmt, err := t.db.PrepareContext(ctx, t.query)
+	if err != nil {
+		return false
+	}
+	t.mu.Lock()
+	old := t.stmt
+	t.stmt = stmt
+	t.mu.Unlock()
+	_ = old.Close()
+	return true
+}
+
+func (t *stmtTarget) close() error {
+	if t.explain != nil {
+		_ = t.explain.close()
+	}
+	if t.stmt == nil {
+		return nil
+	}
+	if t.pool != nil {
+		var err error
+		for _, c := range t.pool {
+			if e := c.current().Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+		return err
+	}
+	return t.current().Close()
+}
+
+// inTx returns the target localized to the transaction tx, and the func to call once
+// the target is not needed anymore.
+func (t *stmtTarget) inTx(ctx context.Context, tx interface{}) (*stmtTarget, func() error) {
+	if t.stmt == nil {
+		local := &stmtTarget{conn: tx.(directConn), query: t.query}
+		if t.explain != nil {
+			local.explain = &stmtTarget{conn: local.conn, query: t.explain.query}
+		}
+		return local, func() error { return nil }
+	}
+	stmt := tx.(StmtLocalizer).StmtContext(ctx, t.current())
+	local := &stmtTarget{stmt: stmt, query: t.query}
+	if t.explain == nil {
+		return local, stmt.Close
+	}
+	var releaseExplain func() error
+	local.explain, releaseExplain = t.explain.inTx(ctx, tx)
+	return local, func() error {
+		_ = releaseExplain()
+		return stmt.Close()
+	}
+}
+
+func (t *stmtTarget) exec(ctx context.Context, args []interface{}) (sql.Result, error) {
+	if t.stmt == nil {
+		return t.conn.ExecContext(ctx, t.query, args...)
+	}
+	if t.pool != nil {
+		return t.pick().exec(ctx, args)
+	}
+	r, err := t.current().ExecContext(ctx, args...)
+	if t.reprepare(ctx, err) {
+		r, err = t.current().ExecContext(ctx, args...)
+	}
+	return r, err
+}
+
+func (t *stmtTarget) queryRow(ctx context.Context, args []interface{}) *sql.Row {
+	if t.stmt == nil {
+		return t.conn.QueryRowContext(ctx, t.query, args...)
+	}
+	if t.pool != nil {
+		return t.pick().queryRow(ctx, args)
+	}
+	return t.current().QueryRowContext(ctx, args...)
+}
+
+func (t *stmtTarget) queryRows(ctx context.Context, args []interface{}) (*sql.Rows, error) {
+	if t.stmt == nil {
+		return t.conn.QueryContext(ctx, t.query, args...)
+	}
+	if t.pool != nil {
+		return t.pick().queryRows(ctx, args)
+	}
+	rows, err := t.current().QueryContext(ctx, args...)
+	if t.reprepare(ctx, err) {
+		rows, err = t.current().QueryContext(ctx, args...)
+	}
+	return rows, err
+}
+
+// scanRow runs the query and scans the first row into scanners.
+//
+// The scanners at indexes anyCols (pointers to interface{}) receive values of the scan types
+// of the columns, and the columns are checked with cc if pending: this requires to use
+// [sql.Stmt.QueryContext] instead of [sql.Stmt.QueryRowContext].
+func (t *stmtTarget) scanRow(ctx context.Context, args []interface{}, scanners []interface{}, anyCols []int, cc *columnsCheck) error {
+	if t.pool != nil {
+		return t.pick().scanRow(ctx, args, scanners, anyCols, cc)
+	}
+	if anyCols == nil && !cc.pending() {
+		err := t.queryRow(ctx, args).Scan(scanners...)
+		if t.reprepare(ctx, err) {
+			err = t.queryRow(ctx, args).Scan(scanners...)
+		}
+		return err
+	}
+	rows, err := t.queryRows(ctx, args)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if cc.pending() {
+		if err = cc.check(rows); err != nil {
+			return err
+		}
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	dest := append([]interface{}(nil), scanners...)
+	typed := make([]reflect.Value, len(scanners))
+	for _, i := range anyCols {
+		if i >= len(columnTypes) {
+			break // Scan reports the mismatch
+		}
+		if ptr := typedScanDest(columnTypes[i].ScanType()); ptr.IsValid() {
+			dest[i] = ptr.Interface()
+			typed[i] = ptr
+		}
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return err
+	}
+	for i, ptr := range typed {
+		if ptr.IsValid() {
+			*scanners[i].(*interface{}) = typedScanValue(ptr.Elem())
+		}
+	}
+	return rows.Close()
+}
+
+// typedScanDest returns a pointer to scan a column of the given scan type and be able to
+// report NULL, or an invalid value if the scan type doesn't tell more than interface{}.
+func typedScanDest(scanType reflect.Type) reflect.Value {
+	switch {
+	case scanType == nil || scanType == typeAny || scanType.Kind() == reflect.Ptr:
+		// Some drivers report *interface{}
+		return reflect.Value{}
+	case scanType == typeRawBytes:
+		// RawBytes is only valid until the next call of Next
+		return reflect.New(reflect.PtrTo(typeBytes))
+	case nullScanTypes[scanType] != nil:
+		return reflect.New(scanType)
+	default:
+		// Scan into a pointer to get nil for NULL
+		return reflect.New(reflect.PtrTo(scanType))
+	}
+}
+
+// typedScanValue extracts the value scanned into v by a destination made by [typedScanDest].
+func typedScanValue(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Struct {
+		// The sql.Null* types have the value as first field
+		if !v.FieldByName("Valid").Bool() {
+			return nil
+		}
+		return v.Field(0).Interface()
+	}
+	if v.IsNil() {
+		return nil
+	}
+	return v.Elem().Interface()
 }
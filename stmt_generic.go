@@ -0,0 +1,85 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import "context"
+
+// Stmt holds a function wrapping a prepared statement together with the function that
+// releases the statement.
+//
+// Stmt ties the function to its lifetime, for example in the fields of a repository:
+//
+//	type poiRepository struct {
+//		insert sqlfunc.Stmt[func(ctx context.Context, lat, lon float64, name string) (sql.Result, error)]
+//		count  sqlfunc.Stmt[func(ctx context.Context) (int64, error)]
+//	}
+type Stmt[F any] struct {
+	// Func is the function that executes the statement.
+	Func  F
+	close func() error
+}
+
+// Close releases the prepared statement.
+func (s Stmt[F]) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close()
+}
+
+// PrepareExec is like [Exec] but returns the function and its lifetime as a [Stmt].
+func PrepareExec[F any](ctx context.Context, db PrepareConn, query string, opts ...Option) (Stmt[F], error) {
+	var s Stmt[F]
+	close, err := Exec(ctx, db, query, &s.Func, opts...)
+	if err != nil {
+		return Stmt[F]{}, err
+	}
+	s.close = close
+	return s, nil
+}
+
+// PrepareQueryRow is like [QueryRow] but returns the function and its lifetime as a [Stmt].
+func PrepareQueryRow[F any](ctx context.Context, db PrepareConn, query string, opts ...Option) (Stmt[F], error) {
+	var s Stmt[F]
+	close, err := QueryRow(ctx, db, query, &s.Func, opts...)
+	if err != nil {
+		return Stmt[F]{}, err
+	}
+	s.close = close
+	return s, nil
+}
+
+// PrepareQuery is like [Query] but returns the function and its lifetime as a [Stmt].
+func PrepareQuery[F any](ctx context.Context, db PrepareConn, query string, opts ...Option) (Stmt[F], error) {
+	var s Stmt[F]
+	close, err := Query(ctx, db, query, &s.Func, opts...)
+	if err != nil {
+		return Stmt[F]{}, err
+	}
+	s.close = close
+	return s, nil
+}
+
+// GetNamed returns the func registered under name in stmts (see [NamedStmts.Get]).
+// ok is false if name is unknown or if the func is not of type F.
+func GetNamed[F any](stmts *NamedStmts, name string) (fn F, ok bool) {
+	fn, ok = stmts.Get(name).(F)
+	return
+}
@@ -0,0 +1,173 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+type poiRepository struct {
+	count sqlfunc.Stmt[func(ctx context.Context) (int64, error)]
+	names sqlfunc.Stmt[func(ctx context.Context) (*sql.Rows, error)]
+	coord sqlfunc.Stmt[func(ctx context.Context, name string) (lat, lon float64, err error)]
+}
+
+func newPOIRepository(ctx context.Context, db *sql.DB) (r *poiRepository, err error) {
+	r = &poiRepository{}
+	defer func() {
+		if err != nil {
+			r.Close()
+		}
+	}()
+	if r.count, err = sqlfunc.PrepareQueryRow[func(ctx context.Context) (int64, error)](
+		ctx, db, `SELECT COUNT(*) FROM poi`,
+	); err != nil {
+		return nil, err
+	}
+	if r.names, err = sqlfunc.PrepareQuery[func(ctx context.Context) (*sql.Rows, error)](
+		ctx, db, `SELECT name FROM poi ORDER BY name`,
+	); err != nil {
+		return nil, err
+	}
+	if r.coord, err = sqlfunc.PrepareQueryRow[func(ctx context.Context, name string) (lat, lon float64, err error)](
+		ctx, db, `SELECT lat, lon FROM poi WHERE name = ?`,
+	); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *poiRepository) Close() (err error) {
+	for _, s := range []interface{ Close() error }{r.count, r.names, r.coord} {
+		if e := s.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+func ExampleStmt() {
+	check := func(msg string, err error) {
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", msg, err))
+		}
+	}
+
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	check("Open", err)
+	defer db.Close()
+
+	repo, err := newPOIRepository(ctx, db)
+	check("newPOIRepository", err)
+	defer repo.Close()
+
+	n, err := repo.count.Func(ctx)
+	check("count", err)
+	fmt.Println("count:", n)
+
+	lat, lon, err := repo.coord.Func(ctx, "Villeperdue")
+	check("coord", err)
+	fmt.Printf("Villeperdue: (%.4f %.4f)\n", lat, lon)
+
+	// Output:
+	// count: 2
+	// Villeperdue: (47.2009 0.6317)
+}
+
+func TestPrepareExec(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	s, err := sqlfunc.PrepareExec[func(ctx context.Context) (sql.Result, error)](ctx, db, `SELECT 1`)
+	if err != nil {
+		t.Fatalf("PrepareExec: %v", err)
+	}
+	if _, err = s.Func(ctx); err != nil {
+		t.Errorf("Func: %v", err)
+	}
+	if err = s.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+
+	const invalidQuery = `INVALID`
+	s, err = sqlfunc.PrepareExec[func(ctx context.Context) (sql.Result, error)](ctx, failingConn{db, invalidQuery}, invalidQuery)
+	if !errors.Is(err, errPrepare) {
+		t.Fatalf("got %v, expected %v", err, errPrepare)
+	}
+	if s.Func != nil {
+		t.Error("Func should be nil")
+	}
+	if err = s.Close(); err != nil {
+		t.Errorf("Close of zero Stmt: %v", err)
+	}
+}
+
+func BenchmarkStmt(b *testing.B) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		b.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	const query = `SELECT ? + 1`
+
+	b.Run("sqlfunc.QueryRow", func(b *testing.B) {
+		var f func(ctx context.Context, n int) (int, error)
+		close, err := sqlfunc.QueryRow(ctx, db, query, &f)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer close()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := f(ctx, i); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("sqlfunc.Stmt", func(b *testing.B) {
+		s, err := sqlfunc.PrepareQueryRow[func(ctx context.Context, n int) (int, error)](ctx, db, query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer s.Close()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := s.Func(ctx, i); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -19,8 +19,15 @@ package sqlfunc_test
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
 
 	"github.com/dolmen-go/sqlfunc"
 )
@@ -194,6 +201,49 @@ func ExampleExec_withTx() {
 	// countPOI after rollback: 0
 }
 
+func ExampleExec_rowsAffected() {
+	check := func(msg string, err error) {
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", msg, err))
+		}
+	}
+
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	check("Open", err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.ExecContext(ctx, ``+
+		`CREATE TABLE poi (name VARCHAR(255), visitors INTEGER);`+
+		`INSERT INTO poi VALUES ('Château de Versailles', 0), ('Villeperdue', 0)`)
+	check("Create table", err)
+
+	// Returning an integer instead of sql.Result gives the number of rows affected
+	var visit func(ctx context.Context, name string) (int64, error)
+	closeVisit, err := sqlfunc.Exec(
+		ctx, db,
+		`UPDATE poi SET visitors = visitors + 1 WHERE name = ?`,
+		&visit,
+	)
+	check("Prepare visit", err)
+	defer closeVisit()
+
+	for _, name := range []string{"Villeperdue", "Atlantis"} {
+		n, err := visit(ctx, name)
+		check("visit", err)
+		if n != 1 {
+			fmt.Printf("%s: %d rows updated, expected 1\n", name, n)
+			continue
+		}
+		fmt.Printf("%s: visited\n", name)
+	}
+
+	// Output:
+	// Villeperdue: visited
+	// Atlantis: 0 rows updated, expected 1
+}
+
 func ExampleQuery() {
 	check := func(msg string, err error) {
 		if err != nil {
@@ -227,6 +277,89 @@ func ExampleQuery() {
 	// - Villeperdue
 }
 
+func ExampleQuery_columns() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	var queryPOI func(ctx context.Context) (rows *sql.Rows, columns []string, err error)
+	closeQueryPOI, err := sqlfunc.Query(ctx, db, `SELECT name, lat, lon FROM poi ORDER BY name`, &queryPOI)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+	defer closeQueryPOI()
+
+	rows, columns, err := queryPOI(ctx)
+	if err != nil {
+		fmt.Println("queryPOI:", err)
+		return
+	}
+	defer rows.Close()
+
+	// Generic rendering: a header, then the rows
+	fmt.Println(strings.Join(columns, " | "))
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			fmt.Println("Scan:", err)
+			return
+		}
+		cells := make([]string, len(values))
+		for i, v := range values {
+			cells[i] = v.String
+		}
+		fmt.Println(strings.Join(cells, " | "))
+	}
+	if err = rows.Err(); err != nil {
+		fmt.Println("Rows:", err)
+	}
+
+	// Output:
+	// name | lat | lon
+	// Château de Versailles | 48.8016 | 2.1204
+	// Villeperdue | 47.2009 | 0.6317
+}
+
+func TestColumns(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	var queryPOI func(ctx context.Context) (*sql.Rows, error)
+	closeQueryPOI, err := sqlfunc.Query(ctx, db, `SELECT name, lat AS latitude FROM poi`, &queryPOI)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer closeQueryPOI()
+
+	rows, err := queryPOI(ctx)
+	if err != nil {
+		t.Fatalf("queryPOI: %v", err)
+	}
+	defer rows.Close()
+
+	columns, err := sqlfunc.Columns(rows)
+	if err != nil || strings.Join(columns, ",") != "name,latitude" {
+		t.Errorf("Columns: got %q, %v", columns, err)
+	}
+	columnTypes, err := sqlfunc.ColumnTypes(rows)
+	if err != nil || len(columnTypes) != 2 || columnTypes[1].Name() != "latitude" {
+		t.Errorf("ColumnTypes: got %v, %v", columnTypes, err)
+	}
+}
+
 func ExampleQuery_withArgs() {
 	check := func(msg string, err error) {
 		if err != nil {
@@ -259,6 +392,53 @@ func ExampleQuery_withArgs() {
 	// (48.8016 2.1204)
 }
 
+func ExampleQuery_namedMap() {
+	check := func(msg string, err error) {
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", msg, err))
+		}
+	}
+
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	check("Open", err)
+	defer db.Close()
+
+	var queryPOI func(ctx context.Context, filter map[string]interface{}) (*sql.Rows, error)
+	closeQueryPOI, err := sqlfunc.Query(
+		ctx, db,
+		`SELECT name FROM poi WHERE lat BETWEEN :minLat AND :maxLat AND name LIKE :pattern ORDER BY name`,
+		&queryPOI,
+	)
+	check("Prepare queryPOI", err)
+	defer closeQueryPOI()
+
+	for _, filter := range []map[string]interface{}{
+		{"minLat": 45, "maxLat": 50, "pattern": "%"},
+		{"minLat": 45, "maxLat": 50, "pattern": "V%"},
+		{"minLat": 48, "maxLat": 50, "pattern": "%"},
+		{"minLat": 48, "pattern": "%"},
+	} {
+		rows, err := queryPOI(ctx, filter)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		var names []string
+		err = sqlfunc.ForEach(rows, func(name string) {
+			names = append(names, name)
+		})
+		check("read rows", err)
+		fmt.Printf("%q\n", names)
+	}
+
+	// Output:
+	// ["Château de Versailles" "Villeperdue"]
+	// ["Villeperdue"]
+	// ["Château de Versailles"]
+	// sqlfunc: missing value for named parameter "maxLat"
+}
+
 func ExampleQueryRow_withArgs() {
 	check := func(msg string, err error) {
 		if err != nil {
@@ -287,3 +467,639 @@ func ExampleQueryRow_withArgs() {
 	// Output:
 	// (48.8016 2.1204)
 }
+
+func ExampleQueryRowLazy() {
+	check := func(msg string, err error) {
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", msg, err))
+		}
+	}
+
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	check("Open", err)
+	defer db.Close()
+
+	var queryByName func(ctx context.Context, name string) (scan func(dest ...interface{}) error, err error)
+	closeQueryByName, err := sqlfunc.QueryRowLazy(
+		ctx, db,
+		`SELECT lat, lon FROM poi WHERE name = ?`,
+		&queryByName,
+	)
+	check("Prepare queryByName", err)
+	defer closeQueryByName()
+
+	scan, err := queryByName(ctx, "Château de Versailles")
+	check("queryByName", err)
+	// The destinations are chosen after the query
+	var lat, lon string
+	check("scan", scan(&lat, &lon))
+	fmt.Println(lat, lon)
+
+	scan, err = queryByName(ctx, "Atlantis")
+	check("queryByName", err)
+	err = scan(&lat, &lon)
+	fmt.Println(err == sql.ErrNoRows)
+
+	// Output:
+	// 48.8016 2.1204
+	// true
+}
+
+func TestQueryStop(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	var query func(ctx context.Context, max int) (*sql.Rows, func(), error)
+	closeQuery, err := sqlfunc.Query(ctx, db, ``+
+		`WITH RECURSIVE series(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM series WHERE n < ?)`+
+		` SELECT n FROM series`, &query)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer closeQuery()
+
+	rows, stop, err := query(ctx, 1000000000)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	defer stop()
+	var n int
+	err = sqlfunc.ForEach(rows, func(int) {
+		n++
+		if n == 3 {
+			stop()
+		}
+	})
+	// Cancellation is asynchronous: the iteration ends at some later row
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ForEach: got %v after %d rows, expected %v", err, n, context.Canceled)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("parent context: %v", ctx.Err())
+	}
+
+	// A full iteration
+	rows, stop, err = query(ctx, 3)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	n = 0
+	err = sqlfunc.ForEach(rows, func(int) { n++ })
+	stop()
+	if err != nil || n != 3 {
+		t.Errorf("ForEach: got %d, %v", n, err)
+	}
+}
+
+func TestQueryRowAny(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE mixed (id INTEGER, b BOOLEAN, f REAL, s TEXT, d DATETIME, blob BLOB, n INTEGER)`)
+	if err != nil {
+		t.Fatalf("Create table: %v", err)
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO mixed VALUES (1, 1, 2, 'a', '2022-06-01 12:00:00', x'cafe', NULL)`)
+	if err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	const query = `SELECT b, f, s, d, blob, n, 'x' || s, id FROM mixed WHERE id = ?`
+
+	// The scan type of a DATETIME column depends on the driver: time.Time or string
+	rows, err := db.QueryContext(ctx, query, 1)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	columnTypes, err := rows.ColumnTypes()
+	rows.Close()
+	if err != nil {
+		t.Fatalf("ColumnTypes: %v", err)
+	}
+	dType, dString := "time.Time", "2022-06-01 12:00:00 +0000 UTC"
+	if st := columnTypes[3].ScanType(); st != reflect.TypeOf(time.Time{}) && st != reflect.TypeOf(sql.NullTime{}) {
+		dType, dString = st.String(), "" // the text format depends on the driver
+	}
+
+	var get func(ctx context.Context, id int) (b, f, s, d, blob, n, expr interface{}, id2 int, err error)
+	closeGet, err := sqlfunc.QueryRow(ctx, db, query, &get)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeGet()
+
+	b, f, s, d, blob, n, expr, id, err := get(ctx, 1)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	for _, c := range []struct {
+		name           string
+		got            interface{}
+		expectedType   string
+		expectedString string
+	}{
+		{"b", b, "bool", "true"},
+		{"f", f, "float64", "2"},
+		{"s", s, "string", "a"},
+		{"d", d, dType, dString},
+		{"blob", blob, "[]uint8", "[202 254]"},
+		{"n", n, "<nil>", "<nil>"},
+		{"expr", expr, "string", "xa"}, // No column type: raw value from the driver
+	} {
+		if got := fmt.Sprintf("%T", c.got); got != c.expectedType {
+			t.Errorf("%s: got type %s, expected %s", c.name, got, c.expectedType)
+		} else if got := fmt.Sprint(c.got); c.expectedString != "" && got != c.expectedString {
+			t.Errorf("%s: got %s, expected %s", c.name, got, c.expectedString)
+		}
+	}
+	if id != 1 {
+		t.Errorf("id: got %d, expected 1", id)
+	}
+
+	if _, _, _, _, _, _, _, _, err = get(ctx, 2); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("got %v, expected %v", err, sql.ErrNoRows)
+	}
+}
+
+// countingTx is a wrapper of *sql.Tx counting the statements localized to the transaction.
+type countingTx struct {
+	*sql.Tx
+	stmts int
+}
+
+func (tx *countingTx) StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt {
+	tx.stmts++
+	return tx.Tx.StmtContext(ctx, stmt)
+}
+
+func TestExecStmtLocalizer(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE t (n INTEGER)`); err != nil {
+		t.Fatalf("Create table: %v", err)
+	}
+
+	var insert func(ctx context.Context, tx *countingTx, n int) (sql.Result, error)
+	closeInsert, err := sqlfunc.Exec(ctx, db, `INSERT INTO t (n) VALUES (?)`, &insert)
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	defer closeInsert()
+
+	// The second argument may also be declared as the interface
+	var count func(ctx context.Context, tx sqlfunc.StmtLocalizer) (int, error)
+	closeCount, err := sqlfunc.QueryRow(ctx, db, `SELECT COUNT(*) FROM t`, &count)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeCount()
+
+	sqlTx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	tx := &countingTx{Tx: sqlTx}
+	defer tx.Rollback()
+
+	for i := 1; i <= 2; i++ {
+		if _, err = insert(ctx, tx, i); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	if n, err := count(ctx, tx); err != nil || n != 2 {
+		t.Errorf("count: got %d, %v; expected 2", n, err)
+	}
+	if tx.stmts != 3 {
+		t.Errorf("got %d localized statements, expected 3", tx.stmts)
+	}
+}
+
+// label is a query parameter that accidentally implements sqlfunc.StmtLocalizer.
+type label string
+
+func (l label) StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt { return stmt }
+
+func (l label) Value() (driver.Value, error) { return string(l), nil }
+
+func TestWithNoTxArg(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	// Without the option, the label is taken for a transaction: the query has no parameter
+	var info sqlfunc.StmtInfo
+	var echoTx func(ctx context.Context, l label) (string, error)
+	closeEchoTx, err := sqlfunc.QueryRow(ctx, db, `SELECT 'none'`, &echoTx, sqlfunc.WithStmtInfo(&info))
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	closeEchoTx()
+	if len(info.ArgTypes) != 0 {
+		t.Errorf("got args %v, expected none", info.ArgTypes)
+	}
+
+	var echo func(ctx context.Context, l label) (string, error)
+	closeEcho, err := sqlfunc.QueryRow(ctx, db, `SELECT ?`, &echo, sqlfunc.WithNoTxArg())
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeEcho()
+	if s, err := echo(ctx, "hello"); err != nil || s != "hello" {
+		t.Errorf("got %q, %v", s, err)
+	}
+
+	var exec func(ctx context.Context, l label) (int64, error)
+	closeExec, err := sqlfunc.Exec(ctx, db, `SELECT ?`, &exec, sqlfunc.WithNoTxArg())
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	defer closeExec()
+	if _, err := exec(ctx, "hello"); err != nil {
+		t.Errorf("exec: %v", err)
+	}
+}
+
+// taggingConn is a wrapper of *sql.DB that returns results with a command tag, as a wrapper of
+// a PostgreSQL connection could.
+type taggingConn struct {
+	*sql.DB
+}
+
+type taggedResult struct {
+	sql.Result
+	tag string
+}
+
+func (r taggedResult) CommandTag() string { return r.tag }
+
+func (c taggingConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	r, err := c.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	return taggedResult{r, fmt.Sprintf("INSERT 0 %d", n)}, nil
+}
+
+func TestExecCommandTag(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE t (n INTEGER)`); err != nil {
+		t.Fatalf("Create table: %v", err)
+	}
+
+	var insert func(ctx context.Context, a, b int) (string, error)
+	closeInsert, err := sqlfunc.Exec(ctx, taggingConn{db}, `INSERT INTO t (n) VALUES (?), (?)`, &insert, sqlfunc.WithoutPrepare())
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	defer closeInsert()
+	if tag, err := insert(ctx, 1, 2); err != nil || tag != "INSERT 0 2" {
+		t.Errorf("got %q, %v; expected %q", tag, err, "INSERT 0 2")
+	}
+
+	// database/sql hides the result of the driver
+	var insertStmt func(ctx context.Context, n int) (string, error)
+	closeInsertStmt, err := sqlfunc.Exec(ctx, db, `INSERT INTO t (n) VALUES (?)`, &insertStmt)
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	defer closeInsertStmt()
+	if tag, err := insertStmt(ctx, 3); !errors.Is(err, sqlfunc.ErrNoCommandTag) || tag != "" {
+		t.Errorf("got %q, %v; expected %v", tag, err, sqlfunc.ErrNoCommandTag)
+	}
+}
+
+// taggingDriver is a [driver.Connector] whose results provide a command tag, which
+// database/sql hides.
+type taggingDriver struct{}
+
+func (d taggingDriver) Connect(context.Context) (driver.Conn, error) { return taggingDriverConn{}, nil }
+func (d taggingDriver) Driver() driver.Driver                        { return d }
+func (taggingDriver) Open(string) (driver.Conn, error)               { return taggingDriverConn{}, nil }
+
+type taggingDriverConn struct{}
+
+func (taggingDriverConn) Prepare(string) (driver.Stmt, error) { return taggingDriverStmt{}, nil }
+func (taggingDriverConn) Close() error                        { return nil }
+func (taggingDriverConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+type taggingDriverStmt struct{}
+
+func (taggingDriverStmt) Close() error  { return nil }
+func (taggingDriverStmt) NumInput() int { return -1 }
+func (taggingDriverStmt) Exec([]driver.Value) (driver.Result, error) {
+	return taggedDriverResult{driver.RowsAffected(1)}, nil
+}
+func (taggingDriverStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+type taggedDriverResult struct{ driver.Result }
+
+func (taggedDriverResult) CommandTag() string { return "INSERT 0 1" }
+
+func TestExecCommandTagDriver(t *testing.T) {
+	ctx := context.Background()
+	db := sql.OpenDB(taggingDriver{})
+	defer db.Close()
+
+	// The command tag of the driver doesn't go through database/sql
+	for _, opts := range [][]sqlfunc.Option{nil, {sqlfunc.WithoutPrepare()}} {
+		var insert func(ctx context.Context, n int) (string, error)
+		closeInsert, err := sqlfunc.Exec(ctx, db, `INSERT INTO t (n) VALUES (?)`, &insert, opts...)
+		if err != nil {
+			t.Fatalf("Exec: %v", err)
+		}
+		if tag, err := insert(ctx, 1); !errors.Is(err, sqlfunc.ErrNoCommandTag) || tag != "" {
+			t.Errorf("got %q, %v; expected %v", tag, err, sqlfunc.ErrNoCommandTag)
+		}
+		closeInsert()
+	}
+}
+
+func ExampleQueryRow_intoStruct() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	type POI struct {
+		Name     string
+		Lat, Lon float64
+	}
+
+	var getPOI func(ctx context.Context, dest *POI, name string) (found bool, err error)
+	closeGetPOI, err := sqlfunc.QueryRow(ctx, db, `SELECT name, lat, lon FROM poi WHERE name = ?`, &getPOI)
+	if err != nil {
+		fmt.Println("QueryRow:", err)
+		return
+	}
+	defer closeGetPOI()
+
+	for _, name := range []string{"Château de Versailles", "Tour Eiffel"} {
+		var poi POI
+		found, err := getPOI(ctx, &poi, name)
+		switch {
+		case err != nil:
+			fmt.Println("getPOI:", err)
+		case !found:
+			fmt.Println(name, "not found")
+		default:
+			fmt.Printf("%s (%.4f %.4f)\n", poi.Name, poi.Lat, poi.Lon)
+		}
+	}
+
+	// Output:
+	// Château de Versailles (48.8016 2.1204)
+	// Tour Eiffel not found
+}
+
+func ExamplePrepare() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	// Pre-flight check of the queries of the application at boot
+	queries := []string{
+		`SELECT COUNT(*) FROM poi`,
+		`SELECT name FROM poi WHERE lat BETWEEN ? AND ?`,
+		`SELECT name, lat, lon FROM poi WHERE name = ?`,
+	}
+	for _, query := range queries {
+		closeStmt, err := sqlfunc.Prepare(ctx, db, query)
+		if err != nil {
+			fmt.Printf("%q: %v\n", query, err)
+			continue
+		}
+		closeStmt()
+	}
+	fmt.Println(len(queries), "queries checked")
+
+	// Output:
+	// 3 queries checked
+}
+
+func TestPrepare(t *testing.T) {
+	if sqliteDriver != "sqlite3" {
+		t.Skip("modernc.org/sqlite checks the query at execution")
+	}
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, "file:testdata/poi.db?mode=ro&immutable=1")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	for _, query := range []string{`SELECT nickname FROM poi`, `SELEC name FROM poi`} {
+		closeStmt, err := sqlfunc.Prepare(ctx, db, query)
+		if err == nil {
+			t.Errorf("%q: error expected", query)
+		}
+		if closeStmt == nil {
+			t.Errorf("%q: nil close", query)
+		} else if err = closeStmt(); err != nil {
+			t.Errorf("%q: close: %v", query, err)
+		}
+	}
+}
+
+type person struct {
+	ID    int64
+	Name  string `sql:"full_name"`
+	Email *string
+	Valid bool // set by AfterScan
+}
+
+func (p *person) AfterScan() error {
+	p.Valid = p.Name != ""
+	return nil
+}
+
+func TestQueryRowInto(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE person (id INTEGER, full_name TEXT, email TEXT)`); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err = db.ExecContext(ctx, `INSERT INTO person VALUES (1, 'Alice', NULL), (2, 'Bob', 'bob@example.com')`); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	var get func(ctx context.Context, tx *sql.Tx, dest *person, id int64) (bool, error)
+	closeGet, err := sqlfunc.QueryRow(ctx, db, `SELECT id, full_name, email FROM person WHERE id = ?`, &get)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeGet()
+
+	var p person
+	if found, err := get(ctx, nil, &p, 1); err != nil || !found || p.ID != 1 || p.Name != "Alice" || p.Email != nil || !p.Valid {
+		t.Errorf("id 1: got %v, %v, %+v", found, err, p)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	defer tx.Rollback()
+	p = person{}
+	if found, err := get(ctx, tx, &p, 2); err != nil || !found || p.Name != "Bob" || p.Email == nil || *p.Email != "bob@example.com" {
+		t.Errorf("id 2: got %v, %v, %+v", found, err, p)
+	}
+	tx.Rollback()
+
+	p = person{Name: "unchanged"}
+	if found, err := get(ctx, nil, &p, 3); err != nil || found || p.Name != "unchanged" {
+		t.Errorf("id 3: got %v, %v, %+v", found, err, p)
+	}
+
+	if found, err := get(ctx, nil, nil, 1); err == nil || found {
+		t.Errorf("nil dest: got %v, %v", found, err)
+	}
+
+	// A column without field is an error, not "not found"
+	var getBad func(ctx context.Context, dest *person) (bool, error)
+	closeGetBad, err := sqlfunc.QueryRow(ctx, db, `SELECT id, 1 AS unknown FROM person`, &getBad)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeGetBad()
+	if found, err := getBad(ctx, &p); err == nil || found {
+		t.Errorf("unknown column: got %v, %v", found, err)
+	}
+}
+
+// TestConcurrentFuncs checks that a single func created by Exec, QueryRow or Query may be called
+// concurrently from many goroutines. Run with -race.
+func TestConcurrentFuncs(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // a single in-memory database
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE kv (k INTEGER, v TEXT)`); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	g := sqlfunc.NewGroup(db)
+	defer g.Close()
+
+	var (
+		insert   func(ctx context.Context, tx *sql.Tx, k int, v string) (int64, error)
+		get      func(ctx context.Context, k int) (string, *int, error)
+		getAny   func(ctx context.Context, k int) (interface{}, error)
+		list     func(ctx context.Context, k int) (*sql.Rows, error)
+		scanKV   func(rows *sql.Rows) (int, string, error)
+		scanInto func(rows *sql.Rows, kv *struct{ K, V interface{} }) error
+	)
+	err = g.PrepareAll(ctx, 0,
+		sqlfunc.GroupExec(`INSERT INTO kv (k, v) VALUES (?, ?)`, &insert),
+		sqlfunc.GroupQueryRow(`SELECT v, NULL FROM kv WHERE k = ?`, &get),
+		sqlfunc.GroupQueryRow(`SELECT v FROM kv WHERE k = ?`, &getAny),
+		sqlfunc.GroupQuery(`SELECT k, v FROM kv WHERE k <= ? ORDER BY k`, &list),
+	)
+	if err != nil {
+		t.Fatalf("PrepareAll: %v", err)
+	}
+	sqlfunc.Scan(&scanKV)
+	sqlfunc.Scan(&scanInto)
+
+	const goroutines, calls = 8, 20
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < calls; j++ {
+				k := i*calls + j
+				v := fmt.Sprint("v", k)
+				var tx *sql.Tx
+				if j%2 == 0 {
+					var err error
+					if tx, err = db.BeginTx(ctx, nil); err != nil {
+						t.Errorf("Begin: %v", err)
+						return
+					}
+				}
+				if n, err := insert(ctx, tx, k, v); err != nil || n != 1 {
+					t.Errorf("insert: %d, %v", n, err)
+				}
+				if tx != nil {
+					if err := tx.Commit(); err != nil {
+						t.Errorf("Commit: %v", err)
+					}
+				}
+				if got, null, err := get(ctx, k); err != nil || got != v || null != nil {
+					t.Errorf("get(%d): %q, %v, %v", k, got, null, err)
+				}
+				if got, err := getAny(ctx, k); err != nil || got != v {
+					t.Errorf("getAny(%d): %v, %v", k, got, err)
+				}
+				rows, err := list(ctx, k)
+				if err != nil {
+					t.Errorf("list: %v", err)
+					continue
+				}
+				for n := 0; rows.Next(); n++ {
+					if n%2 == 0 {
+						if _, _, err = scanKV(rows); err != nil {
+							t.Errorf("scanKV: %v", err)
+						}
+					} else {
+						var kv struct{ K, V interface{} }
+						if err = scanInto(rows, &kv); err != nil || kv.V != fmt.Sprint("v", kv.K) {
+							t.Errorf("scanInto: %v, %v", kv, err)
+						}
+					}
+				}
+				if err = rows.Close(); err != nil {
+					t.Errorf("Close: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
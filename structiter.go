@@ -0,0 +1,114 @@
+//go:build go1.23
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"database/sql"
+	"fmt"
+	"iter"
+	"reflect"
+	"strings"
+)
+
+// discardScanner is an [sql.Scanner] that ignores the value of a column.
+type discardScanner struct{}
+
+func (discardScanner) Scan(interface{}) error { return nil }
+
+// StructIter returns an iterator over rows that scans each row into a value of struct type T.
+//
+// Only the columns matching the given fields are scanned: fields are names of fields of T as
+// for scanning (see [ScanPtr]: the `sql` tag or else the field name, compared
+// case-insensitively). The other columns are discarded without conversion, which reduces the
+// cost of scanning a few fields of wide rows. Without fields, all the columns matching a field
+// of T are scanned. If *T implements [AfterScanner], AfterScan is called after each row is
+// scanned.
+//
+// The iteration stops at the first error, which is yielded with the zero value of T. A field
+// that matches no column is an error. rows are closed when the iteration stops.
+func StructIter[T any](rows *sql.Rows, fields ...string) iter.Seq2[T, error] {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if !isStructDest(t) {
+		panic("T must be a struct type")
+	}
+	return func(yield func(T, error) bool) {
+		defer rows.Close()
+
+		var zero, value T
+		scanners, err := selectScanners(rows, reflect.ValueOf(&value).Elem(), fields)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		afterScan, _ := any(&value).(AfterScanner)
+		for rows.Next() {
+			value = zero
+			if err = rows.Scan(scanners...); err == nil && afterScan != nil {
+				err = afterScan.AfterScan()
+			}
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(value, nil) {
+				return
+			}
+		}
+		if err = rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// selectScanners returns the scanners of the columns of rows into the given fields of struct v,
+// and discard scanners for the other columns.
+func selectScanners(rows *sql.Rows, v reflect.Value, fields []string) ([]interface{}, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	structFields := structFields(v.Type())
+	selected := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		name := strings.ToLower(f)
+		if _, ok := structFields[name]; !ok {
+			return nil, fmt.Errorf("sqlfunc: %v has no field %q", v.Type(), f)
+		}
+		selected[name] = false
+	}
+	scanners := make([]interface{}, len(columns))
+	for i, col := range columns {
+		name := strings.ToLower(col)
+		path, ok := structFields[name]
+		if done, sel := selected[name]; ok && (len(fields) == 0 || (sel && !done)) {
+			scanners[i] = scanner(v.FieldByIndex(path).Addr())
+			if sel {
+				selected[name] = true
+			}
+		} else {
+			scanners[i] = discardScanner{}
+		}
+	}
+	for _, f := range fields {
+		if !selected[strings.ToLower(f)] {
+			return nil, fmt.Errorf("sqlfunc: field %q matches no column", f)
+		}
+	}
+	return scanners, nil
+}
@@ -0,0 +1,140 @@
+//go:build go1.23
+
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func ExampleStructIter() {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.ExecContext(ctx, `CREATE TABLE city (`+
+		`id INTEGER, name TEXT, country TEXT, region TEXT, population INTEGER,`+
+		`area REAL, lat REAL, lon REAL, elevation INTEGER, timezone TEXT);`+
+		`INSERT INTO city VALUES `+
+		`(1, 'Paris', 'FR', 'Île-de-France', 2102650, 105.4, 48.8566, 2.3522, 35, 'Europe/Paris'),`+
+		`(2, 'Lyon', 'FR', 'Auvergne-Rhône-Alpes', 522250, 47.87, 45.7640, 4.8357, 173, 'Europe/Paris')`)
+	if err != nil {
+		fmt.Println("Create:", err)
+		return
+	}
+
+	type city struct {
+		ID         int
+		Name       string
+		Population int
+		Lat, Lon   float64
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT * FROM city ORDER BY id`)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+	// Only name and population are scanned: the 8 other columns are discarded
+	for c, err := range sqlfunc.StructIter[city](rows, "Name", "Population") {
+		if err != nil {
+			fmt.Println("Error:", err)
+			break
+		}
+		fmt.Printf("%+v\n", c)
+	}
+
+	// Output:
+	// {ID:0 Name:Paris Population:2102650 Lat:0 Lon:0}
+	// {ID:0 Name:Lyon Population:522250 Lat:0 Lon:0}
+}
+
+func TestStructIter(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	type row struct {
+		A int
+		B string `sql:"bee"`
+	}
+	const query = `SELECT 1 AS a, 'x' AS bee, 3 AS c UNION ALL SELECT 2, 'y', 4`
+
+	collect := func(fields ...string) ([]row, error) {
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		var result []row
+		for r, err := range sqlfunc.StructIter[row](rows, fields...) {
+			if err != nil {
+				return result, err
+			}
+			result = append(result, r)
+		}
+		return result, nil
+	}
+
+	if got, err := collect(); err != nil || fmt.Sprint(got) != "[{1 x} {2 y}]" {
+		t.Errorf("all fields: got %v, %v", got, err)
+	}
+	if got, err := collect("BEE"); err != nil || fmt.Sprint(got) != "[{0 x} {0 y}]" {
+		t.Errorf("bee: got %v, %v", got, err)
+	}
+	if _, err := collect("c"); err == nil {
+		t.Error("error expected for an unknown field")
+	}
+
+	type wide struct {
+		A, D int
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for _, err := range sqlfunc.StructIter[wide](rows, "d") {
+		if err == nil {
+			t.Error("error expected for a field without column")
+		}
+	}
+
+	// Stopping early closes rows
+	rows, err = db.QueryContext(ctx, query)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for range sqlfunc.StructIter[row](rows) {
+		break
+	}
+	if rows.Next() {
+		t.Error("rows not closed")
+	}
+}
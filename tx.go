@@ -0,0 +1,78 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// RunInTx begins a transaction, calls fn with it, and commits the transaction if fn returns nil
+// or rolls it back otherwise.
+//
+// fn is expected to give tx to the functions created by [Exec], [QueryRow] and [Query]
+// (see the transaction argument in [Exec]).
+//
+// If fn fails, its error is returned (with the rollback error, if any, in the message).
+// If fn panics, the transaction is rolled back before the panic is propagated.
+func RunInTx(ctx context.Context, db TxBeginner, opts *sql.TxOptions, fn func(ctx context.Context, tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	done := false
+	defer func() {
+		if !done { // fn panicked
+			_ = tx.Rollback()
+		}
+	}()
+
+	err = fn(ctx, tx)
+	done = true
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback: %v)", err, rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeferConstraints defers the checks of the deferrable constraints of the transaction tx
+// until it is committed, using the statement "SET CONSTRAINTS ALL DEFERRED".
+//
+// This allows to run statements that temporarily break constraints (for example inserting rows
+// before the rows they reference) with the functions created by [Exec], localized to tx.
+//
+// The statement is supported by PostgreSQL and Oracle (only constraints declared DEFERRABLE
+// are deferred). SQLite has no such statement: DeferConstraints is a no-op with SQLite (use
+// "PRAGMA defer_foreign_keys = ON" to defer foreign key checks). With other databases the error
+// from the SET statement is returned.
+func DeferConstraints(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `SET CONSTRAINTS ALL DEFERRED`)
+	if err != nil {
+		// SQLite doesn't abort the transaction on error: detect it with a function only
+		// SQLite has. On PostgreSQL the transaction is aborted so the probe fails too.
+		var version string
+		if tx.QueryRowContext(ctx, `SELECT sqlite_version()`).Scan(&version) == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sqlfunc_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func TestRunInTx(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE t (n INTEGER)`); err != nil {
+		t.Fatalf("Create table: %v", err)
+	}
+
+	var insert func(ctx context.Context, tx *sql.Tx, n int) (sql.Result, error)
+	closeInsert, err := sqlfunc.Exec(ctx, db, `INSERT INTO t (n) VALUES (?)`, &insert)
+	if err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	defer closeInsert()
+
+	var count func(ctx context.Context) (int, error)
+	closeCount, err := sqlfunc.QueryRow(ctx, db, `SELECT COUNT(*) FROM t`, &count)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeCount()
+
+	checkCount := func(expected int) {
+		t.Helper()
+		if n, err := count(ctx); err != nil || n != expected {
+			t.Errorf("count: got %d, %v; expected %d", n, err, expected)
+		}
+	}
+
+	// Commit
+	err = sqlfunc.RunInTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := insert(ctx, tx, 1)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("RunInTx: %v", err)
+	}
+	checkCount(1)
+
+	// Rollback on error
+	errFail := errors.New("fail")
+	err = sqlfunc.RunInTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := insert(ctx, tx, 2); err != nil {
+			return err
+		}
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Errorf("RunInTx: got %v, expected %v", err, errFail)
+	}
+	checkCount(1)
+
+	// Rollback on panic
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("recover: got %v", r)
+			}
+		}()
+		_ = sqlfunc.RunInTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+			if _, err := insert(ctx, tx, 3); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+	checkCount(1)
+}
+
+func ExampleDeferConstraints() {
+	check := func(msg string, err error) {
+		if err != nil {
+			panic(fmt.Errorf("%s: %v", msg, err))
+		}
+	}
+
+	ctx := context.Background()
+	db, err := sql.Open(sqliteDriver, ":memory:")
+	check("Open", err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.ExecContext(ctx, ``+
+		`CREATE TABLE country (code CHAR(2) PRIMARY KEY, capital INTEGER);`+
+		`CREATE TABLE city (id INTEGER PRIMARY KEY, name TEXT, country CHAR(2) REFERENCES country (code) DEFERRABLE INITIALLY IMMEDIATE)`)
+	check("Create tables", err)
+
+	var insertCity func(ctx context.Context, tx *sql.Tx, id int, name string, country string) (sql.Result, error)
+	closeInsertCity, err := sqlfunc.Exec(ctx, db, `INSERT INTO city (id, name, country) VALUES (?, ?, ?)`, &insertCity)
+	check("Prepare insertCity", err)
+	defer closeInsertCity()
+
+	var insertCountry func(ctx context.Context, tx *sql.Tx, code string, capital int) (sql.Result, error)
+	closeInsertCountry, err := sqlfunc.Exec(ctx, db, `INSERT INTO country (code, capital) VALUES (?, ?)`, &insertCountry)
+	check("Prepare insertCountry", err)
+	defer closeInsertCountry()
+
+	err = sqlfunc.RunInTx(ctx, db, nil, func(ctx context.Context, tx *sql.Tx) error {
+		// No-op with SQLite: SET CONSTRAINTS is for PostgreSQL
+		if err := sqlfunc.DeferConstraints(ctx, tx); err != nil {
+			return err
+		}
+		// The city references a country not yet inserted
+		if _, err := insertCity(ctx, tx, 1, "Paris", "FR"); err != nil {
+			return err
+		}
+		_, err := insertCountry(ctx, tx, "FR", 1)
+		return err
+	})
+	check("RunInTx", err)
+
+	var name string
+	check("Query", db.QueryRowContext(ctx, `SELECT name FROM city JOIN country ON capital = id WHERE code = 'FR'`).Scan(&name))
+	fmt.Println(name)
+
+	// Output:
+	// Paris
+}
@@ -17,9 +17,14 @@ limitations under the License.
 package sqlfunc
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding"
 	"reflect"
+	"strings"
+	"time"
 )
 
 // PrepareConn is a subset of [*database/sql.DB], [*database/sql.Conn] or [*database/sql.Tx].
@@ -27,20 +32,115 @@ type PrepareConn interface {
 	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
 }
 
-// txStmt is a subset of [*database/sql.Tx].
-type txStmt = interface {
+// QueryConn is a subset of [*database/sql.DB], [*database/sql.Conn] or [*database/sql.Tx].
+type QueryConn interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// TxBeginner is a subset of [*database/sql.DB] or [*database/sql.Conn].
+type TxBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// StmtLocalizer is a subset of [*database/sql.Tx]: it localizes a prepared statement to
+// a transaction.
+//
+// A func created by [Exec], [QueryRow] or [QueryRowLazy] with a StmtLocalizer as second
+// argument runs the statement localized with StmtContext. This allows to give wrappers
+// of [*database/sql.Tx] (for example instrumented transactions) instead of a *sql.Tx.
+type StmtLocalizer interface {
 	StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt
 }
 
 var (
 	// Concrete types
-	typeBool = reflect.TypeOf(true)
-	typeRows = reflect.TypeOf((*sql.Rows)(nil))
+	typeBool    = reflect.TypeOf(true)
+	typeBuffer  = reflect.TypeOf((*bytes.Buffer)(nil))
+	typeRows    = reflect.TypeOf((*sql.Rows)(nil))
+	typeTime    = reflect.TypeOf(time.Time{})
+	typeTimePtr = reflect.TypeOf((*time.Time)(nil))
+
+	typeScanFunc = reflect.TypeOf((func(...interface{}) error)(nil))
+	typeStopFunc = reflect.TypeOf((func())(nil))
+	typeStrings  = reflect.TypeOf([]string(nil))
 
 	// Interfaces
-	typeContext = reflect.TypeOf([]context.Context(nil)).Elem()
-	typeResult  = reflect.TypeOf([]sql.Result(nil)).Elem()
-	typeError   = reflect.TypeOf([]error(nil)).Elem()
-	typeScanner = reflect.TypeOf([]sql.Scanner(nil)).Elem()
-	typeTxStmt  = reflect.TypeOf([]txStmt(nil)).Elem()
+	typeAny           = reflect.TypeOf([]interface{}(nil)).Elem()
+	typeContext       = reflect.TypeOf([]context.Context(nil)).Elem()
+	typeResult        = reflect.TypeOf([]sql.Result(nil)).Elem()
+	typeError         = reflect.TypeOf([]error(nil)).Elem()
+	typeScanner       = reflect.TypeOf([]sql.Scanner(nil)).Elem()
+	typeTextScanner   = reflect.TypeOf([]TextScanner(nil)).Elem()
+	typeTextMarshaler = reflect.TypeOf([]encoding.TextMarshaler(nil)).Elem()
+	typeTextUnmarshal = reflect.TypeOf([]encoding.TextUnmarshaler(nil)).Elem()
+	typeValuer        = reflect.TypeOf([]driver.Valuer(nil)).Elem()
+	typeStmtLocalizer = reflect.TypeOf([]StmtLocalizer(nil)).Elem()
 )
+
+// outTypes returns the types of the first n results of fnType.
+func outTypes(fnType reflect.Type, n int) []reflect.Type {
+	types := make([]reflect.Type, n)
+	for i := range types {
+		types[i] = fnType.Out(i)
+	}
+	return types
+}
+
+// errorResults builds the values returned by a func of type fnType when it fails with err:
+// zero values followed by err as the last value.
+func errorResults(fnType reflect.Type, err error) []reflect.Value {
+	numOut := fnType.NumOut()
+	out := make([]reflect.Value, numOut)
+	for i := 0; i < numOut-1; i++ {
+		out[i] = reflect.Zero(fnType.Out(i))
+	}
+	out[numOut-1] = reflect.ValueOf(&err).Elem()
+	return out
+}
+
+// inTypes returns the types of the arguments of fnType, starting at index first.
+func inTypes(fnType reflect.Type, first int) []reflect.Type {
+	types := make([]reflect.Type, fnType.NumIn()-first)
+	for i := range types {
+		types[i] = fnType.In(first + i)
+	}
+	return types
+}
+
+// driverPkgPath returns the import path of the package of the driver used by db,
+// or "" if it can't be determined (only [*sql.DB] and [*sql.Conn], possibly wrapped by a
+// [RewriteConn], are supported).
+func driverPkgPath(db PrepareConn) string {
+	var v interface{}
+	switch db := db.(type) {
+	case *RewriteConn:
+		return driverPkgPath(db.Unwrap())
+	case *sql.DB:
+		v = db.Driver()
+	case *sql.Conn:
+		_ = db.Raw(func(driverConn interface{}) error {
+			v = driverConn
+			return nil
+		})
+	default:
+		return ""
+	}
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return ""
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.PkgPath()
+}
+
+// isSQLiteDriver reports whether driver is a SQLite driver.
+func isSQLiteDriver(driver string) bool {
+	return driver == "github.com/mattn/go-sqlite3" || driver == "modernc.org/sqlite"
+}
+
+// isDollarDriver reports whether the driver uses Postgres-style "$N" placeholders.
+func isDollarDriver(driver string) bool {
+	return strings.HasPrefix(driver, "github.com/jackc/pgx") || driver == "github.com/lib/pq"
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package wkb registers [github.com/dolmen-go/sqlfunc] converters for geometries stored in the
+// Well-Known Binary format (WKB) of the OGC Simple Features.
+//
+// Importing the package (for its side effects) enables the scanning of WKB columns into [Point]
+// and [Geometry] destinations by [github.com/dolmen-go/sqlfunc.Scan],
+// [github.com/dolmen-go/sqlfunc.QueryRow] and [github.com/dolmen-go/sqlfunc.ForEach], and the
+// binding of [Point] and [Geometry] arguments, as WKB, of the functions created by
+// [github.com/dolmen-go/sqlfunc.Exec], [github.com/dolmen-go/sqlfunc.QueryRow] and
+// [github.com/dolmen-go/sqlfunc.Query]:
+//
+//	import _ "github.com/dolmen-go/sqlfunc/wkb"
+//
+// Columns are scanned from WKB as []byte, or from hex-encoded WKB as string (the text
+// representation of PostGIS geometries). The SRID of Extended WKB (PostGIS) is skipped.
+// Only points are supported.
+//
+// NULL is scanned as a nil [Geometry]: scanning NULL into a [Point] is an error.
+package wkb
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/dolmen-go/sqlfunc"
+)
+
+func init() {
+	sqlfunc.RegisterConverter(reflect.TypeOf(Point{}), sqlfunc.Converter{Scan: scanPoint, Value: valueGeometry})
+	sqlfunc.RegisterConverter(reflect.TypeOf((*Geometry)(nil)).Elem(), sqlfunc.Converter{Scan: scanGeometry, Value: valueGeometry})
+}
+
+// Geometry is a geometry that can be encoded as WKB. [Point] is the only implementation.
+type Geometry interface {
+	// AppendWKB appends the WKB encoding of the geometry (little endian) to b.
+	AppendWKB(b []byte) []byte
+}
+
+// Point is a point in two dimensions, such as (longitude, latitude).
+type Point struct {
+	X, Y float64
+}
+
+// WKB type codes
+const (
+	typePoint = 1
+
+	ewkbSRID = 0x20000000 // flag of the EWKB type code
+)
+
+// AppendWKB implements [Geometry].
+func (p Point) AppendWKB(b []byte) []byte {
+	var buf [21]byte
+	buf[0] = 1 // little endian
+	binary.LittleEndian.PutUint32(buf[1:], typePoint)
+	binary.LittleEndian.PutUint64(buf[5:], math.Float64bits(p.X))
+	binary.LittleEndian.PutUint64(buf[13:], math.Float64bits(p.Y))
+	return append(b, buf[:]...)
+}
+
+// Parse decodes a geometry from WKB or EWKB.
+func Parse(b []byte) (Geometry, error) {
+	if len(b) < 5 {
+		return nil, errors.New("wkb: truncated geometry")
+	}
+	var order binary.ByteOrder
+	switch b[0] {
+	case 0:
+		order = binary.BigEndian
+	case 1:
+		order = binary.LittleEndian
+	default:
+		return nil, fmt.Errorf("wkb: invalid byte order %d", b[0])
+	}
+	typ := order.Uint32(b[1:])
+	b = b[5:]
+	if typ&ewkbSRID != 0 {
+		if len(b) < 4 {
+			return nil, errors.New("wkb: truncated geometry")
+		}
+		typ &^= ewkbSRID
+		b = b[4:]
+	}
+	switch typ {
+	case typePoint:
+		if len(b) != 16 {
+			return nil, fmt.Errorf("wkb: invalid point length %d", len(b))
+		}
+		return Point{
+			X: math.Float64frombits(order.Uint64(b)),
+			Y: math.Float64frombits(order.Uint64(b[8:])),
+		}, nil
+	default:
+		return nil, fmt.Errorf("wkb: unsupported geometry type %d", typ)
+	}
+}
+
+// parseSrc parses a column value. g is nil for NULL.
+func parseSrc(src interface{}) (Geometry, error) {
+	switch src := src.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return Parse(src)
+	case string:
+		b, err := hex.DecodeString(src)
+		if err != nil {
+			return nil, fmt.Errorf("wkb: invalid hex-encoded geometry: %w", err)
+		}
+		return Parse(b)
+	default:
+		return nil, fmt.Errorf("wkb: converting %T to a geometry is unsupported", src)
+	}
+}
+
+func scanGeometry(dest interface{}, src interface{}) error {
+	g, err := parseSrc(src)
+	if err != nil {
+		return err
+	}
+	*dest.(*Geometry) = g
+	return nil
+}
+
+func scanPoint(dest interface{}, src interface{}) error {
+	g, err := parseSrc(src)
+	if err != nil {
+		return err
+	}
+	p, ok := g.(Point)
+	if !ok {
+		if g == nil {
+			return errors.New("wkb: converting NULL to Point is unsupported")
+		}
+		return fmt.Errorf("wkb: converting %T to Point is unsupported", g)
+	}
+	*dest.(*Point) = p
+	return nil
+}
+
+func valueGeometry(v interface{}) (driver.Value, error) {
+	g, _ := v.(Geometry)
+	if g == nil {
+		return nil, nil
+	}
+	return g.AppendWKB(nil), nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2022 Olivier Mengué
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wkb_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/dolmen-go/sqlfunc"
+	"github.com/dolmen-go/sqlfunc/wkb"
+)
+
+func Example() {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		fmt.Println("Open:", err)
+		return
+	}
+	defer db.Close()
+
+	if _, err = db.ExecContext(ctx, `CREATE TABLE poi (name TEXT, geom BLOB)`); err != nil {
+		fmt.Println("Create:", err)
+		return
+	}
+
+	var insert func(ctx context.Context, name string, geom wkb.Point) (sql.Result, error)
+	closeInsert, err := sqlfunc.Exec(ctx, db, `INSERT INTO poi (name, geom) VALUES (?, ?)`, &insert)
+	if err != nil {
+		fmt.Println("Exec:", err)
+		return
+	}
+	defer closeInsert()
+
+	if _, err = insert(ctx, "Eiffel Tower", wkb.Point{X: 2.2945, Y: 48.8584}); err != nil {
+		fmt.Println("insert:", err)
+		return
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT name, geom FROM poi`)
+	if err != nil {
+		fmt.Println("Query:", err)
+		return
+	}
+	err = sqlfunc.ForEach(rows, func(name string, geom wkb.Point) {
+		fmt.Printf("%s: %.4f, %.4f\n", name, geom.X, geom.Y)
+	})
+	if err != nil {
+		fmt.Println("ForEach:", err)
+	}
+
+	// Output:
+	// Eiffel Tower: 2.2945, 48.8584
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		hex string
+		g   wkb.Geometry
+	}{
+		// POINT(1 2)
+		{"0101000000000000000000f03f0000000000000040", wkb.Point{X: 1, Y: 2}},
+		{"00000000013ff00000000000004000000000000000", wkb.Point{X: 1, Y: 2}},
+		// SRID=4326;POINT(1 2)
+		{"0101000020e6100000000000000000f03f0000000000000040", wkb.Point{X: 1, Y: 2}},
+		// Invalid
+		{"", nil},
+		{"0201000000000000000000f03f0000000000000040", nil},
+		{"0101000000000000000000f03f00000000000000", nil},
+		// LINESTRING
+		{"010200000000000000", nil},
+	} {
+		b, _ := hex.DecodeString(tc.hex)
+		g, err := wkb.Parse(b)
+		if g != tc.g || (err == nil) != (tc.g != nil) {
+			t.Errorf("%s: got %v, %v, expected %v", tc.hex, g, err, tc.g)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	var echo func(ctx context.Context, p wkb.Point, g wkb.Geometry) (wkb.Point, wkb.Geometry, error)
+	closeEcho, err := sqlfunc.QueryRow(ctx, db, `SELECT ?, ?`, &echo)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeEcho()
+
+	for _, p := range []wkb.Point{{}, {X: 1, Y: 2}, {X: -122.4194, Y: 37.7749}} {
+		gotP, gotG, err := echo(ctx, p, p)
+		if err != nil || gotP != p || gotG != p {
+			t.Errorf("%v: got %v, %v, %v", p, gotP, gotG, err)
+		}
+	}
+
+	// NULL
+	_, g, err := echo(ctx, wkb.Point{}, nil)
+	if err != nil || g != nil {
+		t.Errorf("NULL: got %v, %v", g, err)
+	}
+
+	// Hex-encoded text, as returned by PostGIS
+	var fromHex func(ctx context.Context, s string) (wkb.Point, error)
+	closeFromHex, err := sqlfunc.QueryRow(ctx, db, `SELECT CAST(? AS TEXT)`, &fromHex)
+	if err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	defer closeFromHex()
+	if p, err := fromHex(ctx, "0101000020e6100000000000000000f03f0000000000000040"); err != nil || p != (wkb.Point{X: 1, Y: 2}) {
+		t.Errorf("fromHex: got %v, %v", p, err)
+	}
+}